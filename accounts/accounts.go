@@ -1,8 +1,13 @@
 package accounts
 
 import (
+	"fmt"
 	"github.com/DSiSc/craft/types"
+	"github.com/DSiSc/crypto-suite/crypto"
+	"github.com/DSiSc/wallet/accounts/eip712"
 	"github.com/DSiSc/wallet/common"
+	local "github.com/DSiSc/wallet/core/types"
+	"github.com/DSiSc/wallet/event"
 	"math/big"
 )
 
@@ -106,7 +111,7 @@ type Backend interface {
 
 	// Subscribe creates an async subscription to receive notifications when the
 	// backend detects the arrival or departure of a wallet.
-	//Subscribe(sink chan<- WalletEvent) event.Subscription
+	Subscribe(sink chan<- WalletEvent) event.Subscription
 }
 
 // WalletEventType represents the different event types that can be fired by
@@ -132,3 +137,82 @@ type WalletEvent struct {
 	Wallet Wallet          // Wallet instance arrived or departed
 	Kind   WalletEventType // Event type that happened in the system
 }
+
+// TextHash is a helper function that calculates a hash for the given message that can be
+// safely used to calculate a signature from.
+//
+// The hash is calculated as
+//
+//	keccak256("\x19Ethereum Signed Message:\n"${message length}${message}).
+//
+// This gives context to the signed message and prevents signing of transactions.
+func TextHash(data []byte) []byte {
+	msg := fmt.Sprintf("\x19Ethereum Signed Message:\n%d%s", len(data), data)
+	return crypto.Keccak256([]byte(msg))
+}
+
+// SignText signs the EIP-191 personal message hash of the data with the account
+// held by the wallet. The 65 byte [R || S || V] signature has V 27 or 28.
+func SignText(wallet Wallet, account Account, data []byte) ([]byte, error) {
+	sig, err := wallet.SignHash(account, TextHash(data))
+	if err != nil {
+		return nil, err
+	}
+	sig[64] += 27
+	return sig, nil
+}
+
+// SignTextWithPassphrase is SignText with the passphrase as extra authentication
+// information.
+func SignTextWithPassphrase(wallet Wallet, account Account, passphrase string, data []byte) ([]byte, error) {
+	sig, err := wallet.SignHashWithPassphrase(account, passphrase, TextHash(data))
+	if err != nil {
+		return nil, err
+	}
+	sig[64] += 27
+	return sig, nil
+}
+
+// VerifyText recovers the address that signed the EIP-191 personal message hash
+// of the data. The V of the signature may be 0 or 1 as well as 27 or 28.
+func VerifyText(data, sig []byte) (common.Address, error) {
+	if len(sig) != 65 {
+		return common.Address{}, fmt.Errorf("signature length %d, want 65", len(sig))
+	}
+	plain := make([]byte, 65)
+	copy(plain, sig)
+	if plain[64] < 27 {
+		plain[64] += 27
+	}
+	return local.RecoverPlain(common.BytesToHash(TextHash(data)), plain)
+}
+
+// SignTypedData signs the EIP-712 hash of the typed structured data with the
+// account held by the wallet. The 65 byte [R || S || V] signature has V 27 or 28.
+func SignTypedData(wallet Wallet, account Account, data *eip712.TypedData) ([]byte, error) {
+	hash, err := data.Hash()
+	if err != nil {
+		return nil, err
+	}
+	sig, err := wallet.SignHash(account, hash)
+	if err != nil {
+		return nil, err
+	}
+	sig[64] += 27
+	return sig, nil
+}
+
+// SignTypedDataWithPassphrase is SignTypedData with the passphrase as extra
+// authentication information.
+func SignTypedDataWithPassphrase(wallet Wallet, account Account, passphrase string, data *eip712.TypedData) ([]byte, error) {
+	hash, err := data.Hash()
+	if err != nil {
+		return nil, err
+	}
+	sig, err := wallet.SignHashWithPassphrase(account, passphrase, hash)
+	if err != nil {
+		return nil, err
+	}
+	sig[64] += 27
+	return sig, nil
+}
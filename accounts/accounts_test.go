@@ -1,9 +1,49 @@
 package accounts
 
 import (
+	"bytes"
 	"testing"
+
+	"github.com/DSiSc/crypto-suite/crypto"
+	"github.com/DSiSc/wallet/common"
+	"github.com/DSiSc/wallet/common/hexutil"
+	"github.com/stretchr/testify/assert"
 )
 
 func TestTextHash(t *testing.T) {
+	hash := TextHash([]byte("Hello Joe"))
+	want := hexutil.MustDecode("0xa080337ae51c4e064c189e113edd0ba391df9206e2f49db658bb32cf2911730b")
+	if !bytes.Equal(hash, want) {
+		t.Fatalf("wrong hash: %x", hash)
+	}
+}
+
+func TestVerifyText(t *testing.T) {
+	key, err := crypto.GenerateKey()
+	assert.Nil(t, err)
+	addr := common.Address(crypto.PubkeyToAddress(key.PublicKey))
+	msg := []byte("Hello Joe")
+
+	sig, err := crypto.Sign(TextHash(msg), key)
+	assert.Nil(t, err)
+
+	// V is accepted as 0/1 and as 27/28
+	signer, err := VerifyText(msg, sig)
+	assert.Nil(t, err)
+	assert.Equal(t, addr, signer)
+	sig[64] += 27
+	signer, err = VerifyText(msg, sig)
+	assert.Nil(t, err)
+	assert.Equal(t, addr, signer)
 
+	// Another message recovers another signer
+	signer, err = VerifyText([]byte("Hello Jane"), sig)
+	if err == nil {
+		assert.NotEqual(t, addr, signer)
+	}
+	_, err = VerifyText(msg, sig[:64])
+	assert.NotNil(t, err)
+	sig[64] = 29
+	_, err = VerifyText(msg, sig)
+	assert.NotNil(t, err)
 }
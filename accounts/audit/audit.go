@@ -0,0 +1,257 @@
+// Package audit implements a tamper-evident, append-only log of the operations
+// performed with account keys.
+//
+// The log is a file of JSON entries, one per line. Every entry carries the
+// digest of its predecessor and a digest over its own content, so removing,
+// reordering or editing any entry breaks the chain from that point on.
+//
+// Several processes may append to the same log: every append holds an exclusive
+// lock on the file and extends the chain from its actual last entry.
+package audit
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math/big"
+	"os"
+	"path/filepath"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/DSiSc/crypto-suite/crypto"
+	"github.com/DSiSc/wallet/common"
+	"github.com/DSiSc/wallet/common/hexutil"
+)
+
+// Operations recorded by the keystore.
+const (
+	OpSignHash               = "signHash"
+	OpSignTx                 = "signTx"
+	OpSignHashWithPassphrase = "signHashWithPassphrase"
+	OpSignTxWithPassphrase   = "signTxWithPassphrase"
+	OpExport                 = "export"
+	OpExportECDSA            = "exportECDSA"
+	OpDelete                 = "delete"
+	OpUpdate                 = "update"
+	OpMigrate                = "migrate"
+	OpTrash                  = "trash"
+	OpRestore                = "restore"
+	OpSplit                  = "split"
+)
+
+// OutcomeSuccess is the outcome of operations that completed without error.
+const OutcomeSuccess = "success"
+
+// Entry is a single record of the audit log.
+type Entry struct {
+	Index     uint64         `json:"index"`
+	Time      time.Time      `json:"time"`
+	Account   common.Address `json:"account"`
+	Operation string         `json:"operation"`
+	Hash      *common.Hash   `json:"hash,omitempty"`    // Signed data hash or transaction signing hash
+	ChainID   *hexutil.Big   `json:"chainId,omitempty"` // Chain ID of signed transactions
+	Outcome   string         `json:"outcome"`           // OutcomeSuccess or the error of the operation
+	Prev      common.Hash    `json:"prev"`              // Digest of the previous entry, zero for the first one
+	Digest    common.Hash    `json:"digest"`            // Digest over all the other fields
+}
+
+// digest computes the chained digest of the entry.
+func (e *Entry) digest() common.Hash {
+	cpy := *e
+	cpy.Digest = common.Hash{}
+	blob, _ := json.Marshal(&cpy)
+	return common.BytesToHash(crypto.Keccak256(blob))
+}
+
+// CorruptionError is returned when the hash chain of a log is broken.
+type CorruptionError struct {
+	Line   int // Line of the first invalid entry, starting at 1
+	Reason string
+}
+
+func (err *CorruptionError) Error() string {
+	return fmt.Sprintf("audit log corrupted at line %d: %s", err.Line, err.Reason)
+}
+
+// Log appends entries to an audit log file.
+type Log struct {
+	file  *os.File
+	size  int64       // Size of the file up to the last entry read or written
+	index uint64      // Index of the next entry
+	prev  common.Hash // Digest of the last entry
+
+	mu sync.Mutex
+}
+
+// Open opens the audit log at path for appending, creating it if needed. The
+// existing entries are verified so that new ones extend a valid chain.
+func Open(path string) (*Log, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return nil, err
+	}
+	file, err := os.OpenFile(path, os.O_RDWR|os.O_APPEND|os.O_CREATE, 0600)
+	if err != nil {
+		return nil, err
+	}
+	l := &Log{file: file}
+	if err := syscall.Flock(int(file.Fd()), syscall.LOCK_SH); err != nil {
+		file.Close()
+		return nil, err
+	}
+	err = l.catchUp()
+	syscall.Flock(int(file.Fd()), syscall.LOCK_UN)
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+	return l, nil
+}
+
+// catchUp reads the entries appended to the file since the last read or write,
+// by this log or another one, and checks that they extend the chain. The file
+// must be locked.
+func (l *Log) catchUp() error {
+	info, err := l.file.Stat()
+	if err != nil {
+		return err
+	}
+	switch size := info.Size(); {
+	case size == l.size:
+		return nil
+	case size < l.size:
+		return &CorruptionError{Line: int(l.index), Reason: "log truncated"}
+	}
+	entries, err := decode(io.NewSectionReader(l.file, l.size, info.Size()-l.size))
+	if cerr, ok := err.(*CorruptionError); ok {
+		cerr.Line += int(l.index)
+	}
+	if err != nil {
+		return err
+	}
+	for i := range entries {
+		if err := check(&entries[i], l.index, l.prev); err != nil {
+			return err
+		}
+		l.index, l.prev = entries[i].Index+1, entries[i].Digest
+	}
+	l.size = info.Size()
+	return nil
+}
+
+// Append records an operation on the account. A nil opErr records a successful
+// operation. The entry is synced to disk before Append returns.
+func (l *Log) Append(account common.Address, operation string, hash *common.Hash, chainID *big.Int, opErr error) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if err := syscall.Flock(int(l.file.Fd()), syscall.LOCK_EX); err != nil {
+		return err
+	}
+	defer syscall.Flock(int(l.file.Fd()), syscall.LOCK_UN)
+
+	// Other processes may have appended entries since the last call
+	if err := l.catchUp(); err != nil {
+		return err
+	}
+	entry := &Entry{
+		Index:     l.index,
+		Time:      time.Now().UTC(),
+		Account:   account,
+		Operation: operation,
+		Hash:      hash,
+		Outcome:   OutcomeSuccess,
+		Prev:      l.prev,
+	}
+	if chainID != nil {
+		entry.ChainID = (*hexutil.Big)(new(big.Int).Set(chainID))
+	}
+	if opErr != nil {
+		entry.Outcome = opErr.Error()
+	}
+	entry.Digest = entry.digest()
+
+	line, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	n, err := l.file.Write(append(line, '\n'))
+	l.size += int64(n)
+	if err != nil {
+		return err
+	}
+	if err := l.file.Sync(); err != nil {
+		return err
+	}
+	l.index, l.prev = entry.Index+1, entry.Digest
+	return nil
+}
+
+// Close closes the underlying file.
+func (l *Log) Close() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	return l.file.Close()
+}
+
+// Read loads all the entries of the audit log at path without verifying them.
+func Read(path string) ([]Entry, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	// Keep out half written entries
+	if err := syscall.Flock(int(file.Fd()), syscall.LOCK_SH); err != nil {
+		return nil, err
+	}
+	return decode(file)
+}
+
+func decode(r io.Reader) ([]Entry, error) {
+	var (
+		entries []Entry
+		scanner = bufio.NewScanner(r)
+	)
+	scanner.Buffer(make([]byte, 4096), 1024*1024)
+	for line := 1; scanner.Scan(); line++ {
+		var entry Entry
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+			return nil, &CorruptionError{Line: line, Reason: err.Error()}
+		}
+		entries = append(entries, entry)
+	}
+	return entries, scanner.Err()
+}
+
+// Verify checks that the entries form an unbroken hash chain starting at the
+// beginning of the log.
+func Verify(entries []Entry) error {
+	var prev common.Hash
+	for i := range entries {
+		if err := check(&entries[i], uint64(i), prev); err != nil {
+			return err
+		}
+		prev = entries[i].Digest
+	}
+	return nil
+}
+
+// check verifies that the entry is the one at index, following the entry with
+// the digest prev.
+func check(entry *Entry, index uint64, prev common.Hash) error {
+	line := int(index) + 1
+	switch {
+	case entry.Index != index:
+		return &CorruptionError{Line: line, Reason: fmt.Sprintf("index %d, want %d", entry.Index, index)}
+	case entry.Prev != prev:
+		return &CorruptionError{Line: line, Reason: "previous digest mismatch"}
+	case entry.Digest != entry.digest():
+		return &CorruptionError{Line: line, Reason: "digest mismatch"}
+	}
+	return nil
+}
@@ -0,0 +1,123 @@
+package audit
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"math/big"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/DSiSc/wallet/common"
+	"github.com/stretchr/testify/assert"
+)
+
+var testAddress = common.HexToAddress("0x1000000000000000000000000000000000000001")
+
+func tmpLog(t *testing.T) (string, string) {
+	dir, err := ioutil.TempDir("", "audit-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return dir, filepath.Join(dir, "audit.log")
+}
+
+func TestAppend(t *testing.T) {
+	dir, path := tmpLog(t)
+	defer os.RemoveAll(dir)
+
+	log, err := Open(path)
+	assert.Nil(t, err)
+	hash := common.HexToHash("0x01")
+	assert.Nil(t, log.Append(testAddress, OpSignTx, &hash, big.NewInt(1), nil))
+	assert.Nil(t, log.Append(testAddress, OpSignHash, nil, nil, errors.New("authentication needed")))
+	assert.Nil(t, log.Close())
+
+	// Reopening the log continues the chain
+	log, err = Open(path)
+	assert.Nil(t, err)
+	assert.Nil(t, log.Append(testAddress, OpExport, nil, nil, nil))
+	assert.Nil(t, log.Close())
+
+	entries, err := Read(path)
+	assert.Nil(t, err)
+	assert.Nil(t, Verify(entries))
+	assert.Len(t, entries, 3)
+
+	assert.Equal(t, OpSignTx, entries[0].Operation)
+	assert.Equal(t, &hash, entries[0].Hash)
+	assert.Equal(t, big.NewInt(1), entries[0].ChainID.ToInt())
+	assert.Equal(t, OutcomeSuccess, entries[0].Outcome)
+	assert.Equal(t, "authentication needed", entries[1].Outcome)
+	assert.Equal(t, uint64(2), entries[2].Index)
+	assert.Equal(t, entries[1].Digest, entries[2].Prev)
+
+	info, err := os.Stat(path)
+	assert.Nil(t, err)
+	assert.Equal(t, os.FileMode(0600), info.Mode().Perm())
+}
+
+func TestTamper(t *testing.T) {
+	dir, path := tmpLog(t)
+	defer os.RemoveAll(dir)
+
+	log, _ := Open(path)
+	for i := 0; i < 3; i++ {
+		log.Append(testAddress, OpSignHash, nil, nil, nil)
+	}
+	log.Close()
+	content, _ := ioutil.ReadFile(path)
+	lines := strings.SplitAfter(string(content), "\n")
+
+	// Edited entry
+	edited := strings.Replace(lines[1], OpSignHash, OpExport, 1)
+	ioutil.WriteFile(path, []byte(lines[0]+edited+lines[2]), 0600)
+	entries, err := Read(path)
+	assert.Nil(t, err)
+	assert.Equal(t, &CorruptionError{Line: 2, Reason: "digest mismatch"}, Verify(entries))
+	_, err = Open(path)
+	assert.NotNil(t, err)
+
+	// Removed entry
+	ioutil.WriteFile(path, []byte(lines[0]+lines[2]), 0600)
+	entries, _ = Read(path)
+	assert.IsType(t, &CorruptionError{}, Verify(entries))
+
+	// Truncated entry
+	ioutil.WriteFile(path, []byte(lines[0]+lines[1][:10]), 0600)
+	_, err = Read(path)
+	assert.IsType(t, &CorruptionError{}, err)
+}
+
+func TestConcurrentLogs(t *testing.T) {
+	dir, path := tmpLog(t)
+	defer os.RemoveAll(dir)
+
+	// As a server and a command of another process both logging
+	first, err := Open(path)
+	assert.Nil(t, err)
+	defer first.Close()
+	second, err := Open(path)
+	assert.Nil(t, err)
+	defer second.Close()
+
+	for i := 0; i < 3; i++ {
+		assert.Nil(t, first.Append(testAddress, OpSignHash, nil, nil, nil))
+		assert.Nil(t, second.Append(testAddress, OpExport, nil, nil, nil))
+	}
+	entries, err := Read(path)
+	assert.Nil(t, err)
+	assert.Nil(t, Verify(entries))
+	assert.Len(t, entries, 6)
+
+	// Entries of other logs are checked before extending the chain
+	forged := entries[5]
+	forged.Operation = OpDelete
+	line, _ := json.Marshal(&forged)
+	file, _ := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0600)
+	file.Write(append(line, '\n'))
+	file.Close()
+	assert.Equal(t, &CorruptionError{Line: 7, Reason: "index 5, want 6"}, first.Append(testAddress, OpSignHash, nil, nil, nil))
+}
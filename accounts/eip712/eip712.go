@@ -0,0 +1,553 @@
+// Package eip712 implements the hashing of typed structured data as defined by
+// EIP-712, so that off-chain messages such as orders and permits can be signed
+// in a form users can inspect.
+//
+// A typed data document declares its struct types, the domain binding the
+// signature to an application and chain, and the message, a value of the
+// primary type:
+//
+//	{
+//	  "types": {
+//	    "EIP712Domain": [{"name": "name", "type": "string"}, ...],
+//	    "Mail": [{"name": "from", "type": "Person"}, ...],
+//	    ...
+//	  },
+//	  "primaryType": "Mail",
+//	  "domain": {"name": "Ether Mail", ...},
+//	  "message": {"from": {...}, ...}
+//	}
+package eip712
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/DSiSc/crypto-suite/crypto"
+	"github.com/DSiSc/wallet/common"
+	"github.com/DSiSc/wallet/common/hexutil"
+	"github.com/DSiSc/wallet/common/math"
+)
+
+// DomainType is the name of the struct type of the domain.
+const DomainType = "EIP712Domain"
+
+// Type is a member of a struct type.
+type Type struct {
+	Name string `json:"name"`
+	Type string `json:"type"`
+}
+
+// Types maps the names of the struct types to their members.
+type Types map[string][]Type
+
+// TypedData is a typed structured data document.
+type TypedData struct {
+	Types       Types                  `json:"types"`
+	PrimaryType string                 `json:"primaryType"`
+	Domain      map[string]interface{} `json:"domain"`
+	Message     map[string]interface{} `json:"message"`
+}
+
+// Field is a decoded member of a struct value, for display. Atomic values are
+// formatted into Value; the members of structs and the elements of arrays are
+// listed in Fields.
+type Field struct {
+	Name   string  `json:"name"`
+	Type   string  `json:"type"`
+	Value  string  `json:"value,omitempty"`
+	Fields []Field `json:"fields,omitempty"`
+}
+
+// Parse decodes a typed data JSON document and checks its types. Numbers are
+// decoded exactly, so that 256 bit integers are not rounded.
+func Parse(data []byte) (*TypedData, error) {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	td := new(TypedData)
+	if err := dec.Decode(td); err != nil {
+		return nil, err
+	}
+	if err := td.validate(); err != nil {
+		return nil, err
+	}
+	return td, nil
+}
+
+// validate checks that the types are well formed and that the domain and
+// primary types are declared.
+func (td *TypedData) validate() error {
+	if _, ok := td.Types[DomainType]; !ok {
+		return fmt.Errorf("missing %s type", DomainType)
+	}
+	if _, ok := td.Types[td.PrimaryType]; !ok {
+		return fmt.Errorf("unknown primary type %q", td.PrimaryType)
+	}
+	for name, members := range td.Types {
+		if !isIdentifier(name) || isAtomic(name) {
+			return fmt.Errorf("invalid type name %q", name)
+		}
+		seen := make(map[string]bool)
+		for _, member := range members {
+			if !isIdentifier(member.Name) {
+				return fmt.Errorf("invalid member name %q in type %s", member.Name, name)
+			}
+			if seen[member.Name] {
+				return fmt.Errorf("duplicate member %s in type %s", member.Name, name)
+			}
+			seen[member.Name] = true
+
+			typ := member.Type
+			for {
+				elem, _, isArray, err := splitArray(typ)
+				if err != nil {
+					return fmt.Errorf("invalid type of %s.%s: %v", name, member.Name, err)
+				}
+				if !isArray {
+					break
+				}
+				typ = elem
+			}
+			if _, ok := td.Types[typ]; !ok && !isAtomic(typ) {
+				return fmt.Errorf("unknown type %q of %s.%s", typ, name, member.Name)
+			}
+		}
+	}
+	return nil
+}
+
+// Hash returns the EIP-712 hash of the message to sign:
+//
+//	keccak256("\x19\x01" ‖ domainSeparator ‖ hashStruct(message))
+func (td *TypedData) Hash() ([]byte, error) {
+	domainSeparator, err := td.DomainSeparator()
+	if err != nil {
+		return nil, err
+	}
+	messageHash, err := td.HashStruct(td.PrimaryType, td.Message)
+	if err != nil {
+		return nil, err
+	}
+	return crypto.Keccak256([]byte{0x19, 0x01}, domainSeparator, messageHash), nil
+}
+
+// DomainSeparator returns the hash of the domain.
+func (td *TypedData) DomainSeparator() ([]byte, error) {
+	return td.HashStruct(DomainType, td.Domain)
+}
+
+// HashStruct returns the hash of the encoding of a value of the struct type.
+func (td *TypedData) HashStruct(typ string, data map[string]interface{}) ([]byte, error) {
+	enc, err := td.EncodeData(typ, data)
+	if err != nil {
+		return nil, err
+	}
+	return crypto.Keccak256(enc), nil
+}
+
+// TypeHash returns the hash of the encoding of the struct type.
+func (td *TypedData) TypeHash(typ string) []byte {
+	return crypto.Keccak256([]byte(td.EncodeType(typ)))
+}
+
+// EncodeType returns the encoding of the struct type, followed by the encodings
+// of the struct types it references, in alphabetical order:
+//
+//	Mail(Person from,Person to,string contents)Person(string name,address wallet)
+func (td *TypedData) EncodeType(typ string) string {
+	deps := td.dependencies(typ, make(map[string]bool))
+	if len(deps) > 1 {
+		sort.Strings(deps[1:])
+	}
+	var buf bytes.Buffer
+	for _, dep := range deps {
+		buf.WriteString(dep)
+		buf.WriteString("(")
+		for i, member := range td.Types[dep] {
+			if i > 0 {
+				buf.WriteString(",")
+			}
+			buf.WriteString(member.Type + " " + member.Name)
+		}
+		buf.WriteString(")")
+	}
+	return buf.String()
+}
+
+// dependencies returns the struct type and the struct types it references,
+// directly or not, skipping those already found.
+func (td *TypedData) dependencies(typ string, found map[string]bool) []string {
+	for {
+		elem, _, isArray, _ := splitArray(typ)
+		if !isArray {
+			break
+		}
+		typ = elem
+	}
+	if _, ok := td.Types[typ]; !ok || found[typ] {
+		return nil
+	}
+	found[typ] = true
+	deps := []string{typ}
+	for _, member := range td.Types[typ] {
+		deps = append(deps, td.dependencies(member.Type, found)...)
+	}
+	return deps
+}
+
+// EncodeData returns the encoding of a value of the struct type: its type hash
+// followed by the 32 byte encodings of its members.
+func (td *TypedData) EncodeData(typ string, data map[string]interface{}) ([]byte, error) {
+	members, ok := td.Types[typ]
+	if !ok {
+		return nil, fmt.Errorf("unknown type %q", typ)
+	}
+	if err := checkMembers(typ, members, data); err != nil {
+		return nil, err
+	}
+	buf := td.TypeHash(typ)
+	for _, member := range members {
+		enc, err := td.encodeValue(member.Type, data[member.Name])
+		if err != nil {
+			return nil, fmt.Errorf("%s.%s: %v", typ, member.Name, err)
+		}
+		buf = append(buf, enc...)
+	}
+	return buf, nil
+}
+
+// encodeValue returns the 32 byte encoding of a value of any type.
+func (td *TypedData) encodeValue(typ string, value interface{}) ([]byte, error) {
+	elem, length, isArray, err := splitArray(typ)
+	if err != nil {
+		return nil, err
+	}
+	if isArray {
+		items, err := arrayItems(value, length)
+		if err != nil {
+			return nil, err
+		}
+		var buf []byte
+		for i, item := range items {
+			enc, err := td.encodeValue(elem, item)
+			if err != nil {
+				return nil, fmt.Errorf("[%d]: %v", i, err)
+			}
+			buf = append(buf, enc...)
+		}
+		return crypto.Keccak256(buf), nil
+	}
+	if _, ok := td.Types[typ]; ok {
+		data, ok := value.(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf("%v is not a %s struct", value, typ)
+		}
+		return td.HashStruct(typ, data)
+	}
+	return encodeAtomic(typ, value)
+}
+
+// Format decodes a value of the struct type for display.
+func (td *TypedData) Format(typ string, data map[string]interface{}) ([]Field, error) {
+	members, ok := td.Types[typ]
+	if !ok {
+		return nil, fmt.Errorf("unknown type %q", typ)
+	}
+	if err := checkMembers(typ, members, data); err != nil {
+		return nil, err
+	}
+	fields := make([]Field, len(members))
+	for i, member := range members {
+		field, err := td.formatValue(member.Name, member.Type, data[member.Name])
+		if err != nil {
+			return nil, fmt.Errorf("%s.%s: %v", typ, member.Name, err)
+		}
+		fields[i] = field
+	}
+	return fields, nil
+}
+
+func (td *TypedData) formatValue(name, typ string, value interface{}) (Field, error) {
+	field := Field{Name: name, Type: typ}
+
+	elem, length, isArray, err := splitArray(typ)
+	if err != nil {
+		return field, err
+	}
+	if isArray {
+		items, err := arrayItems(value, length)
+		if err != nil {
+			return field, err
+		}
+		field.Fields = make([]Field, len(items))
+		for i, item := range items {
+			if field.Fields[i], err = td.formatValue(fmt.Sprintf("[%d]", i), elem, item); err != nil {
+				return field, fmt.Errorf("[%d]: %v", i, err)
+			}
+		}
+		return field, nil
+	}
+	if _, ok := td.Types[typ]; ok {
+		data, ok := value.(map[string]interface{})
+		if !ok {
+			return field, fmt.Errorf("%v is not a %s struct", value, typ)
+		}
+		field.Fields, err = td.Format(typ, data)
+		return field, err
+	}
+	field.Value, err = formatAtomic(typ, value)
+	return field, err
+}
+
+// checkMembers checks that the value of the struct type has all its members and
+// nothing else.
+func checkMembers(typ string, members []Type, data map[string]interface{}) error {
+	for _, member := range members {
+		if _, ok := data[member.Name]; !ok {
+			return fmt.Errorf("%s: missing member %s", typ, member.Name)
+		}
+	}
+	if len(data) > len(members) {
+		for name := range data {
+			if !hasMember(members, name) {
+				return fmt.Errorf("%s: unknown member %s", typ, name)
+			}
+		}
+	}
+	return nil
+}
+
+func hasMember(members []Type, name string) bool {
+	for _, member := range members {
+		if member.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// splitArray splits an array type into the type of its elements and its length,
+// -1 for dynamic arrays.
+func splitArray(typ string) (elem string, length int, isArray bool, err error) {
+	if !strings.HasSuffix(typ, "]") {
+		return typ, 0, false, nil
+	}
+	open := strings.LastIndex(typ, "[")
+	if open <= 0 {
+		return "", 0, false, fmt.Errorf("invalid array type %q", typ)
+	}
+	elem, size := typ[:open], typ[open+1:len(typ)-1]
+	if size == "" {
+		return elem, -1, true, nil
+	}
+	length, err = strconv.Atoi(size)
+	if err != nil || length <= 0 {
+		return "", 0, false, fmt.Errorf("invalid array length in %q", typ)
+	}
+	return elem, length, true, nil
+}
+
+// arrayItems returns the elements of an array value, checking the length of
+// fixed size arrays.
+func arrayItems(value interface{}, length int) ([]interface{}, error) {
+	items, ok := value.([]interface{})
+	if !ok {
+		return nil, fmt.Errorf("%v is not an array", value)
+	}
+	if length >= 0 && len(items) != length {
+		return nil, fmt.Errorf("array of %d elements, want %d", len(items), length)
+	}
+	return items, nil
+}
+
+func isIdentifier(name string) bool {
+	if name == "" {
+		return false
+	}
+	for i, c := range name {
+		switch {
+		case c == '_' || c == '$' || 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z':
+		case '0' <= c && c <= '9' && i > 0:
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// isAtomic reports whether the type is one of the atomic types of Solidity.
+func isAtomic(typ string) bool {
+	switch typ {
+	case "address", "bool", "string", "bytes":
+		return true
+	}
+	_, _, err := atomicSize(typ)
+	return err == nil
+}
+
+// atomicSize parses the size of the bytesN, intN and uintN types: N bytes for
+// bytesN, N bits for the integers.
+func atomicSize(typ string) (kind string, size int, err error) {
+	for _, kind := range []string{"bytes", "uint", "int"} {
+		if !strings.HasPrefix(typ, kind) {
+			continue
+		}
+		size, err := strconv.Atoi(typ[len(kind):])
+		switch {
+		case err != nil:
+		case kind == "bytes" && size >= 1 && size <= 32:
+			return kind, size, nil
+		case kind != "bytes" && size >= 8 && size <= 256 && size%8 == 0:
+			return kind, size, nil
+		}
+		break
+	}
+	return "", 0, fmt.Errorf("unknown type %q", typ)
+}
+
+// encodeAtomic returns the 32 byte encoding of a value of an atomic type.
+func encodeAtomic(typ string, value interface{}) ([]byte, error) {
+	switch typ {
+	case "string":
+		s, ok := value.(string)
+		if !ok {
+			return nil, fmt.Errorf("%v is not a string", value)
+		}
+		return crypto.Keccak256([]byte(s)), nil
+	case "bytes":
+		b, err := parseBytes(value)
+		if err != nil {
+			return nil, err
+		}
+		return crypto.Keccak256(b), nil
+	case "bool":
+		b, ok := value.(bool)
+		if !ok {
+			return nil, fmt.Errorf("%v is not a bool", value)
+		}
+		enc := make([]byte, 32)
+		if b {
+			enc[31] = 1
+		}
+		return enc, nil
+	case "address":
+		addr, err := parseAddress(value)
+		if err != nil {
+			return nil, err
+		}
+		return common.LeftPadBytes(addr[:], 32), nil
+	}
+	kind, size, err := atomicSize(typ)
+	if err != nil {
+		return nil, err
+	}
+	if kind == "bytes" {
+		b, err := parseFixedBytes(value, size)
+		if err != nil {
+			return nil, err
+		}
+		return common.RightPadBytes(b, 32), nil
+	}
+	v, err := parseInteger(value, kind == "int", size)
+	if err != nil {
+		return nil, err
+	}
+	return math.PaddedBigBytes(math.U256(v), 32), nil
+}
+
+// formatAtomic formats a value of an atomic type for display.
+func formatAtomic(typ string, value interface{}) (string, error) {
+	switch typ {
+	case "string":
+		s, ok := value.(string)
+		if !ok {
+			return "", fmt.Errorf("%v is not a string", value)
+		}
+		return strconv.Quote(s), nil
+	case "bytes":
+		b, err := parseBytes(value)
+		return hexutil.Encode(b), err
+	case "bool":
+		b, ok := value.(bool)
+		if !ok {
+			return "", fmt.Errorf("%v is not a bool", value)
+		}
+		return strconv.FormatBool(b), nil
+	case "address":
+		addr, err := parseAddress(value)
+		return addr.Hex(), err
+	}
+	kind, size, err := atomicSize(typ)
+	if err != nil {
+		return "", err
+	}
+	if kind == "bytes" {
+		b, err := parseFixedBytes(value, size)
+		return hexutil.Encode(b), err
+	}
+	v, err := parseInteger(value, kind == "int", size)
+	if err != nil {
+		return "", err
+	}
+	return v.String(), nil
+}
+
+func parseBytes(value interface{}) ([]byte, error) {
+	s, ok := value.(string)
+	if !ok {
+		return nil, fmt.Errorf("%v is not a hex string", value)
+	}
+	return hexutil.Decode(s)
+}
+
+func parseFixedBytes(value interface{}, size int) ([]byte, error) {
+	b, err := parseBytes(value)
+	if err != nil {
+		return nil, err
+	}
+	if len(b) != size {
+		return nil, fmt.Errorf("%d bytes, want %d", len(b), size)
+	}
+	return b, nil
+}
+
+func parseAddress(value interface{}) (common.Address, error) {
+	s, ok := value.(string)
+	if !ok || !strings.HasPrefix(s, "0x") || !common.IsHexAddress(s) {
+		return common.Address{}, fmt.Errorf("%v is not a hex address", value)
+	}
+	return common.HexToAddress(s), nil
+}
+
+// parseInteger parses a number, or a string in decimal or hex, as an integer of
+// the given size in bits.
+func parseInteger(value interface{}, signed bool, size int) (*big.Int, error) {
+	var s string
+	switch v := value.(type) {
+	case json.Number:
+		s = string(v)
+	case string:
+		s = v
+	case float64:
+		s = strconv.FormatFloat(v, 'f', -1, 64)
+	default:
+		return nil, fmt.Errorf("%v is not an integer", value)
+	}
+	v, ok := math.ParseBig256(s)
+	if !ok {
+		return nil, fmt.Errorf("%q is not an integer", s)
+	}
+	min, max := new(big.Int), new(big.Int).Lsh(big.NewInt(1), uint(size))
+	if signed {
+		max.Rsh(max, 1)
+		min.Neg(max)
+	}
+	if v.Cmp(min) < 0 || v.Cmp(max) >= 0 {
+		return nil, fmt.Errorf("%v out of range for %d bit integers", v, size)
+	}
+	return v, nil
+}
@@ -0,0 +1,165 @@
+package eip712
+
+import (
+	"encoding/hex"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/DSiSc/crypto-suite/crypto"
+	"github.com/stretchr/testify/assert"
+)
+
+func loadMail(t *testing.T) *TypedData {
+	input, err := ioutil.ReadFile(filepath.Join("testdata", "mail.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	td, err := Parse(input)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return td
+}
+
+// The example of the EIP.
+func TestHash(t *testing.T) {
+	td := loadMail(t)
+
+	assert.Equal(t, "Mail(Person from,Person to,string contents)Person(string name,address wallet)", td.EncodeType("Mail"))
+	assert.Equal(t, "a0cedeb2dc280ba39b857546d74f5549c3a1d7bdc2dd96bf881f76108e23dac2", hex.EncodeToString(td.TypeHash("Mail")))
+
+	messageHash, err := td.HashStruct(td.PrimaryType, td.Message)
+	assert.Nil(t, err)
+	assert.Equal(t, "c52c0ee5d84264471806290a3f2c4cecfc5490626bf912d01f240d7a274b371e", hex.EncodeToString(messageHash))
+
+	domainSeparator, err := td.DomainSeparator()
+	assert.Nil(t, err)
+	assert.Equal(t, "f2cee375fa42b42143804025fc449deafd50cc031ca257e0b194a650a912090f", hex.EncodeToString(domainSeparator))
+
+	hash, err := td.Hash()
+	assert.Nil(t, err)
+	assert.Equal(t, "be609aee343fb3c4b28e1df9e632fca64fcfaede20f02e86244efddf30957bd2", hex.EncodeToString(hash))
+}
+
+func TestEncodeArrays(t *testing.T) {
+	td, err := Parse([]byte(`{
+		"types": {
+			"EIP712Domain": [{"name": "name", "type": "string"}],
+			"Person": [{"name": "name", "type": "string"}, {"name": "wallets", "type": "address[]"}],
+			"Group": [{"name": "members", "type": "Person[]"}, {"name": "ids", "type": "uint8[2]"}]
+		},
+		"primaryType": "Group",
+		"domain": {"name": "test"},
+		"message": {
+			"members": [{"name": "Cow", "wallets": ["0xCD2a3d9F938E13CD947Ec05AbC7FE734Df8DD826"]}],
+			"ids": [1, "0x02"]
+		}
+	}`))
+	assert.Nil(t, err)
+	assert.Equal(t, "Group(Person[] members,uint8[2] ids)Person(string name,address[] wallets)", td.EncodeType("Group"))
+
+	// An array is encoded as the hash of its encoded elements
+	person, err := td.HashStruct("Person", td.Message["members"].([]interface{})[0].(map[string]interface{}))
+	assert.Nil(t, err)
+	members, err := td.encodeValue("Person[]", td.Message["members"])
+	assert.Nil(t, err)
+	assert.Equal(t, crypto.Keccak256(person), members)
+
+	enc, err := td.EncodeData("Group", td.Message)
+	assert.Nil(t, err)
+	assert.Len(t, enc, 3*32)
+
+	// Fixed size arrays must have their exact length
+	td.Message["ids"] = []interface{}{1}
+	_, err = td.Hash()
+	assert.NotNil(t, err)
+}
+
+func TestEncodeAtomic(t *testing.T) {
+	tests := []struct {
+		typ   string
+		value interface{}
+		enc   string
+	}{
+		{"bool", true, "0000000000000000000000000000000000000000000000000000000000000001"},
+		{"uint8", "255", "00000000000000000000000000000000000000000000000000000000000000ff"},
+		{"int8", float64(-1), "ffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffff"},
+		{"bytes4", "0xdeadbeef", "deadbeef00000000000000000000000000000000000000000000000000000000"},
+		{"address", "0xCD2a3d9F938E13CD947Ec05AbC7FE734Df8DD826", "000000000000000000000000cd2a3d9f938e13cd947ec05abc7fe734df8dd826"},
+		{"bytes", "0x", "c5d2460186f7233c927e7db2dcc703c0e500b653ca82273b7bfad8045d85a470"},
+	}
+	for _, test := range tests {
+		enc, err := encodeAtomic(test.typ, test.value)
+		assert.Nil(t, err, test.typ)
+		assert.Equal(t, test.enc, hex.EncodeToString(enc), test.typ)
+	}
+
+	for _, test := range []struct {
+		typ   string
+		value interface{}
+	}{
+		{"uint8", "256"},
+		{"int8", "-129"},
+		{"uint256", "-1"},
+		{"bytes4", "0xdead"},
+		{"bool", "true"},
+		{"address", "0x1234"},
+		{"string", 1.0},
+		{"uint7", "1"},
+	} {
+		_, err := encodeAtomic(test.typ, test.value)
+		assert.NotNil(t, err, test.typ)
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	tests := map[string]string{
+		"missing domain type": `{"types": {"Mail": []}, "primaryType": "Mail"}`,
+		"unknown primary":     `{"types": {"EIP712Domain": []}, "primaryType": "Mail"}`,
+		"unknown member type": `{"types": {"EIP712Domain": [{"name": "a", "type": "Foo"}]}, "primaryType": "EIP712Domain"}`,
+		"duplicate member":    `{"types": {"EIP712Domain": [{"name": "a", "type": "bool"}, {"name": "a", "type": "bool"}]}, "primaryType": "EIP712Domain"}`,
+		"invalid array":       `{"types": {"EIP712Domain": [{"name": "a", "type": "bool[0]"}]}, "primaryType": "EIP712Domain"}`,
+		"atomic type name":    `{"types": {"EIP712Domain": [], "uint8": []}, "primaryType": "EIP712Domain"}`,
+	}
+	for name, input := range tests {
+		_, err := Parse([]byte(input))
+		assert.NotNil(t, err, name)
+	}
+}
+
+func TestMembers(t *testing.T) {
+	td := loadMail(t)
+	td.Message["extra"] = "foo"
+	_, err := td.Hash()
+	assert.NotNil(t, err)
+	assert.True(t, strings.Contains(err.Error(), "unknown member extra"))
+
+	td = loadMail(t)
+	delete(td.Message["to"].(map[string]interface{}), "wallet")
+	_, err = td.Hash()
+	assert.NotNil(t, err)
+	assert.True(t, strings.Contains(err.Error(), "missing member wallet"))
+}
+
+func TestFormat(t *testing.T) {
+	td := loadMail(t)
+	fields, err := td.Format(td.PrimaryType, td.Message)
+	assert.Nil(t, err)
+	assert.Equal(t, []Field{
+		{Name: "from", Type: "Person", Fields: []Field{
+			{Name: "name", Type: "string", Value: `"Cow"`},
+			{Name: "wallet", Type: "address", Value: "0xCD2a3d9F938E13CD947Ec05AbC7FE734Df8DD826"},
+		}},
+		{Name: "to", Type: "Person", Fields: []Field{
+			{Name: "name", Type: "string", Value: `"Bob"`},
+			{Name: "wallet", Type: "address", Value: "0xbBbBBBBbbBBBbbbBbbBbbbbBBbBbbbbBbBbbBBbB"},
+		}},
+		{Name: "contents", Type: "string", Value: `"Hello, Bob!"`},
+	}, fields)
+
+	domain, err := td.Format(DomainType, td.Domain)
+	assert.Nil(t, err)
+	assert.Equal(t, Field{Name: "chainId", Type: "uint256", Value: "1"}, domain[2])
+}
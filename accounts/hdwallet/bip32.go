@@ -0,0 +1,100 @@
+package hdwallet
+
+import (
+	"crypto/ecdsa"
+	"crypto/hmac"
+	"crypto/sha512"
+	"errors"
+	"math/big"
+
+	"github.com/DSiSc/crypto-suite/crypto"
+	"github.com/DSiSc/wallet/accounts"
+	"github.com/DSiSc/wallet/common/math"
+)
+
+// hardenedKeyStart is the index of the first hardened child key.
+const hardenedKeyStart = 0x80000000
+
+// masterKeySalt is the HMAC key used to derive the master node from a seed.
+var masterKeySalt = []byte("Bitcoin seed")
+
+// errInvalidChild is returned in the (astronomically unlikely) case that a
+// derived key is invalid, in which case BIP-32 mandates skipping the index.
+var errInvalidChild = errors.New("derived key invalid, use the next index")
+
+// extendedKey is a BIP-32 extended private key: a secp256k1 scalar together
+// with the chain code needed to derive its children.
+type extendedKey struct {
+	key       *big.Int
+	chainCode []byte
+}
+
+// newMasterKey derives the root node of the key tree from a seed.
+func newMasterKey(seed []byte) (*extendedKey, error) {
+	mac := hmac.New(sha512.New, masterKeySalt)
+	mac.Write(seed)
+	sum := mac.Sum(nil)
+
+	key := new(big.Int).SetBytes(sum[:32])
+	if key.Sign() == 0 || key.Cmp(crypto.S256().Params().N) >= 0 {
+		return nil, errInvalidChild
+	}
+	return &extendedKey{key: key, chainCode: sum[32:]}, nil
+}
+
+// child derives the private child key with the given index. Indices at or
+// above hardenedKeyStart produce hardened children.
+func (k *extendedKey) child(index uint32) (*extendedKey, error) {
+	data := make([]byte, 0, 37)
+	if index >= hardenedKeyStart {
+		data = append(data, 0x00)
+		data = append(data, math.PaddedBigBytes(k.key, 32)...)
+	} else {
+		data = append(data, k.compressedPubkey()...)
+	}
+	data = append(data, byte(index>>24), byte(index>>16), byte(index>>8), byte(index))
+
+	mac := hmac.New(sha512.New, k.chainCode)
+	mac.Write(data)
+	sum := mac.Sum(nil)
+
+	n := crypto.S256().Params().N
+	tweak := new(big.Int).SetBytes(sum[:32])
+	if tweak.Cmp(n) >= 0 {
+		return nil, errInvalidChild
+	}
+	key := tweak.Add(tweak, k.key)
+	key.Mod(key, n)
+	if key.Sign() == 0 {
+		return nil, errInvalidChild
+	}
+	return &extendedKey{key: key, chainCode: sum[32:]}, nil
+}
+
+// compressedPubkey returns the SEC1 compressed public key of the node.
+func (k *extendedKey) compressedPubkey() []byte {
+	x, y := crypto.S256().ScalarBaseMult(math.PaddedBigBytes(k.key, 32))
+	pub := make([]byte, 0, 33)
+	pub = append(pub, byte(0x02+y.Bit(0)))
+	return append(pub, math.PaddedBigBytes(x, 32)...)
+}
+
+// privateKey converts the node into a secp256k1 private key.
+func (k *extendedKey) privateKey() (*ecdsa.PrivateKey, error) {
+	return crypto.ToECDSA(math.PaddedBigBytes(k.key, 32))
+}
+
+// deriveKey walks the key tree rooted at seed along path and returns the
+// private key at its end.
+func deriveKey(seed []byte, path accounts.DerivationPath) (*ecdsa.PrivateKey, error) {
+	node, err := newMasterKey(seed)
+	if err != nil {
+		return nil, err
+	}
+	for _, index := range path {
+		if node, err = node.child(index); err != nil {
+			return nil, err
+		}
+	}
+	return node.privateKey()
+}
@@ -0,0 +1,61 @@
+package hdwallet
+
+import (
+	"encoding/hex"
+	"testing"
+
+	"github.com/DSiSc/crypto-suite/crypto"
+	"github.com/DSiSc/wallet/accounts"
+	"github.com/DSiSc/wallet/common"
+)
+
+// Tests key derivation against test vector 1 of the BIP-32 specification.
+func TestDeriveKeyVectors(t *testing.T) {
+	seed, _ := hex.DecodeString("000102030405060708090a0b0c0d0e0f")
+
+	tests := []struct {
+		path string
+		key  string
+	}{
+		{"m/0'", "edb2e14f9ee77d26dd93b4ecede8d16ed408ce149b6cd80b0715a2d911a0afea"},
+		{"m/0'/1", "3c6cb8d0f6a264c91ea8b5030fadaa8e538b020f0a387421a12de9319dc93368"},
+		{"m/0'/1/2'", "cbce0d719ecf7431d88e6a89fa1483e02e35092af60c042b1df2ff59fa424dca"},
+	}
+	master, err := newMasterKey(seed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if have := hex.EncodeToString(master.key.Bytes()); have != "e8f32e723decf4051aefac8e2c93c9c5b214313817cdb01a1494b917c8436b35" {
+		t.Errorf("master key mismatch: have %s", have)
+	}
+	for i, test := range tests {
+		path, err := accounts.ParseDerivationPath(test.path)
+		if err != nil {
+			t.Fatalf("test %d: invalid path: %v", i, err)
+		}
+		key, err := deriveKey(seed, path)
+		if err != nil {
+			t.Fatalf("test %d: derivation failed: %v", i, err)
+		}
+		if have := hex.EncodeToString(crypto.FromECDSA(key)); have != test.key {
+			t.Errorf("test %d: key mismatch: have %s, want %s", i, have, test.key)
+		}
+	}
+}
+
+// Tests that the default Ethereum path derives the well known first account of
+// the all "abandon" mnemonic.
+func TestDeriveDefaultAccount(t *testing.T) {
+	seed, err := NewSeed("abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon about", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	key, err := deriveKey(seed, accounts.DefaultBaseDerivationPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := common.HexToAddress("0x9858EfFD232B4033E47d90003D41EC34EcaEda94")
+	if have := common.Address(crypto.PubkeyToAddress(key.PublicKey)); have != want {
+		t.Errorf("address mismatch: have %x, want %x", have, want)
+	}
+}
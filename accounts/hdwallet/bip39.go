@@ -0,0 +1,133 @@
+package hdwallet
+
+import (
+	crand "crypto/rand"
+	"crypto/sha256"
+	"crypto/sha512"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"strings"
+
+	"golang.org/x/crypto/pbkdf2"
+)
+
+var (
+	// ErrInvalidMnemonic is returned if a mnemonic contains unknown words, has an
+	// unsupported length or fails its checksum.
+	ErrInvalidMnemonic = errors.New("invalid mnemonic")
+
+	// ErrEntropyLength is returned if the requested entropy size is not one of
+	// the sizes allowed by BIP-39.
+	ErrEntropyLength = errors.New("entropy length must be [128, 256] and a multiple of 32")
+)
+
+// DefaultEntropyBits is the entropy size of newly generated mnemonics, resulting
+// in a 24 word sentence.
+const DefaultEntropyBits = 256
+
+// seedIterations is the number of PBKDF2 rounds used to stretch a mnemonic into
+// a seed as mandated by BIP-39.
+const seedIterations = 2048
+
+// NewMnemonic generates a fresh BIP-39 mnemonic sentence backed by the given
+// amount of entropy bits read from the system's secure random source.
+func NewMnemonic(bits int) (string, error) {
+	if err := validateEntropyBits(bits); err != nil {
+		return "", err
+	}
+	entropy := make([]byte, bits/8)
+	if _, err := io.ReadFull(crand.Reader, entropy); err != nil {
+		return "", err
+	}
+	return NewMnemonicFromEntropy(entropy)
+}
+
+// NewMnemonicFromEntropy encodes the given entropy into a BIP-39 mnemonic using
+// the English word list.
+func NewMnemonicFromEntropy(entropy []byte) (string, error) {
+	bits := len(entropy) * 8
+	if err := validateEntropyBits(bits); err != nil {
+		return "", err
+	}
+	// Append the checksum bits (first ENT/32 bits of the SHA256 hash)
+	checksumBits := uint(bits / 32)
+	hash := sha256.Sum256(entropy)
+
+	data := new(big.Int).SetBytes(entropy)
+	data.Lsh(data, checksumBits)
+	data.Or(data, big.NewInt(int64(hash[0]>>(8-checksumBits))))
+
+	// Slice the data up into 11 bit groups, each selecting a word
+	count := (bits + int(checksumBits)) / 11
+	words := make([]string, count)
+
+	mask := big.NewInt(2047)
+	for i := count - 1; i >= 0; i-- {
+		index := new(big.Int).And(data, mask)
+		words[i] = englishWords[index.Int64()]
+		data.Rsh(data, 11)
+	}
+	return strings.Join(words, " "), nil
+}
+
+// MnemonicToEntropy decodes a BIP-39 mnemonic back into its entropy, verifying
+// the embedded checksum.
+func MnemonicToEntropy(mnemonic string) ([]byte, error) {
+	words := strings.Fields(mnemonic)
+	if len(words)%3 != 0 || len(words) < 12 || len(words) > 24 {
+		return nil, ErrInvalidMnemonic
+	}
+	data := new(big.Int)
+	for _, word := range words {
+		index, ok := englishIndex[word]
+		if !ok {
+			return nil, fmt.Errorf("%v: unknown word %q", ErrInvalidMnemonic, word)
+		}
+		data.Lsh(data, 11)
+		data.Or(data, big.NewInt(int64(index)))
+	}
+	checksumBits := uint(len(words) / 3)
+	bits := len(words)*11 - int(checksumBits)
+
+	checksum := new(big.Int).And(data, big.NewInt(int64(1)<<checksumBits-1))
+	data.Rsh(data, checksumBits)
+
+	entropy := make([]byte, bits/8)
+	raw := data.Bytes()
+	copy(entropy[len(entropy)-len(raw):], raw)
+
+	hash := sha256.Sum256(entropy)
+	if uint64(hash[0]>>(8-checksumBits)) != checksum.Uint64() {
+		return nil, fmt.Errorf("%v: checksum mismatch", ErrInvalidMnemonic)
+	}
+	return entropy, nil
+}
+
+// ValidateMnemonic reports whether the mnemonic is a well formed BIP-39 sentence.
+func ValidateMnemonic(mnemonic string) bool {
+	_, err := MnemonicToEntropy(mnemonic)
+	return err == nil
+}
+
+// NewSeed stretches a mnemonic and an optional passphrase into the 64 byte seed
+// that roots the BIP-32 key tree. The mnemonic is validated before use.
+//
+// Note, BIP-39 requires NFKD normalisation of both inputs. Since the English word
+// list is pure ASCII this is a no-op for the mnemonic, but passphrases containing
+// composed unicode characters must be supplied already normalised.
+func NewSeed(mnemonic string, passphrase string) ([]byte, error) {
+	if !ValidateMnemonic(mnemonic) {
+		return nil, ErrInvalidMnemonic
+	}
+	sentence := strings.Join(strings.Fields(mnemonic), " ")
+	return pbkdf2.Key([]byte(sentence), []byte("mnemonic"+passphrase), seedIterations, 64, sha512.New), nil
+}
+
+func validateEntropyBits(bits int) error {
+	if bits < 128 || bits > 256 || bits%32 != 0 {
+		return ErrEntropyLength
+	}
+	return nil
+}
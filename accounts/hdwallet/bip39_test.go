@@ -0,0 +1,84 @@
+package hdwallet
+
+import (
+	"encoding/hex"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// Test vectors from https://github.com/trezor/python-mnemonic/blob/master/vectors.json
+var bip39Tests = []struct {
+	entropy  string
+	mnemonic string
+	seed     string
+}{
+	{
+		"00000000000000000000000000000000",
+		"abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon about",
+		"c55257c360c07c72029aebc1b53c05ed0362ada38ead3e3e9efa3708e53495531f09a6987599d18264c1e1c92f2cf141630c7a3c4ab7c81b2f001698e7463b04",
+	},
+	{
+		"7f7f7f7f7f7f7f7f7f7f7f7f7f7f7f7f",
+		"legal winner thank year wave sausage worth useful legal winner thank yellow",
+		"2e8905819b8723fe2c1d161860e5ee1830318dbf49a83bd451cfb8440c28bd6fa457fe1296106559a3c80937a1c1069be3a3a5bd381ee6260e8d9739fce1f607",
+	},
+	{
+		"ffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffff",
+		"zoo zoo zoo zoo zoo zoo zoo zoo zoo zoo zoo zoo zoo zoo zoo zoo zoo zoo zoo zoo zoo zoo zoo vote",
+		"dd48c104698c30cfe2b6142103248622fb7bb0ff692eebb00089b32d22484e1613912f0a5b694407be899ffd31ed3992c456cdf60f5d4564b8ba3f05a69890ad",
+	},
+}
+
+func TestMnemonicVectors(t *testing.T) {
+	for i, test := range bip39Tests {
+		entropy, _ := hex.DecodeString(test.entropy)
+
+		mnemonic, err := NewMnemonicFromEntropy(entropy)
+		if err != nil {
+			t.Fatalf("test %d: failed to encode entropy: %v", i, err)
+		}
+		if mnemonic != test.mnemonic {
+			t.Errorf("test %d: mnemonic mismatch: have %q, want %q", i, mnemonic, test.mnemonic)
+		}
+		decoded, err := MnemonicToEntropy(test.mnemonic)
+		if err != nil {
+			t.Fatalf("test %d: failed to decode mnemonic: %v", i, err)
+		}
+		if hex.EncodeToString(decoded) != test.entropy {
+			t.Errorf("test %d: entropy mismatch: have %x, want %s", i, decoded, test.entropy)
+		}
+		seed, err := NewSeed(test.mnemonic, "TREZOR")
+		if err != nil {
+			t.Fatalf("test %d: failed to create seed: %v", i, err)
+		}
+		if hex.EncodeToString(seed) != test.seed {
+			t.Errorf("test %d: seed mismatch: have %x, want %s", i, seed, test.seed)
+		}
+	}
+}
+
+func TestNewMnemonic(t *testing.T) {
+	for _, bits := range []int{128, 160, 192, 224, 256} {
+		mnemonic, err := NewMnemonic(bits)
+		assert.Nil(t, err)
+		assert.Equal(t, bits*3/32, len(strings.Fields(mnemonic)))
+		assert.True(t, ValidateMnemonic(mnemonic))
+	}
+	_, err := NewMnemonic(100)
+	assert.Equal(t, ErrEntropyLength, err)
+}
+
+func TestInvalidMnemonic(t *testing.T) {
+	// Bad checksum, unknown word and wrong length
+	for _, mnemonic := range []string{
+		"abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon",
+		"abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon wallet",
+		"abandon abandon abandon",
+	} {
+		assert.False(t, ValidateMnemonic(mnemonic), mnemonic)
+		_, err := NewSeed(mnemonic, "")
+		assert.Equal(t, ErrInvalidMnemonic, err)
+	}
+}
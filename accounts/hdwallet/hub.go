@@ -0,0 +1,291 @@
+// Package hdwallet implements hierarchical deterministic wallets backed by a
+// BIP-39 mnemonic, deriving secp256k1 accounts along BIP-32/BIP-44 paths.
+//
+// Only the seed is persisted, encrypted with the same scrypt/AES-128-CTR scheme
+// used for keystore key files. Every derived account can be rebuilt from the
+// mnemonic alone, so a single backup covers all of them.
+package hdwallet
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/DSiSc/crypto-suite/crypto"
+	"github.com/DSiSc/wallet/accounts"
+	"github.com/DSiSc/wallet/accounts/keystore"
+	"github.com/DSiSc/wallet/common"
+	"github.com/DSiSc/wallet/event"
+	"github.com/pborman/uuid"
+)
+
+// Scheme is the protocol scheme prefixing wallet and account URLs.
+const Scheme = "hdwallet"
+
+// HubType is the reflect type of a HD wallet backend.
+var HubType = reflect.TypeOf(&Hub{})
+
+// Maximum time between wallet refreshes while there are subscribers.
+const refreshCycle = 3 * time.Second
+
+// ErrWalletExists is returned when restoring a mnemonic that already backs one
+// of the wallets known to the hub.
+var ErrWalletExists = errors.New("wallet already exists")
+
+// Hub manages a directory of encrypted HD wallet seeds.
+type Hub struct {
+	dir     string // Directory holding the encrypted seed files
+	scryptN int    // Scrypt N parameter used to encrypt new seeds
+	scryptP int    // Scrypt P parameter used to encrypt new seeds
+
+	wallets     []accounts.Wallet       // Wallets loaded from the directory, sorted by URL
+	updateFeed  event.Feed              // Event feed to notify wallet additions/removals
+	updateScope event.SubscriptionScope // Subscription scope tracking current live listeners
+	updating    bool                    // Whether the event notification loop is running
+
+	mu sync.RWMutex
+}
+
+// NewHub creates a HD wallet backend for the given directory. The directory is
+// only created once the first wallet is stored.
+func NewHub(dir string, scryptN, scryptP int) *Hub {
+	dir, _ = filepath.Abs(dir)
+	return &Hub{dir: dir, scryptN: scryptN, scryptP: scryptP}
+}
+
+// Wallets implements accounts.Backend, returning all the HD wallets stored in
+// the hub's directory.
+func (hub *Hub) Wallets() []accounts.Wallet {
+	// Make sure the list of wallets is in sync with the directory
+	hub.refreshWallets()
+
+	hub.mu.RLock()
+	defer hub.mu.RUnlock()
+
+	cpy := make([]accounts.Wallet, len(hub.wallets))
+	copy(cpy, hub.wallets)
+	return cpy
+}
+
+// refreshWallets rescans the wallet directory, loading newly added seed files
+// and dropping the ones that disappeared. Already loaded wallets are kept, so
+// their open state survives a refresh.
+func (hub *Hub) refreshWallets() {
+	files, err := ioutil.ReadDir(hub.dir)
+	if err != nil {
+		return
+	}
+	hub.mu.Lock()
+
+	known := make(map[string]accounts.Wallet, len(hub.wallets))
+	for _, wallet := range hub.wallets {
+		known[wallet.URL().Path] = wallet
+	}
+	var (
+		wallets = make([]accounts.Wallet, 0, len(files))
+		events  []accounts.WalletEvent
+	)
+	for _, fi := range files {
+		// Skip editor backups, hidden files and anything that isn't a regular file
+		if strings.HasSuffix(fi.Name(), "~") || strings.HasPrefix(fi.Name(), ".") || !fi.Mode().IsRegular() {
+			continue
+		}
+		path := filepath.Join(hub.dir, fi.Name())
+		if wallet, ok := known[path]; ok {
+			wallets = append(wallets, wallet)
+			delete(known, path)
+			continue
+		}
+		wallet, err := loadWallet(hub, path)
+		if err != nil {
+			continue
+		}
+		wallets = append(wallets, wallet)
+		events = append(events, accounts.WalletEvent{Wallet: wallet, Kind: accounts.WalletArrived})
+	}
+	for _, wallet := range known {
+		events = append(events, accounts.WalletEvent{Wallet: wallet, Kind: accounts.WalletDropped})
+	}
+	sort.Slice(wallets, func(i, j int) bool { return wallets[i].URL().Cmp(wallets[j].URL()) < 0 })
+	hub.wallets = wallets
+	hub.mu.Unlock()
+
+	// Fire all wallet events and return
+	for _, event := range events {
+		hub.updateFeed.Send(event)
+	}
+}
+
+// Subscribe implements accounts.Backend, creating an async subscription to
+// receive notifications on the addition or removal of HD wallets.
+func (hub *Hub) Subscribe(sink chan<- accounts.WalletEvent) event.Subscription {
+	// We need the mutex to reliably start/stop the update loop
+	hub.mu.Lock()
+	defer hub.mu.Unlock()
+
+	// Subscribe the caller and track the subscriber count
+	sub := hub.updateScope.Track(hub.updateFeed.Subscribe(sink))
+
+	// Subscribers require an active notification loop, start it
+	if !hub.updating {
+		hub.updating = true
+		go hub.updater()
+	}
+	return sub
+}
+
+// updater periodically rescans the wallet directory while there are live
+// subscribers, firing wallet addition/removal events.
+func (hub *Hub) updater() {
+	for {
+		time.Sleep(refreshCycle)
+
+		// Run the wallet refresher
+		hub.refreshWallets()
+
+		// If all our subscribers left, stop the updater
+		hub.mu.Lock()
+		if hub.updateScope.Count() == 0 {
+			hub.updating = false
+			hub.mu.Unlock()
+			return
+		}
+		hub.mu.Unlock()
+	}
+}
+
+// NewWallet generates a fresh mnemonic, stores the resulting seed encrypted with
+// auth and returns both the mnemonic and the new wallet. The mnemonic is the only
+// backup of the wallet and must be shown to the user.
+//
+// The passphrase is the optional BIP-39 passphrase mixed into the seed; it is
+// distinct from auth, which only protects the seed file on disk.
+func (hub *Hub) NewWallet(passphrase, auth string) (string, *Wallet, error) {
+	mnemonic, err := NewMnemonic(DefaultEntropyBits)
+	if err != nil {
+		return "", nil, err
+	}
+	wallet, err := hub.Restore(mnemonic, passphrase, auth)
+	if err != nil {
+		return "", nil, err
+	}
+	return mnemonic, wallet, nil
+}
+
+// Restore rebuilds a wallet from an existing mnemonic and optional BIP-39
+// passphrase, storing the seed encrypted with auth. The account at the default
+// base derivation path is pinned automatically.
+func (hub *Hub) Restore(mnemonic, passphrase, auth string) (*Wallet, error) {
+	seed, err := NewSeed(mnemonic, passphrase)
+	if err != nil {
+		return nil, err
+	}
+	defer zeroBytes(seed)
+
+	key, err := deriveKey(seed, accounts.DefaultBaseDerivationPath)
+	if err != nil {
+		return nil, err
+	}
+	address := common.Address(crypto.PubkeyToAddress(key.PublicKey))
+	zeroKey(key)
+
+	for _, wallet := range hub.Wallets() {
+		if wallet.Contains(accounts.Account{Address: address}) {
+			return nil, ErrWalletExists
+		}
+	}
+	cryptoStruct, err := keystore.EncryptDataV3(seed, []byte(auth), hub.scryptN, hub.scryptP)
+	if err != nil {
+		return nil, err
+	}
+	wallet := &Wallet{
+		hub:    hub,
+		url:    accounts.URL{Scheme: Scheme, Path: filepath.Join(hub.dir, walletFileName(address))},
+		id:     uuid.NewRandom().String(),
+		crypto: cryptoStruct,
+		paths:  make(map[common.Address]accounts.DerivationPath),
+	}
+	wallet.pin(address, accounts.DefaultBaseDerivationPath)
+
+	if err := wallet.store(); err != nil {
+		return nil, err
+	}
+	// Track the new wallet unless a concurrent refresh already picked it up
+	hub.mu.Lock()
+	for _, known := range hub.wallets {
+		if known.URL() == wallet.url {
+			hub.mu.Unlock()
+			return known.(*Wallet), nil
+		}
+	}
+	hub.wallets = append(hub.wallets, wallet)
+	sort.Slice(hub.wallets, func(i, j int) bool { return hub.wallets[i].URL().Cmp(hub.wallets[j].URL()) < 0 })
+	hub.mu.Unlock()
+
+	hub.updateFeed.Send(accounts.WalletEvent{Wallet: wallet, Kind: accounts.WalletArrived})
+	return wallet, nil
+}
+
+// walletFileName implements the naming convention for seed files:
+// UTC--<created_at UTC>--<address hex of the default account>
+func walletFileName(addr common.Address) string {
+	ts := time.Now().UTC().Format("2006-01-02T15-04-05.000000000Z")
+	return fmt.Sprintf("UTC--%s--%s", ts, hex.EncodeToString(addr[:]))
+}
+
+// writeWalletFile atomically replaces file with content, creating the wallet
+// directory if needed. TempFile assigns mode 0600.
+func writeWalletFile(file string, content []byte) error {
+	if err := os.MkdirAll(filepath.Dir(file), 0700); err != nil {
+		return err
+	}
+	f, err := ioutil.TempFile(filepath.Dir(file), "."+filepath.Base(file)+".tmp")
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(content); err != nil {
+		f.Close()
+		os.Remove(f.Name())
+		return err
+	}
+	f.Close()
+	return os.Rename(f.Name(), file)
+}
+
+// loadWallet reads a seed file from disk without decrypting it.
+func loadWallet(hub *Hub, path string) (*Wallet, error) {
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var stored walletJSON
+	if err := json.Unmarshal(content, &stored); err != nil {
+		return nil, err
+	}
+	if stored.Version != walletVersion {
+		return nil, fmt.Errorf("unsupported wallet version: %d", stored.Version)
+	}
+	wallet := &Wallet{
+		hub:    hub,
+		url:    accounts.URL{Scheme: Scheme, Path: path},
+		id:     stored.Id,
+		crypto: stored.Crypto,
+		paths:  make(map[common.Address]accounts.DerivationPath),
+	}
+	for _, pinned := range stored.Accounts {
+		if !common.IsHexAddress(pinned.Address) {
+			return nil, fmt.Errorf("invalid pinned address: %s", pinned.Address)
+		}
+		wallet.pin(common.HexToAddress(pinned.Address), pinned.Path)
+	}
+	return wallet, nil
+}
@@ -0,0 +1,275 @@
+package hdwallet
+
+import (
+	"crypto/ecdsa"
+	"encoding/hex"
+	"encoding/json"
+	"math/big"
+	"sync"
+
+	"github.com/DSiSc/craft/types"
+	"github.com/DSiSc/crypto-suite/crypto"
+	"github.com/DSiSc/wallet/accounts"
+	"github.com/DSiSc/wallet/accounts/keystore"
+	"github.com/DSiSc/wallet/common"
+	local "github.com/DSiSc/wallet/core/types"
+)
+
+// walletVersion is the version of the seed file format.
+const walletVersion = 1
+
+type walletJSON struct {
+	Id       string              `json:"id"`
+	Version  int                 `json:"version"`
+	Crypto   keystore.CryptoJSON `json:"crypto"`
+	Accounts []pinnedJSON        `json:"accounts"`
+}
+
+type pinnedJSON struct {
+	Address string                  `json:"address"`
+	Path    accounts.DerivationPath `json:"path"`
+}
+
+// Wallet implements accounts.Wallet for a single BIP-39 seed. The seed is only
+// decrypted while the wallet is open; signing with a closed wallet requires the
+// passphrase based methods.
+type Wallet struct {
+	hub    *Hub                // Hub the wallet originates from
+	url    accounts.URL        // Location of the encrypted seed file
+	id     string              // Random identifier stored alongside the seed
+	crypto keystore.CryptoJSON // Encrypted seed
+
+	accounts []accounts.Account                         // Pinned accounts, in derivation order
+	paths    map[common.Address]accounts.DerivationPath // Derivation paths of the pinned accounts
+
+	seed []byte // Decrypted seed, nil while the wallet is closed
+
+	mu sync.RWMutex
+}
+
+// URL implements accounts.Wallet, returning the location of the seed file.
+func (w *Wallet) URL() accounts.URL {
+	return w.url
+}
+
+// Status implements accounts.Wallet, returning whether the seed of the wallet is
+// currently decrypted or not.
+func (w *Wallet) Status() (string, error) {
+	w.mu.RLock()
+	defer w.mu.RUnlock()
+
+	if w.seed != nil {
+		return "Opened", nil
+	}
+	return "Closed", nil
+}
+
+// Open implements accounts.Wallet, decrypting the seed with the passphrase so
+// that accounts can be derived and used for signing.
+func (w *Wallet) Open(passphrase string) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.seed != nil {
+		return accounts.ErrWalletAlreadyOpen
+	}
+	seed, err := keystore.DecryptDataV3(w.crypto, passphrase)
+	if err != nil {
+		return err
+	}
+	w.seed = seed
+	return nil
+}
+
+// Close implements accounts.Wallet, wiping the decrypted seed from memory.
+func (w *Wallet) Close() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.seed != nil {
+		zeroBytes(w.seed)
+		w.seed = nil
+	}
+	return nil
+}
+
+// Accounts implements accounts.Wallet, returning the accounts pinned during
+// derivation. The list is available even while the wallet is closed.
+func (w *Wallet) Accounts() []accounts.Account {
+	w.mu.RLock()
+	defer w.mu.RUnlock()
+
+	cpy := make([]accounts.Account, len(w.accounts))
+	copy(cpy, w.accounts)
+	return cpy
+}
+
+// Contains implements accounts.Wallet, returning whether a particular account is
+// or is not pinned in this wallet instance.
+func (w *Wallet) Contains(account accounts.Account) bool {
+	w.mu.RLock()
+	defer w.mu.RUnlock()
+
+	_, exists := w.paths[account.Address]
+	return exists && (account.URL == (accounts.URL{}) || account.URL == w.url)
+}
+
+// Derive derives the account at the given BIP-32 path. If pin is set, the
+// account is added to the list of tracked accounts and persisted, so it is
+// listed the next time the wallet is loaded. The wallet must be open.
+func (w *Wallet) Derive(path accounts.DerivationPath, pin bool) (accounts.Account, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.seed == nil {
+		return accounts.Account{}, accounts.ErrWalletClosed
+	}
+	key, err := deriveKey(w.seed, path)
+	if err != nil {
+		return accounts.Account{}, err
+	}
+	address := common.Address(crypto.PubkeyToAddress(key.PublicKey))
+	zeroKey(key)
+
+	account := accounts.Account{Address: address, URL: w.url}
+	if !pin {
+		return account, nil
+	}
+	if _, exists := w.paths[address]; !exists {
+		w.pin(address, path)
+		if err := w.store(); err != nil {
+			return accounts.Account{}, err
+		}
+	}
+	return account, nil
+}
+
+// SignHash implements accounts.Wallet, signing the hash with the key derived for
+// the requested account. The wallet must be open.
+func (w *Wallet) SignHash(account accounts.Account, hash []byte) ([]byte, error) {
+	key, err := w.openKey(account)
+	if err != nil {
+		return nil, err
+	}
+	defer zeroKey(key)
+	return crypto.Sign(hash, key)
+}
+
+// SignTx implements accounts.Wallet, signing the transaction with the key derived
+// for the requested account. The wallet must be open.
+func (w *Wallet) SignTx(account accounts.Account, tx *types.Transaction, chainID *big.Int) (*types.Transaction, error) {
+	key, err := w.openKey(account)
+	if err != nil {
+		return nil, err
+	}
+	defer zeroKey(key)
+	return signTx(tx, chainID, key)
+}
+
+// SignHashWithPassphrase implements accounts.Wallet, decrypting the seed with the
+// passphrase for the duration of the signature only.
+func (w *Wallet) SignHashWithPassphrase(account accounts.Account, passphrase string, hash []byte) ([]byte, error) {
+	key, err := w.decryptKey(account, passphrase)
+	if err != nil {
+		return nil, err
+	}
+	defer zeroKey(key)
+	return crypto.Sign(hash, key)
+}
+
+// SignTxWithPassphrase implements accounts.Wallet, decrypting the seed with the
+// passphrase for the duration of the signature only.
+func (w *Wallet) SignTxWithPassphrase(account accounts.Account, passphrase string, tx *types.Transaction, chainID *big.Int) (*types.Transaction, error) {
+	key, err := w.decryptKey(account, passphrase)
+	if err != nil {
+		return nil, err
+	}
+	defer zeroKey(key)
+	return signTx(tx, chainID, key)
+}
+
+// openKey derives the private key of a pinned account from the open seed.
+func (w *Wallet) openKey(account accounts.Account) (*ecdsa.PrivateKey, error) {
+	w.mu.RLock()
+	defer w.mu.RUnlock()
+
+	path, ok := w.paths[account.Address]
+	if !ok {
+		return nil, accounts.ErrUnknownAccount
+	}
+	if w.seed == nil {
+		return nil, accounts.ErrWalletClosed
+	}
+	return deriveKey(w.seed, path)
+}
+
+// decryptKey derives the private key of a pinned account from the seed decrypted
+// with the given passphrase.
+func (w *Wallet) decryptKey(account accounts.Account, passphrase string) (*ecdsa.PrivateKey, error) {
+	w.mu.RLock()
+	path, ok := w.paths[account.Address]
+	cryptoStruct := w.crypto
+	w.mu.RUnlock()
+
+	if !ok {
+		return nil, accounts.ErrUnknownAccount
+	}
+	seed, err := keystore.DecryptDataV3(cryptoStruct, passphrase)
+	if err != nil {
+		return nil, err
+	}
+	defer zeroBytes(seed)
+	return deriveKey(seed, path)
+}
+
+// pin adds an account to the tracked list. Callers must hold w.mu or have
+// exclusive access to the wallet.
+func (w *Wallet) pin(address common.Address, path accounts.DerivationPath) {
+	w.accounts = append(w.accounts, accounts.Account{Address: address, URL: w.url})
+	w.paths[address] = path
+}
+
+// store persists the encrypted seed and the pinned accounts. Callers must hold
+// w.mu or have exclusive access to the wallet.
+func (w *Wallet) store() error {
+	stored := walletJSON{
+		Id:      w.id,
+		Version: walletVersion,
+		Crypto:  w.crypto,
+	}
+	for _, account := range w.accounts {
+		stored.Accounts = append(stored.Accounts, pinnedJSON{
+			Address: hex.EncodeToString(account.Address[:]),
+			Path:    w.paths[account.Address],
+		})
+	}
+	content, err := json.Marshal(stored)
+	if err != nil {
+		return err
+	}
+	return writeWalletFile(w.url.Path, content)
+}
+
+// signTx signs the transaction with EIP155 if a chain ID is given, or with the
+// homestead rules otherwise.
+func signTx(tx *types.Transaction, chainID *big.Int, key *ecdsa.PrivateKey) (*types.Transaction, error) {
+	if chainID != nil {
+		return local.SignTx(tx, local.NewEIP155Signer(chainID), key)
+	}
+	return local.SignTx(tx, local.HomesteadSigner{}, key)
+}
+
+// zeroKey zeroes a private key in memory.
+func zeroKey(k *ecdsa.PrivateKey) {
+	b := k.D.Bits()
+	for i := range b {
+		b[i] = 0
+	}
+}
+
+// zeroBytes zeroes a byte slice in memory.
+func zeroBytes(b []byte) {
+	for i := range b {
+		b[i] = 0
+	}
+}
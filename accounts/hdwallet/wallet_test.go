@@ -0,0 +1,194 @@
+package hdwallet
+
+import (
+	"io/ioutil"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/DSiSc/craft/types"
+	"github.com/DSiSc/wallet/accounts"
+	"github.com/DSiSc/wallet/accounts/keystore"
+	"github.com/DSiSc/wallet/common"
+	local "github.com/DSiSc/wallet/core/types"
+	"github.com/stretchr/testify/assert"
+)
+
+const (
+	veryLightScryptN = 2
+	veryLightScryptP = 1
+
+	testMnemonic = "abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon about"
+)
+
+func tmpHub(t *testing.T) (string, *Hub) {
+	dir, err := ioutil.TempDir("", "hdwallet-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return dir, NewHub(filepath.Join(dir, "hdwallet"), veryLightScryptN, veryLightScryptP)
+}
+
+func TestHubRestore(t *testing.T) {
+	dir, hub := tmpHub(t)
+	defer os.RemoveAll(dir)
+
+	assert.Equal(t, 0, len(hub.Wallets()))
+
+	wallet, err := hub.Restore(testMnemonic, "", "foo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := common.HexToAddress("0x9858EfFD232B4033E47d90003D41EC34EcaEda94")
+	accs := wallet.Accounts()
+	assert.Equal(t, 1, len(accs))
+	assert.Equal(t, want, accs[0].Address)
+	assert.True(t, wallet.Contains(accounts.Account{Address: want}))
+
+	stat, err := os.Stat(wallet.URL().Path)
+	if err != nil {
+		t.Fatalf("wallet file %s doesn't exist (%v)", wallet.URL(), err)
+	}
+	assert.Equal(t, os.FileMode(0600), stat.Mode())
+
+	// Restoring the same mnemonic twice must be rejected
+	_, err = hub.Restore(testMnemonic, "", "bar")
+	assert.Equal(t, ErrWalletExists, err)
+
+	// A different BIP-39 passphrase yields a different wallet
+	_, err = hub.Restore(testMnemonic, "TREZOR", "bar")
+	assert.Nil(t, err)
+	assert.Equal(t, 2, len(hub.Wallets()))
+}
+
+func TestHubNewWallet(t *testing.T) {
+	dir, hub := tmpHub(t)
+	defer os.RemoveAll(dir)
+
+	mnemonic, wallet, err := hub.NewWallet("", "foo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.True(t, ValidateMnemonic(mnemonic))
+	assert.Equal(t, 1, len(wallet.Accounts()))
+
+	// The mnemonic must be enough to recover the wallet elsewhere
+	dir2, hub2 := tmpHub(t)
+	defer os.RemoveAll(dir2)
+
+	restored, err := hub2.Restore(mnemonic, "", "bar")
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, wallet.Accounts()[0].Address, restored.Accounts()[0].Address)
+}
+
+func TestWalletOpenDerive(t *testing.T) {
+	dir, hub := tmpHub(t)
+	defer os.RemoveAll(dir)
+
+	wallet, err := hub.Restore(testMnemonic, "", "foo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	path, _ := accounts.ParseDerivationPath("m/44'/60'/0'/0/1")
+
+	_, err = wallet.Derive(path, true)
+	assert.Equal(t, accounts.ErrWalletClosed, err)
+
+	assert.Equal(t, keystore.ErrDecrypt, wallet.Open("bar"))
+	assert.Nil(t, wallet.Open("foo"))
+	assert.Equal(t, accounts.ErrWalletAlreadyOpen, wallet.Open("foo"))
+
+	status, _ := wallet.Status()
+	assert.Equal(t, "Opened", status)
+
+	account, err := wallet.Derive(path, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, 2, len(wallet.Accounts()))
+	assert.Nil(t, wallet.Close())
+
+	// Pinned accounts must survive reloading the wallet from disk
+	reloaded := NewHub(hub.dir, veryLightScryptN, veryLightScryptP).Wallets()
+	assert.Equal(t, 1, len(reloaded))
+	assert.Equal(t, wallet.Accounts(), reloaded[0].Accounts())
+	assert.True(t, reloaded[0].Contains(account))
+}
+
+func TestWalletSign(t *testing.T) {
+	dir, hub := tmpHub(t)
+	defer os.RemoveAll(dir)
+
+	wallet, err := hub.Restore(testMnemonic, "", "foo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	account := wallet.Accounts()[0]
+	hash := make([]byte, 32)
+
+	_, err = wallet.SignHash(account, hash)
+	assert.Equal(t, accounts.ErrWalletClosed, err)
+
+	_, err = wallet.SignHashWithPassphrase(account, "bar", hash)
+	assert.Equal(t, keystore.ErrDecrypt, err)
+
+	sig, err := wallet.SignHashWithPassphrase(account, "foo", hash)
+	assert.Nil(t, err)
+	assert.Equal(t, 65, len(sig))
+
+	_, err = wallet.SignHashWithPassphrase(accounts.Account{Address: common.Address{1}}, "foo", hash)
+	assert.Equal(t, accounts.ErrUnknownAccount, err)
+
+	tx := local.NewTransaction(0, account.Address, big.NewInt(1), 21000, big.NewInt(1), nil, account.Address)
+	chainID := big.NewInt(18)
+
+	assert.Nil(t, wallet.Open("foo"))
+	signed, err := wallet.SignTx(account, tx, chainID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	from, err := local.Sender(local.NewEIP155Signer(chainID), signed)
+	assert.Nil(t, err)
+	assert.Equal(t, account.Address, from)
+
+	signed, err = wallet.SignTxWithPassphrase(account, "foo", &types.Transaction{Data: tx.Data}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	from, err = local.Sender(local.HomesteadSigner{}, signed)
+	assert.Nil(t, err)
+	assert.Equal(t, account.Address, from)
+}
+
+func TestHubNotifications(t *testing.T) {
+	dir, hub := tmpHub(t)
+	defer os.RemoveAll(dir)
+
+	events := make(chan accounts.WalletEvent, 4)
+	sub := hub.Subscribe(events)
+	defer sub.Unsubscribe()
+
+	wallet, err := hub.Restore(testMnemonic, "", "auth")
+	assert.Nil(t, err)
+	select {
+	case ev := <-events:
+		assert.Equal(t, accounts.WalletArrived, ev.Kind)
+		assert.Equal(t, wallet.URL(), ev.Wallet.URL())
+	case <-time.After(time.Second):
+		t.Fatal("wallet arrival event not fired")
+	}
+
+	assert.Nil(t, os.Remove(wallet.URL().Path))
+	hub.refreshWallets()
+	select {
+	case ev := <-events:
+		assert.Equal(t, accounts.WalletDropped, ev.Kind)
+		assert.Equal(t, wallet.URL(), ev.Wallet.URL())
+	case <-time.After(time.Second):
+		t.Fatal("wallet drop event not fired")
+	}
+}
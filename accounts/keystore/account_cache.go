@@ -85,6 +85,21 @@ func newAccountCache(keydir string) (*accountCache, chan struct{}) {
 	return ac, ac.notify
 }
 
+// newStaticAccountCache creates a cache holding the given accounts of a storage
+// that is not a key directory. The cache is not watched nor reloaded, it only
+// changes through add and delete.
+func newStaticAccountCache(keydir string, accs []accounts.Account) (*accountCache, chan struct{}) {
+	ac := &accountCache{
+		keydir: keydir,
+		byAddr: make(map[common.Address][]accounts.Account),
+		notify: make(chan struct{}, 1),
+	}
+	for _, a := range accs {
+		ac.add(a)
+	}
+	return ac, ac.notify
+}
+
 func (ac *accountCache) accounts() []accounts.Account {
 	ac.maybeReload()
 	ac.mu.Lock()
@@ -194,6 +209,10 @@ func (ac *accountCache) find(a accounts.Account) (accounts.Account, error) {
 func (ac *accountCache) maybeReload() {
 	ac.mu.Lock()
 
+	if ac.watcher == nil {
+		ac.mu.Unlock()
+		return // Static caches are never reloaded.
+	}
 	if ac.watcher.running {
 		ac.mu.Unlock()
 		return // A watcher is running and will keep the cache up-to-date.
@@ -217,7 +236,9 @@ func (ac *accountCache) maybeReload() {
 
 func (ac *accountCache) close() {
 	ac.mu.Lock()
-	ac.watcher.close()
+	if ac.watcher != nil {
+		ac.watcher.close()
+	}
 	if ac.throttle != nil {
 		ac.throttle.Stop()
 	}
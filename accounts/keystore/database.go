@@ -0,0 +1,250 @@
+package keystore
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"syscall"
+
+	"github.com/DSiSc/wallet/accounts"
+	"github.com/DSiSc/wallet/common"
+)
+
+// ErrDatabaseInUse is returned by NewDBStorage when another process has the key
+// database open.
+var ErrDatabaseInUse = errors.New("key database in use by another process")
+
+// dbRecord is a record of the database file, storing or deleting the key at a
+// path.
+type dbRecord struct {
+	Path    string          `json:"path"`
+	Address *common.Address `json:"account,omitempty"` // Nil for deletions
+	Key     json.RawMessage `json:"key,omitempty"`     // Encrypted key, nil for deletions
+}
+
+// dbStorage keeps all the encrypted keys in a single database file, avoiding a
+// directory scan per key. The file is an append-only log of records, one JSON
+// document per line, that is replayed into memory when opened. Every write is
+// synced to disk before it is acknowledged.
+//
+// Only one process at a time may open the file, which is enforced by an exclusive
+// lock on a file next to it, held until the storage is closed. The database file
+// itself cannot carry the lock since compaction replaces it.
+type dbStorage struct {
+	path  string
+	kdf   KDFConfig
+	lock  *os.File // Locked file keeping other processes out
+	file  *os.File
+	keys  map[string]storedKey // Encrypted keys by path
+	stale int                  // Records overwritten or deleted by later ones
+
+	mu sync.RWMutex
+}
+
+// NewDBStorage opens the database file at path, creating it if needed.
+func NewDBStorage(path string, kdf KDFConfig) (Storage, error) {
+	path, err := filepath.Abs(path)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return nil, err
+	}
+	lock, err := os.OpenFile(path+".lock", os.O_RDWR|os.O_CREATE, 0600)
+	if err != nil {
+		return nil, err
+	}
+	if err := syscall.Flock(int(lock.Fd()), syscall.LOCK_EX|syscall.LOCK_NB); err != nil {
+		lock.Close()
+		if err == syscall.EWOULDBLOCK {
+			return nil, ErrDatabaseInUse
+		}
+		return nil, err
+	}
+	db := &dbStorage{
+		path: path,
+		kdf:  kdf,
+		lock: lock,
+		keys: make(map[string]storedKey),
+	}
+	if err := db.open(); err != nil {
+		lock.Close()
+		return nil, err
+	}
+	return db, nil
+}
+
+// open loads the database file and opens it for appending.
+func (db *dbStorage) open() (err error) {
+	if err := db.load(); err != nil {
+		return err
+	}
+	// Rewrite the file without the stale records once they dominate it
+	if db.stale > len(db.keys) {
+		if err := db.compact(); err != nil {
+			return err
+		}
+	}
+	db.file, err = os.OpenFile(db.path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0600)
+	return err
+}
+
+// load replays the records of the database file. A torn record at the end of
+// the file, left by an interrupted write, is discarded.
+func (db *dbStorage) load() error {
+	content, err := ioutil.ReadFile(db.path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if end := bytes.LastIndexByte(content, '\n') + 1; end < len(content) {
+		if err := os.Truncate(db.path, int64(end)); err != nil {
+			return err
+		}
+		content = content[:end]
+	}
+	scanner := bufio.NewScanner(bytes.NewReader(content))
+	scanner.Buffer(make([]byte, 4096), len(content)+1)
+	for line := 1; scanner.Scan(); line++ {
+		var record dbRecord
+		if err := json.Unmarshal(scanner.Bytes(), &record); err != nil {
+			return fmt.Errorf("key database %s corrupted at line %d: %v", db.path, line, err)
+		}
+		if _, ok := db.keys[record.Path]; ok {
+			db.stale++
+		}
+		if record.Address == nil {
+			delete(db.keys, record.Path)
+			db.stale++
+			continue
+		}
+		db.keys[record.Path] = storedKey{Address: *record.Address, JSON: record.Key}
+	}
+	return scanner.Err()
+}
+
+// compact atomically replaces the database file with one holding only the live
+// records.
+func (db *dbStorage) compact() error {
+	var buf bytes.Buffer
+	for path, key := range db.keys {
+		addr := key.Address
+		line, err := json.Marshal(&dbRecord{Path: path, Address: &addr, Key: key.JSON})
+		if err != nil {
+			return err
+		}
+		buf.Write(append(line, '\n'))
+	}
+	tmpName, err := writeTemporaryKeyFile(db.path, buf.Bytes())
+	if err != nil {
+		return err
+	}
+	if err := os.Rename(tmpName, db.path); err != nil {
+		return err
+	}
+	db.stale = 0
+	return nil
+}
+
+// append writes the record to the database file and syncs it to disk.
+func (db *dbStorage) append(record *dbRecord) error {
+	line, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+	if _, err := db.file.Write(append(line, '\n')); err != nil {
+		return err
+	}
+	return db.file.Sync()
+}
+
+func (db *dbStorage) GetKey(addr common.Address, filename, auth string) (*Key, error) {
+	db.mu.RLock()
+	key, ok := db.keys[filename]
+	db.mu.RUnlock()
+
+	if !ok {
+		return nil, ErrNoMatch
+	}
+	return key.decrypt(addr, auth)
+}
+
+func (db *dbStorage) StoreKey(filename string, key *Key, auth string) error {
+	keyjson, err := db.kdf.EncryptKey(key, auth)
+	if err != nil {
+		return err
+	}
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	addr := key.Address
+	if err := db.append(&dbRecord{Path: filename, Address: &addr, Key: keyjson}); err != nil {
+		return err
+	}
+	if _, ok := db.keys[filename]; ok {
+		db.stale++
+	}
+	db.keys[filename] = storedKey{Address: addr, JSON: keyjson}
+	return nil
+}
+
+func (db *dbStorage) DeleteKey(filename string) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	if _, ok := db.keys[filename]; !ok {
+		return ErrNoMatch
+	}
+	if err := db.append(&dbRecord{Path: filename}); err != nil {
+		return err
+	}
+	delete(db.keys, filename)
+	db.stale += 2
+	return nil
+}
+
+func (db *dbStorage) JoinPath(filename string) string {
+	if filepath.IsAbs(filename) {
+		return filename
+	}
+	return filepath.Join(db.path, filename)
+}
+
+func (db *dbStorage) Accounts() ([]accounts.Account, error) {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	return storedAccounts(db.keys), nil
+}
+
+func (db *dbStorage) KDFConfig() KDFConfig {
+	return db.kdf
+}
+
+func (db *dbStorage) KeyJSON(filename string) ([]byte, error) {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	if key, ok := db.keys[filename]; ok {
+		return key.JSON, nil
+	}
+	return nil, ErrNoMatch
+}
+
+// Close closes the database file and lets other processes open it.
+func (db *dbStorage) Close() error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	err := db.file.Close()
+	db.lock.Close()
+	return err
+}
@@ -0,0 +1,221 @@
+package keystore
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/DSiSc/wallet/common/math"
+	"golang.org/x/crypto/argon2"
+)
+
+const (
+	keyHeaderKDFArgon2id = "argon2id"
+
+	// StandardArgon2Time and StandardArgon2Memory are the cost parameters of
+	// Argon2id, using 256MB memory and taking approximately 1s CPU time on a
+	// modern processor.
+	StandardArgon2Time   = 3
+	StandardArgon2Memory = 256 * 1024
+
+	// LightArgon2Time and LightArgon2Memory are the cost parameters of Argon2id,
+	// using 4MB memory and taking approximately 10ms CPU time on a modern
+	// processor.
+	LightArgon2Time   = 1
+	LightArgon2Memory = 4 * 1024
+
+	// StandardArgon2Threads is the degree of parallelism of Argon2id.
+	StandardArgon2Threads = 4
+
+	argon2DKLen     = 32
+	argon2MaxMemory = 4 * 1024 * 1024 // Memory limit of keys accepted for decryption, in KiB
+)
+
+// ErrKDFDowngrade is returned when re-encrypting a key would derive its
+// encryption key with less effort than before.
+var ErrKDFDowngrade = errors.New("key derivation function weaker than the current one")
+
+// kdfParamNames are the cost parameters of the key derivation functions, in the
+// order expected by kdfCost.
+var kdfParamNames = map[string][]string{
+	keyHeaderKDF:         {"n", "r", "p"},
+	keyHeaderKDFArgon2id: {"t", "m", "p"},
+}
+
+// kdfCost estimates the effort of a key derivation as the bytes of memory it
+// fills times the passes over them, so that functions can be compared: 128*N*r*p
+// for scrypt and m KiB times t for Argon2id, whose parallelism does not change
+// the work done.
+func kdfCost(kdf string, params []float64) float64 {
+	if kdf == keyHeaderKDF {
+		return 128 * params[0] * params[1] * params[2]
+	}
+	return 1024 * params[1] * params[0]
+}
+
+// Argon2Params are the cost parameters of the Argon2id key derivation function.
+type Argon2Params struct {
+	Time    uint32 // Number of passes over the memory
+	Memory  uint32 // Memory size in KiB
+	Threads uint8  // Degree of parallelism
+}
+
+// KDFConfig selects the key derivation function protecting the keys encrypted
+// by a storage. Scrypt is used unless Argon2 is set.
+type KDFConfig struct {
+	ScryptN int
+	ScryptP int
+	Argon2  *Argon2Params
+}
+
+// ScryptKDF returns the configuration deriving keys with scrypt.
+func ScryptKDF(scryptN, scryptP int) KDFConfig {
+	return KDFConfig{ScryptN: scryptN, ScryptP: scryptP}
+}
+
+// Argon2KDF returns the configuration deriving keys with Argon2id.
+func Argon2KDF(params Argon2Params) KDFConfig {
+	return KDFConfig{Argon2: &params}
+}
+
+// EncryptKey encrypts the key with the configured key derivation function.
+func (config KDFConfig) EncryptKey(key *Key, auth string) ([]byte, error) {
+	if config.Argon2 == nil {
+		return EncryptKey(key, auth, config.ScryptN, config.ScryptP)
+	}
+	return EncryptKeyArgon2(key, auth, *config.Argon2)
+}
+
+// Name returns the name of the configured key derivation function, as stored in
+// encrypted keys.
+func (config KDFConfig) Name() string {
+	if config.Argon2 == nil {
+		return keyHeaderKDF
+	}
+	return keyHeaderKDFArgon2id
+}
+
+// params returns the cost parameters of the configuration, named by
+// kdfParamNames.
+func (config KDFConfig) params() []float64 {
+	if config.Argon2 == nil {
+		return []float64{float64(config.ScryptN), scryptR, float64(config.ScryptP)}
+	}
+	return []float64{float64(config.Argon2.Time), float64(config.Argon2.Memory), float64(config.Argon2.Threads)}
+}
+
+// compare checks the configuration against the key derivation of an encrypted
+// key, reporting whether the parameters are the same and whether they are
+// weaker, by their kdfCost even when the functions differ. PBKDF2, which fills
+// no memory, is weaker than any configuration.
+func (config KDFConfig) compare(cryptoJSON CryptoJSON) (same, weaker bool, err error) {
+	if cryptoJSON.KDF == "pbkdf2" {
+		return false, false, nil
+	}
+	names, ok := kdfParamNames[cryptoJSON.KDF]
+	if !ok {
+		return false, false, fmt.Errorf("unsupported KDF: %s", cryptoJSON.KDF)
+	}
+	have := make([]float64, len(names))
+	for i, name := range names {
+		if have[i], ok = kdfParam(cryptoJSON.KDFParams, name); !ok {
+			return false, false, fmt.Errorf("invalid %s parameter %s: %v", cryptoJSON.KDF, name, cryptoJSON.KDFParams[name])
+		}
+	}
+	name, want := config.Name(), config.params()
+	same = name == cryptoJSON.KDF && have[0] == want[0] && have[1] == want[1] && have[2] == want[2]
+	return same, kdfCost(name, want) < kdfCost(cryptoJSON.KDF, have), nil
+}
+
+// EncryptDataArgon2 encrypts the data given as 'data' with the password 'auth',
+// deriving the encryption key with Argon2id.
+func EncryptDataArgon2(data, auth []byte, params Argon2Params) (CryptoJSON, error) {
+	if err := params.validate(); err != nil {
+		return CryptoJSON{}, err
+	}
+	salt := make([]byte, 32)
+	if _, err := io.ReadFull(rand.Reader, salt); err != nil {
+		panic("reading from crypto/rand failed: " + err.Error())
+	}
+	derivedKey := argon2.IDKey(auth, salt, params.Time, params.Memory, params.Threads, argon2DKLen)
+
+	argon2ParamsJSON := make(map[string]interface{}, 5)
+	argon2ParamsJSON["t"] = int(params.Time)
+	argon2ParamsJSON["m"] = int(params.Memory)
+	argon2ParamsJSON["p"] = int(params.Threads)
+	argon2ParamsJSON["dklen"] = argon2DKLen
+	argon2ParamsJSON["salt"] = hex.EncodeToString(salt)
+
+	return encryptDataV3(data, derivedKey, keyHeaderKDFArgon2id, argon2ParamsJSON)
+}
+
+// EncryptKeyArgon2 encrypts a key using the specified Argon2id parameters into
+// a json blob that can be decrypted later on.
+func EncryptKeyArgon2(key *Key, auth string, params Argon2Params) ([]byte, error) {
+	keyBytes := math.PaddedBigBytes(key.PrivateKey.D, 32)
+	cryptoStruct, err := EncryptDataArgon2(keyBytes, []byte(auth), params)
+	if err != nil {
+		return nil, err
+	}
+	encryptedKeyJSONV3 := encryptedKeyJSONV3{
+		hex.EncodeToString(key.Address[:]),
+		cryptoStruct,
+		key.Id.String(),
+		version,
+	}
+	return json.Marshal(encryptedKeyJSONV3)
+}
+
+func (params Argon2Params) validate() error {
+	switch {
+	case params.Time < 1:
+		return fmt.Errorf("invalid Argon2 time %d", params.Time)
+	case params.Threads < 1:
+		return fmt.Errorf("invalid Argon2 parallelism %d", params.Threads)
+	case params.Memory < 8*uint32(params.Threads):
+		return fmt.Errorf("invalid Argon2 memory %dKiB, need at least 8KiB per thread", params.Memory)
+	}
+	return nil
+}
+
+// argon2Key derives the key described by the kdfparams of an Argon2id
+// encrypted key.
+func argon2Key(kdfParams map[string]interface{}, auth, salt []byte, dkLen int) ([]byte, error) {
+	var values [3]uint32
+	for i, name := range []string{"t", "m", "p"} {
+		v, ok := kdfParam(kdfParams, name)
+		if !ok || v < 0 || v > float64(^uint32(0)) || v != float64(uint32(v)) {
+			return nil, fmt.Errorf("invalid Argon2 parameter %s: %v", name, kdfParams[name])
+		}
+		values[i] = uint32(v)
+	}
+	if values[2] > 255 {
+		return nil, fmt.Errorf("invalid Argon2 parallelism %d", values[2])
+	}
+	params := Argon2Params{Time: values[0], Memory: values[1], Threads: uint8(values[2])}
+	if err := params.validate(); err != nil {
+		return nil, err
+	}
+	if params.Memory > argon2MaxMemory {
+		return nil, fmt.Errorf("Argon2 memory %dKiB exceeds the limit of %dKiB", params.Memory, argon2MaxMemory)
+	}
+	if dkLen < 32 || dkLen > 64 {
+		return nil, fmt.Errorf("invalid Argon2 key length %d", dkLen)
+	}
+	return argon2.IDKey(auth, salt, params.Time, params.Memory, params.Threads, uint32(dkLen)), nil
+}
+
+// kdfParam returns the numeric parameter of the kdfparams of an encrypted key,
+// which are ints when freshly encrypted and float64 once decoded from JSON.
+func kdfParam(kdfParams map[string]interface{}, name string) (float64, bool) {
+	switch v := kdfParams[name].(type) {
+	case int:
+		return float64(v), true
+	case float64:
+		return v, true
+	}
+	return 0, false
+}
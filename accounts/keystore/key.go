@@ -1,7 +1,6 @@
 package keystore
 
 import (
-	"bytes"
 	"crypto/ecdsa"
 	"encoding/hex"
 	"encoding/json"
@@ -14,7 +13,6 @@ import (
 	"io/ioutil"
 	"os"
 	"path/filepath"
-	"strings"
 	"time"
 )
 
@@ -47,13 +45,23 @@ type Key struct {
 	PrivateKey *ecdsa.PrivateKey
 }
 
-type keyStore interface {
-	// Loads and decrypts the key from disk.
+// Storage is a backend persisting the encrypted keys of a KeyStore. Keys are
+// identified by the path of their account URL, as built by JoinPath.
+type Storage interface {
+	// Loads and decrypts the key.
 	GetKey(addr common.Address, filename string, auth string) (*Key, error)
 	// Writes and encrypts the key.
 	StoreKey(filename string, k *Key, auth string) error
+	// Removes the key.
+	DeleteKey(filename string) error
 	// Joins filename with the key directory unless it is already absolute.
 	JoinPath(filename string) string
+	// Lists the accounts of all stored keys.
+	Accounts() ([]accounts.Account, error)
+	// Returns the encrypted key as stored, for export and migration.
+	KeyJSON(filename string) ([]byte, error)
+	// Returns the key derivation settings new keys are encrypted with.
+	KDFConfig() KDFConfig
 }
 
 type plainKeyJSON struct {
@@ -140,21 +148,15 @@ func newKeyFromECDSA(privateKeyECDSA *ecdsa.PrivateKey) *Key {
 // into the Direct ICAP spec. for simplicity and easier compatibility with other libs, we
 // retry until the first byte is 0.
 func NewKeyForDirectICAP(rand io.Reader) *Key {
-	randBytes := make([]byte, 64)
-	_, err := rand.Read(randBytes)
-	if err != nil {
-		panic("key generation: could not read from random source: " + err.Error())
-	}
-	reader := bytes.NewReader(randBytes)
-	privateKeyECDSA, err := ecdsa.GenerateKey(crypto.S256(), reader)
-	if err != nil {
-		panic("key generation: ecdsa.GenerateKey failed: " + err.Error())
-	}
-	key := newKeyFromECDSA(privateKeyECDSA)
-	if !strings.HasPrefix(key.Address.Hex(), "0x00") {
-		return NewKeyForDirectICAP(rand)
+	for {
+		key, err := newKey(rand)
+		if err != nil {
+			panic("key generation: " + err.Error())
+		}
+		if key.Address[0] == 0 {
+			return key
+		}
 	}
-	return key
 }
 
 func newKey(rand io.Reader) (*Key, error) {
@@ -165,20 +167,26 @@ func newKey(rand io.Reader) (*Key, error) {
 	return newKeyFromECDSA(privateKeyECDSA), nil
 }
 
-func storeNewKey(ks keyStore, rand io.Reader, auth string) (*Key, accounts.Account, error) {
+func storeNewKey(ks Storage, rand io.Reader, auth string) (*Key, accounts.Account, error) {
 	key, err := newKey(rand)
 	if err != nil {
 		return nil, accounts.Account{}, err
 	}
+	a, err := storeKey(ks, key, auth)
+	if err != nil {
+		zeroKey(key.PrivateKey)
+		return nil, a, err
+	}
+	return key, a, nil
+}
+
+// storeKey stores the key under its canonical file name, encrypted with auth.
+func storeKey(ks Storage, key *Key, auth string) (accounts.Account, error) {
 	a := accounts.Account{
 		Address: key.Address,
 		URL:     accounts.URL{Scheme: KeyStoreScheme, Path: ks.JoinPath(keyFileName(key.Address))},
 	}
-	if err := ks.StoreKey(a.URL.Path, key, auth); err != nil {
-		zeroKey(key.PrivateKey)
-		return nil, a, err
-	}
-	return key, a, err
+	return a, ks.StoreKey(a.URL.Path, key, auth)
 }
 
 func writeTemporaryKeyFile(file string, content []byte) (string, error) {
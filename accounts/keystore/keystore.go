@@ -3,13 +3,20 @@ package keystore
 import (
 	"crypto/ecdsa"
 	crand "crypto/rand"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"github.com/DSiSc/craft/types"
 	"github.com/DSiSc/crypto-suite/crypto"
 	"github.com/DSiSc/wallet/accounts"
+	"github.com/DSiSc/wallet/accounts/audit"
+	"github.com/DSiSc/wallet/accounts/metadata"
+	"github.com/DSiSc/wallet/accounts/shamir"
 	"github.com/DSiSc/wallet/common"
 	local "github.com/DSiSc/wallet/core/types"
+	"github.com/DSiSc/wallet/event"
+	"io"
+	"io/ioutil"
 	"math/big"
 	"os"
 	"path/filepath"
@@ -44,8 +51,14 @@ var (
 	ErrLocked  = accounts.NewAuthNeededError("password or unlock")
 	ErrNoMatch = errors.New("no key for given address or file")
 	ErrDecrypt = errors.New("could not decrypt key with given passphrase")
+
+	ErrAccountAlreadyExists = errors.New("account already exists")
 )
 
+// trashTimeFormat is the layout of the deletion time prefixed to the files of
+// trashed keys.
+const trashTimeFormat = "2006-01-02T15-04-05.000000000Z"
+
 // KeyStoreType is the reflect type of a keystore backend.
 var KeyStoreType = reflect.TypeOf(&KeyStore{})
 
@@ -57,12 +70,18 @@ const walletRefreshCycle = 3 * time.Second
 
 // KeyStore manages a key storage directory on disk.
 type KeyStore struct {
-	storage  keyStore                     // Storage backend, might be cleartext or encrypted
-	cache    *accountCache                // In-memory account cache over the filesystem storage
+	storage  Storage                      // Storage backend, might be cleartext or encrypted
+	cache    *accountCache                // In-memory account cache over the storage
 	changes  chan struct{}                // Channel receiving change notifications from the cache
 	unlocked map[common.Address]*unlocked // Currently unlocked account (decrypted private keys)
 
-	wallets []accounts.Wallet // Wallet wrappers around the individual key files
+	wallets     []accounts.Wallet       // Wallet wrappers around the individual key files
+	updateFeed  event.Feed              // Event feed to notify wallet additions/removals
+	updateScope event.SubscriptionScope // Subscription scope tracking current live listeners
+	updating    bool                    // Whether the event notification loop is running
+
+	audit    *audit.Log      // Audit log recording key operations, nil if disabled
+	metadata *metadata.Store // Metadata of the accounts, nil if not kept
 
 	mu sync.RWMutex
 }
@@ -72,28 +91,52 @@ type unlocked struct {
 	abort chan struct{}
 }
 
-// NewKeyStore creates a keystore for the given directory.
+// NewKeyStore creates a keystore for the given directory. It panics if the
+// keystore cannot be set up; use NewKeyStoreWithStorage to handle the error.
 func NewKeyStore(keydir string, scryptN, scryptP int) *KeyStore {
-	keydir, _ = filepath.Abs(keydir)
-	ks := &KeyStore{storage: &keyStorePassphrase{keydir, scryptN, scryptP, false}}
-	ks.init(keydir)
+	ks, err := NewKeyStoreWithStorage(NewFileStorage(keydir, ScryptKDF(scryptN, scryptP)))
+	if err != nil {
+		panic("keystore: " + err.Error())
+	}
 	return ks
 }
 
-func (ks *KeyStore) init(keydir string) {
+// NewKeyStoreWithStorage creates a keystore on top of the given storage. File
+// storages are watched for keys added or removed behind the keystore's back,
+// other storages are only modified through the keystore.
+func NewKeyStoreWithStorage(storage Storage) (*KeyStore, error) {
+	ks := &KeyStore{storage: storage}
+	if err := ks.init(); err != nil {
+		return nil, err
+	}
+	return ks, nil
+}
+
+func (ks *KeyStore) init() error {
 	// Lock the mutex since the account cache might call back with events
 	ks.mu.Lock()
 	defer ks.mu.Unlock()
 
 	// Initialize the set of unlocked keys and the account cache
 	ks.unlocked = make(map[common.Address]*unlocked)
-	ks.cache, ks.changes = newAccountCache(keydir)
+	if files, ok := ks.storage.(*keyStorePassphrase); ok {
+		ks.cache, ks.changes = newAccountCache(files.keysDirPath)
+	} else {
+		accs, err := ks.storage.Accounts()
+		if err != nil {
+			return err
+		}
+		ks.cache, ks.changes = newStaticAccountCache(ks.storage.JoinPath(""), accs)
+	}
 
 	// TODO: In order for this finalizer to work, there must be no references
 	// to ks. addressCache doesn't keep a reference but unlocked keys do,
 	// so the finalizer will not trigger until all timed unlocks have expired.
 	runtime.SetFinalizer(ks, func(m *KeyStore) {
 		m.cache.close()
+		if closer, ok := m.storage.(io.Closer); ok {
+			closer.Close()
+		}
 	})
 	// Create the initial list of wallets from the cache
 	accs := ks.cache.accounts()
@@ -101,6 +144,7 @@ func (ks *KeyStore) init(keydir string) {
 	for i := 0; i < len(accs); i++ {
 		ks.wallets[i] = &keystoreWallet{account: accs[i], keystore: ks}
 	}
+	return nil
 }
 
 // Wallets implements accounts.Backend, returning all single-key wallets from the
@@ -155,6 +199,55 @@ func (ks *KeyStore) refreshWallets() {
 	}
 	ks.wallets = wallets
 	ks.mu.Unlock()
+
+	// Fire all wallet events and return
+	for _, event := range events {
+		ks.updateFeed.Send(event)
+	}
+}
+
+// Subscribe implements accounts.Backend, creating an async subscription to
+// receive notifications on the addition or removal of keystore wallets.
+func (ks *KeyStore) Subscribe(sink chan<- accounts.WalletEvent) event.Subscription {
+	// We need the mutex to reliably start/stop the update loop
+	ks.mu.Lock()
+	defer ks.mu.Unlock()
+
+	// Subscribe the caller and track the subscriber count
+	sub := ks.updateScope.Track(ks.updateFeed.Subscribe(sink))
+
+	// Subscribers require an active notification loop, start it
+	if !ks.updating {
+		ks.updating = true
+		go ks.updater()
+	}
+	return sub
+}
+
+// updater is responsible for maintaining an up-to-date list of wallets stored in
+// the keystore, and for firing wallet addition/removal events. It listens for
+// account change events from the underlying account cache, and also periodically
+// forces a manual refresh (only triggers for systems where the filesystem notifier
+// is not running).
+func (ks *KeyStore) updater() {
+	for {
+		// Wait for an account update or a refresh timeout
+		select {
+		case <-ks.changes:
+		case <-time.After(walletRefreshCycle):
+		}
+		// Run the wallet refresher
+		ks.refreshWallets()
+
+		// If all our subscribers left, stop the updater
+		ks.mu.Lock()
+		if ks.updateScope.Count() == 0 {
+			ks.updating = false
+			ks.mu.Unlock()
+			return
+		}
+		ks.mu.Unlock()
+	}
 }
 
 // HasAddress reports whether a key with the given address is present.
@@ -169,7 +262,9 @@ func (ks *KeyStore) Accounts() []accounts.Account {
 
 // Delete deletes the key matched by account if the passphrase is correct.
 // If the account contains no filename, the address must match a unique key.
-func (ks *KeyStore) Delete(a accounts.Account, passphrase string) error {
+func (ks *KeyStore) Delete(a accounts.Account, passphrase string) (err error) {
+	defer func() { err = ks.record(a, audit.OpDelete, nil, nil, err) }()
+
 	// Decrypting the key isn't really necessary, but we do
 	// it anyway to check the password and zero out the key
 	// immediately afterwards.
@@ -183,17 +278,141 @@ func (ks *KeyStore) Delete(a accounts.Account, passphrase string) error {
 	// The order is crucial here. The key is dropped from the
 	// cache after the file is gone so that a reload happening in
 	// between won't insert it into the cache again.
-	err = os.Remove(a.URL.Path)
+	err = ks.storage.DeleteKey(a.URL.Path)
 	if err == nil {
 		ks.cache.delete(a)
 		ks.refreshWallets()
+		if md := ks.Metadata(); md != nil && !ks.cache.hasAddress(a.Address) {
+			err = md.Delete(a.Address)
+		}
+	}
+	return err
+}
+
+// Trash moves the key matched by account into trashDir if the passphrase is
+// correct, instead of deleting it for good. The encrypted key is saved in a file
+// named after the time of deletion and its original name, which Restore takes
+// to bring it back.
+func (ks *KeyStore) Trash(a accounts.Account, passphrase, trashDir string) (trashed string, err error) {
+	defer func() {
+		if err = ks.record(a, audit.OpTrash, nil, nil, err); err != nil {
+			trashed = ""
+		}
+	}()
+
+	a, key, err := ks.GetDecryptedKey(a, passphrase)
+	if key != nil {
+		zeroKey(key.PrivateKey)
+	}
+	if err != nil {
+		return "", err
+	}
+	keyjson, err := ks.storage.KeyJSON(a.URL.Path)
+	if err != nil {
+		return "", err
+	}
+	trashed = filepath.Join(trashDir, time.Now().UTC().Format(trashTimeFormat)+"--"+filepath.Base(a.URL.Path))
+	if err := writeKeyFile(trashed, keyjson); err != nil {
+		return "", err
+	}
+	// Same order as Delete, the key only leaves the cache once it is gone
+	if err := ks.storage.DeleteKey(a.URL.Path); err != nil {
+		os.Remove(trashed)
+		return "", err
+	}
+	ks.cache.delete(a)
+	ks.refreshWallets()
+	return trashed, nil
+}
+
+// Restore stores again the key moved to the trash file by Trash if the
+// passphrase is correct, and removes the trash file.
+func (ks *KeyStore) Restore(trashed, passphrase string) (a accounts.Account, err error) {
+	defer func() {
+		if err = ks.record(a, audit.OpRestore, nil, nil, err); err != nil {
+			a = accounts.Account{}
+		}
+	}()
+
+	keyjson, err := ioutil.ReadFile(trashed)
+	if err != nil {
+		return a, err
+	}
+	var header struct {
+		Address string `json:"address"`
+	}
+	if err := json.Unmarshal(keyjson, &header); err == nil {
+		a.Address = common.HexToAddress(header.Address)
+	}
+	key, err := DecryptKey(keyjson, passphrase)
+	if key != nil && key.PrivateKey != nil {
+		defer zeroKey(key.PrivateKey)
+	}
+	if err != nil {
+		return a, err
+	}
+	if ks.cache.hasAddress(key.Address) {
+		return a, ErrAccountAlreadyExists
+	}
+	if a, err = ks.importKey(key, passphrase); err != nil {
+		return a, err
+	}
+	return a, os.Remove(trashed)
+}
+
+// SetAuditLog makes the keystore record all signing, export, delete and update
+// operations in the given audit log. Operations fail when they cannot be
+// recorded. A nil log disables auditing.
+func (ks *KeyStore) SetAuditLog(log *audit.Log) {
+	ks.mu.Lock()
+	defer ks.mu.Unlock()
+
+	ks.audit = log
+}
+
+// SetMetadata makes the keystore keep the metadata of its accounts in the given
+// store, dropping it along with deleted keys. A nil store disables metadata.
+func (ks *KeyStore) SetMetadata(store *metadata.Store) {
+	ks.mu.Lock()
+	defer ks.mu.Unlock()
+
+	ks.metadata = store
+}
+
+// Metadata returns the metadata store of the accounts, nil if none is kept.
+func (ks *KeyStore) Metadata() *metadata.Store {
+	ks.mu.RLock()
+	defer ks.mu.RUnlock()
+
+	return ks.metadata
+}
+
+// record appends an operation to the audit log, if one is set. It returns the
+// error of the operation, or that of the audit log when the operation could not
+// be recorded, in which case its results must be dropped.
+func (ks *KeyStore) record(a accounts.Account, operation string, hash *common.Hash, chainID *big.Int, err error) error {
+	ks.mu.RLock()
+	log := ks.audit
+	ks.mu.RUnlock()
+
+	if log == nil {
+		return err
+	}
+	if aerr := log.Append(a.Address, operation, hash, chainID, err); aerr != nil {
+		return fmt.Errorf("failed to write audit log: %v", aerr)
 	}
 	return err
 }
 
 // SignHash calculates a ECDSA signature for the given hash. The produced
 // signature is in the [R || S || V] format where V is 0 or 1.
-func (ks *KeyStore) SignHash(a accounts.Account, hash []byte) ([]byte, error) {
+func (ks *KeyStore) SignHash(a accounts.Account, hash []byte) (signature []byte, err error) {
+	defer func() {
+		if err = ks.record(a, audit.OpSignHash, hashOf(hash), nil, err); err != nil {
+			signature = nil
+		}
+	}()
+
 	// Look up the key to sign with and abort if it cannot be found
 	ks.mu.RLock()
 	defer ks.mu.RUnlock()
@@ -207,7 +426,15 @@ func (ks *KeyStore) SignHash(a accounts.Account, hash []byte) ([]byte, error) {
 }
 
 // SignTx signs the given transaction with the requested account.
-func (ks *KeyStore) SignTx(a accounts.Account, tx *types.Transaction, chainID *big.Int) (*types.Transaction, error) {
+func (ks *KeyStore) SignTx(a accounts.Account, tx *types.Transaction, chainID *big.Int) (signed *types.Transaction, err error) {
+	signer := local.NewEIP155Signer(chainID)
+	sighash := signer.Hash(tx)
+	defer func() {
+		if err = ks.record(a, audit.OpSignTx, &sighash, chainID, err); err != nil {
+			signed = nil
+		}
+	}()
+
 	// Look up the key to sign with and abort if it cannot be found
 	ks.mu.RLock()
 	defer ks.mu.RUnlock()
@@ -217,7 +444,7 @@ func (ks *KeyStore) SignTx(a accounts.Account, tx *types.Transaction, chainID *b
 		return nil, ErrLocked
 	}
 
-	return local.SignTx(tx, local.NewEIP155Signer(chainID), unlockedKey.PrivateKey)
+	return local.SignTx(tx, signer, unlockedKey.PrivateKey)
 
 }
 
@@ -225,6 +452,12 @@ func (ks *KeyStore) SignTx(a accounts.Account, tx *types.Transaction, chainID *b
 // can be decrypted with the given passphrase. The produced signature is in the
 // [R || S || V] format where V is 0 or 1.
 func (ks *KeyStore) SignHashWithPassphrase(a accounts.Account, passphrase string, hash []byte) (signature []byte, err error) {
+	defer func() {
+		if err = ks.record(a, audit.OpSignHashWithPassphrase, hashOf(hash), nil, err); err != nil {
+			signature = nil
+		}
+	}()
+
 	_, key, err := ks.GetDecryptedKey(a, passphrase)
 	if err != nil {
 		return nil, err
@@ -235,19 +468,26 @@ func (ks *KeyStore) SignHashWithPassphrase(a accounts.Account, passphrase string
 
 // SignTxWithPassphrase signs the transaction if the private key matching the
 // given address can be decrypted with the given passphrase.
-func (ks *KeyStore) SignTxWithPassphrase(a accounts.Account, passphrase string, tx *types.Transaction, chainID *big.Int) (*types.Transaction, error) {
+func (ks *KeyStore) SignTxWithPassphrase(a accounts.Account, passphrase string, tx *types.Transaction, chainID *big.Int) (signed *types.Transaction, err error) {
+	// Depending on the presence of the chain ID, sign with EIP155 or homestead
+	var signer local.Signer = local.HomesteadSigner{}
+	if chainID != nil {
+		signer = local.NewEIP155Signer(chainID)
+	}
+	sighash := signer.Hash(tx)
+	defer func() {
+		if err = ks.record(a, audit.OpSignTxWithPassphrase, &sighash, chainID, err); err != nil {
+			signed = nil
+		}
+	}()
+
 	_, key, err := ks.GetDecryptedKey(a, passphrase)
 	if err != nil {
 		return nil, err
 	}
 	defer zeroKey(key.PrivateKey)
 
-	// Depending on the presence of the chain ID, sign with EIP155 or homestead
-	if chainID != nil {
-		return local.SignTx(tx, local.NewEIP155Signer(chainID), key.PrivateKey)
-	}
-
-	return local.SignTx(tx, local.HomesteadSigner{}, key.PrivateKey)
+	return local.SignTx(tx, signer, key.PrivateKey)
 }
 
 // Unlock unlocks the given account indefinitely.
@@ -357,17 +597,54 @@ func (ks *KeyStore) NewAccount(passphrase string) (accounts.Account, error) {
 
 // Export exports as a JSON key, encrypted with newPassphrase.
 func (ks *KeyStore) Export(a accounts.Account, passphrase, newPassphrase string) (keyJSON []byte, err error) {
+	defer func() {
+		if err = ks.record(a, audit.OpExport, nil, nil, err); err != nil {
+			keyJSON = nil
+		}
+	}()
+
 	_, key, err := ks.GetDecryptedKey(a, passphrase)
 	if err != nil {
 		return nil, err
 	}
-	var N, P int
-	if store, ok := ks.storage.(*keyStorePassphrase); ok {
-		N, P = store.scryptN, store.scryptP
-	} else {
-		N, P = StandardScryptN, StandardScryptP
+	defer zeroKey(key.PrivateKey)
+	return ks.storage.KDFConfig().EncryptKey(key, newPassphrase)
+}
+
+// ExportECDSA exports the unencrypted private key of the account.
+func (ks *KeyStore) ExportECDSA(a accounts.Account, passphrase string) (priv *ecdsa.PrivateKey, err error) {
+	defer func() {
+		if err = ks.record(a, audit.OpExportECDSA, nil, nil, err); err != nil && priv != nil {
+			zeroKey(priv)
+			priv = nil
+		}
+	}()
+
+	_, key, err := ks.GetDecryptedKey(a, passphrase)
+	if err != nil {
+		return nil, err
+	}
+	return key.PrivateKey, nil
+}
+
+// SplitKey splits the unencrypted private key of the account into n shares of
+// which any threshold rebuild it, with shamir.Combine. The shares are identified
+// by the address of the account.
+func (ks *KeyStore) SplitKey(a accounts.Account, passphrase string, threshold, n int) (shares []shamir.Share, err error) {
+	defer func() {
+		if err = ks.record(a, audit.OpSplit, nil, nil, err); err != nil {
+			shares = nil
+		}
+	}()
+
+	_, key, err := ks.GetDecryptedKey(a, passphrase)
+	if err != nil {
+		return nil, err
 	}
-	return EncryptKey(key, newPassphrase, N, P)
+	defer zeroKey(key.PrivateKey)
+	secret := crypto.FromECDSA(key.PrivateKey)
+	defer zeroBytes(secret)
+	return shamir.Split(secret, key.Address[:], threshold, n)
 }
 
 // Import stores the given encrypted JSON key into the key directory.
@@ -379,6 +656,9 @@ func (ks *KeyStore) Import(keyJSON []byte, passphrase, newPassphrase string) (ac
 	if err != nil {
 		return accounts.Account{}, err
 	}
+	if ks.cache.hasAddress(key.Address) {
+		return accounts.Account{}, ErrAccountAlreadyExists
+	}
 	return ks.importKey(key, newPassphrase)
 }
 
@@ -386,14 +666,14 @@ func (ks *KeyStore) Import(keyJSON []byte, passphrase, newPassphrase string) (ac
 func (ks *KeyStore) ImportECDSA(priv *ecdsa.PrivateKey, passphrase string) (accounts.Account, error) {
 	key := newKeyFromECDSA(priv)
 	if ks.cache.hasAddress(key.Address) {
-		return accounts.Account{}, fmt.Errorf("account already exists")
+		return accounts.Account{}, ErrAccountAlreadyExists
 	}
 	return ks.importKey(key, passphrase)
 }
 
 func (ks *KeyStore) importKey(key *Key, passphrase string) (accounts.Account, error) {
-	a := accounts.Account{Address: key.Address, URL: accounts.URL{Scheme: KeyStoreScheme, Path: ks.storage.JoinPath(keyFileName(key.Address))}}
-	if err := ks.storage.StoreKey(a.URL.Path, key, passphrase); err != nil {
+	a, err := storeKey(ks.storage, key, passphrase)
+	if err != nil {
 		return accounts.Account{}, err
 	}
 	ks.cache.add(a)
@@ -402,7 +682,9 @@ func (ks *KeyStore) importKey(key *Key, passphrase string) (accounts.Account, er
 }
 
 // Update changes the passphrase of an existing account.
-func (ks *KeyStore) Update(a accounts.Account, passphrase, newPassphrase string) error {
+func (ks *KeyStore) Update(a accounts.Account, passphrase, newPassphrase string) (err error) {
+	defer func() { err = ks.record(a, audit.OpUpdate, nil, nil, err) }()
+
 	a, key, err := ks.GetDecryptedKey(a, passphrase)
 	if err != nil {
 		return err
@@ -410,10 +692,70 @@ func (ks *KeyStore) Update(a accounts.Account, passphrase, newPassphrase string)
 	return ks.storage.StoreKey(a.URL.Path, key, newPassphrase)
 }
 
+// Migrate re-encrypts the key of an existing account with the key derivation
+// function of the storage, keeping its passphrase. Keys already encrypted with
+// the same parameters are left alone and reported as not migrated. Unless
+// forced, keys encrypted with a stronger key derivation are not touched either
+// and ErrKDFDowngrade is returned.
+func (ks *KeyStore) Migrate(a accounts.Account, passphrase string, force bool) (migrated bool, err error) {
+	a, err = ks.Find(a)
+	if err != nil {
+		return false, err
+	}
+	keyjson, err := ks.storage.KeyJSON(a.URL.Path)
+	if err != nil {
+		return false, err
+	}
+	var encrypted struct {
+		Crypto CryptoJSON `json:"crypto"`
+	}
+	if err := json.Unmarshal(keyjson, &encrypted); err != nil {
+		return false, err
+	}
+	kdf := ks.storage.KDFConfig()
+	same, weaker, err := kdf.compare(encrypted.Crypto)
+	if err != nil || same {
+		return false, err
+	}
+	if weaker && !force {
+		return false, ErrKDFDowngrade
+	}
+	defer func() {
+		if err = ks.record(a, audit.OpMigrate, nil, nil, err); err != nil {
+			migrated = false
+		}
+	}()
+
+	a, key, err := ks.GetDecryptedKey(a, passphrase)
+	if err != nil {
+		return false, err
+	}
+	defer zeroKey(key.PrivateKey)
+	if err := ks.storage.StoreKey(a.URL.Path, key, passphrase); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
 // ImportPreSaleKey decrypts the given Ethereum presale wallet and stores
 // a key file in the key directory. The key file is encrypted with the same passphrase.
 func (ks *KeyStore) ImportPreSaleKey(keyJSON []byte, passphrase string) (accounts.Account, error) {
-	return accounts.Account{}, nil
+	key, err := decryptPreSaleKey(keyJSON, passphrase)
+	if err != nil {
+		return accounts.Account{}, err
+	}
+	defer zeroKey(key.PrivateKey)
+
+	if ks.cache.hasAddress(key.Address) {
+		return accounts.Account{}, ErrAccountAlreadyExists
+	}
+	return ks.importKey(key, passphrase)
+}
+
+// hashOf converts a signed hash into the form recorded in the audit log.
+func hashOf(hash []byte) *common.Hash {
+	h := common.BytesToHash(hash)
+	return &h
 }
 
 // zeroKey zeroes a private key in memory.
@@ -423,3 +765,10 @@ func zeroKey(k *ecdsa.PrivateKey) {
 		b[i] = 0
 	}
 }
+
+// zeroBytes zeroes a secret in memory.
+func zeroBytes(b []byte) {
+	for i := range b {
+		b[i] = 0
+	}
+}
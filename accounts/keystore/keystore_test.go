@@ -2,15 +2,23 @@ package keystore
 
 import (
 	"crypto/ecdsa"
+	"encoding/hex"
+	"encoding/json"
 	"github.com/DSiSc/craft/types"
 	"github.com/DSiSc/crypto-suite/common"
+	"github.com/DSiSc/crypto-suite/crypto"
 	"github.com/DSiSc/monkey"
 	"github.com/DSiSc/wallet/accounts"
+	"github.com/DSiSc/wallet/accounts/audit"
+	"github.com/DSiSc/wallet/accounts/eip712"
+	"github.com/DSiSc/wallet/accounts/metadata"
+	"github.com/DSiSc/wallet/accounts/shamir"
 	ctypes "github.com/DSiSc/wallet/core/types"
 	"github.com/stretchr/testify/assert"
 	"io/ioutil"
 	"math/big"
 	"os"
+	"path/filepath"
 	"runtime"
 	"strings"
 	"testing"
@@ -71,6 +79,54 @@ func TestSign(t *testing.T) {
 	}
 }
 
+func TestSignText(t *testing.T) {
+	dir, ks := tmpKeyStore(t, true)
+	defer os.RemoveAll(dir)
+
+	a1, err := ks.NewAccount("foo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	wallet := ks.Wallets()[0]
+	msg := []byte("Hello Joe")
+
+	sig, err := accounts.SignTextWithPassphrase(wallet, a1, "foo", msg)
+	assert.Nil(t, err)
+	assert.True(t, sig[64] == 27 || sig[64] == 28)
+	signer, err := accounts.VerifyText(msg, sig)
+	assert.Nil(t, err)
+	assert.Equal(t, a1.Address, signer)
+
+	_, err = accounts.SignText(wallet, a1, msg)
+	assert.Equal(t, ErrLocked, err)
+	assert.Nil(t, ks.Unlock(a1, "foo"))
+	unlockedSig, err := accounts.SignText(wallet, a1, msg)
+	assert.Nil(t, err)
+	assert.Equal(t, sig, unlockedSig)
+}
+
+func TestSignTypedData(t *testing.T) {
+	dir, ks := tmpKeyStore(t, true)
+	defer os.RemoveAll(dir)
+
+	// The key of the EIP-712 example
+	key, err := crypto.ToECDSA(crypto.Keccak256([]byte("cow")))
+	assert.Nil(t, err)
+	a1, err := ks.ImportECDSA(key, "foo")
+	assert.Nil(t, err)
+	assert.Equal(t, "0xCD2a3d9F938E13CD947Ec05AbC7FE734Df8DD826", a1.Address.Hex())
+
+	input, err := ioutil.ReadFile(filepath.Join("..", "eip712", "testdata", "mail.json"))
+	assert.Nil(t, err)
+	data, err := eip712.Parse(input)
+	assert.Nil(t, err)
+
+	sig, err := accounts.SignTypedDataWithPassphrase(ks.Wallets()[0], a1, "foo", data)
+	assert.Nil(t, err)
+	assert.Equal(t, "4355c47d63924e8a72e509b65029052eb6c299d53a04e167c5775fd466751c9d"+
+		"07299936d304c153f6443dfa05f40ff007d72911b6f72307f996231605b915621c", hex.EncodeToString(sig))
+}
+
 func TestSignTx(t *testing.T) {
 	dir, ks := tmpKeyStore(t, true)
 	defer os.RemoveAll(dir)
@@ -285,10 +341,181 @@ func TestExport(t *testing.T) {
 	jsonBytes, err1 := ks.Export(acc, pass, pass)
 	assert.Equal(t, nil, err1)
 
-	acc1, err2 := ks.Import(jsonBytes, pass, pass)
+	_, err = ks.Import(jsonBytes, pass, pass)
+	assert.Equal(t, ErrAccountAlreadyExists, err)
+
+	dir2, ks2 := tmpKeyStore(t, true)
+	defer os.RemoveAll(dir2)
+	acc1, err2 := ks2.Import(jsonBytes, pass, pass)
 	assert.Equal(t, nil, err2)
 	assert.Equal(t, acc.Address, acc1.Address)
 
+	_, err = ks.ExportECDSA(acc, "bad")
+	assert.Equal(t, ErrDecrypt, err)
+	priv, err := ks.ExportECDSA(acc, pass)
+	assert.Nil(t, err)
+	assert.Equal(t, acc.Address, newKeyFromECDSA(priv).Address)
+}
+
+func TestSplitKey(t *testing.T) {
+	dir, ks := tmpKeyStore(t, true)
+	defer os.RemoveAll(dir)
+
+	acc, err := ks.NewAccount("foo")
+	assert.Nil(t, err)
+	_, err = ks.SplitKey(acc, "bad", 2, 3)
+	assert.Equal(t, ErrDecrypt, err)
+
+	shares, err := ks.SplitKey(acc, "foo", 2, 3)
+	assert.Nil(t, err)
+	assert.Len(t, shares, 3)
+	assert.Equal(t, acc.Address[:], shares[0].ID)
+	secret, err := shamir.Combine([]shamir.Share{shares[2], shares[0]})
+	assert.Nil(t, err)
+	priv, err := crypto.ToECDSA(secret)
+	assert.Nil(t, err)
+	assert.Equal(t, acc.Address, newKeyFromECDSA(priv).Address)
+}
+
+func TestMigrate(t *testing.T) {
+	dir, ks := tmpKeyStore(t, true)
+	defer os.RemoveAll(dir)
+
+	acc, err := ks.NewAccount("foo")
+	assert.Nil(t, err)
+
+	migrate := func(kdf KDFConfig, passphrase string, force bool) (bool, error) {
+		ks, err := NewKeyStoreWithStorage(NewFileStorage(dir, kdf))
+		assert.Nil(t, err)
+		return ks.Migrate(acc, passphrase, force)
+	}
+	stronger := ScryptKDF(veryLightScryptN*2, veryLightScryptP)
+
+	_, err = migrate(stronger, "bar", false)
+	assert.Equal(t, ErrDecrypt, err)
+	migrated, err := migrate(stronger, "foo", false)
+	assert.Nil(t, err)
+	assert.True(t, migrated)
+	migrated, err = migrate(stronger, "foo", false)
+	assert.Nil(t, err)
+	assert.False(t, migrated)
+
+	// Weaker parameters or functions are only applied when forced
+	_, err = migrate(ScryptKDF(veryLightScryptN, veryLightScryptP), "foo", false)
+	assert.Equal(t, ErrKDFDowngrade, err)
+	migrated, err = migrate(Argon2KDF(veryLightArgon2), "foo", false)
+	assert.Nil(t, err)
+	assert.True(t, migrated)
+	_, err = migrate(stronger, "foo", false)
+	assert.Equal(t, ErrKDFDowngrade, err)
+	migrated, err = migrate(stronger, "foo", true)
+	assert.Nil(t, err)
+	assert.True(t, migrated)
+
+	_, key, err := ks.GetDecryptedKey(acc, "foo")
+	assert.Nil(t, err)
+	assert.Equal(t, acc.Address, key.Address)
+}
+
+// Tests that changing the key derivation function compares its actual cost, so
+// that standard scrypt keys are not silently moved to light Argon2id.
+func TestMigrateAcrossKDFs(t *testing.T) {
+	if testing.Short() {
+		t.Skip("standard scrypt is slow")
+	}
+	dir, _ := tmpKeyStore(t, true)
+	defer os.RemoveAll(dir)
+
+	ks, err := NewKeyStoreWithStorage(NewFileStorage(dir, ScryptKDF(StandardScryptN, StandardScryptP)))
+	assert.Nil(t, err)
+	acc, err := ks.NewAccount("foo")
+	assert.Nil(t, err)
+
+	light := Argon2KDF(Argon2Params{Time: LightArgon2Time, Memory: LightArgon2Memory, Threads: StandardArgon2Threads})
+	ks, err = NewKeyStoreWithStorage(NewFileStorage(dir, light))
+	assert.Nil(t, err)
+	_, err = ks.Migrate(acc, "foo", false)
+	assert.Equal(t, ErrKDFDowngrade, err)
+	migrated, err := ks.Migrate(acc, "foo", true)
+	assert.Nil(t, err)
+	assert.True(t, migrated)
+
+	// Moving back to standard scrypt or Argon2id is no downgrade
+	standard := ScryptKDF(StandardScryptN, StandardScryptP)
+	encrypted, err := ioutil.ReadFile(acc.URL.Path)
+	assert.Nil(t, err)
+	var keyJSON encryptedKeyJSONV3
+	assert.Nil(t, json.Unmarshal(encrypted, &keyJSON))
+	_, weaker, err := standard.compare(keyJSON.Crypto)
+	assert.Nil(t, err)
+	assert.False(t, weaker)
+	_, weaker, err = Argon2KDF(Argon2Params{Time: StandardArgon2Time, Memory: StandardArgon2Memory, Threads: StandardArgon2Threads}).compare(keyJSON.Crypto)
+	assert.Nil(t, err)
+	assert.False(t, weaker)
+}
+
+func TestTrash(t *testing.T) {
+	dir, ks := tmpKeyStore(t, true)
+	defer os.RemoveAll(dir)
+	trashDir := filepath.Join(dir, ".trash")
+
+	acc, err := ks.NewAccount("foo")
+	assert.Nil(t, err)
+
+	_, err = ks.Trash(acc, "bar", trashDir)
+	assert.Equal(t, ErrDecrypt, err)
+	trashed, err := ks.Trash(acc, "foo", trashDir)
+	assert.Nil(t, err)
+	assert.Equal(t, trashDir, filepath.Dir(trashed))
+	assert.True(t, strings.HasSuffix(trashed, "--"+filepath.Base(acc.URL.Path)))
+	assert.False(t, ks.HasAddress(acc.Address))
+	assert.Equal(t, 0, len(ks.Accounts()))
+	_, err = os.Stat(acc.URL.Path)
+	assert.True(t, os.IsNotExist(err))
+
+	_, err = ks.Restore(trashed, "bar")
+	assert.Equal(t, ErrDecrypt, err)
+	restored, err := ks.Restore(trashed, "foo")
+	assert.Nil(t, err)
+	assert.Equal(t, acc.Address, restored.Address)
+	assert.True(t, ks.HasAddress(acc.Address))
+	assert.Nil(t, ks.Unlock(restored, "foo"))
+	_, err = os.Stat(trashed)
+	assert.True(t, os.IsNotExist(err))
+
+	// Keys of accounts present again are not restored twice
+	trashed, err = ks.Trash(restored, "foo", trashDir)
+	assert.Nil(t, err)
+	keyjson, err := ioutil.ReadFile(trashed)
+	assert.Nil(t, err)
+	_, err = ks.Import(keyjson, "foo", "foo")
+	assert.Nil(t, err)
+	_, err = ks.Restore(trashed, "foo")
+	assert.Equal(t, ErrAccountAlreadyExists, err)
+}
+
+func TestDeleteMetadata(t *testing.T) {
+	dir, ks := tmpKeyStore(t, true)
+	defer os.RemoveAll(dir)
+
+	md, err := metadata.Open(filepath.Join(dir, metadata.FileName))
+	assert.Nil(t, err)
+	ks.SetMetadata(md)
+
+	acc, err := ks.NewAccount("foo")
+	assert.Nil(t, err)
+	assert.Nil(t, md.Set(acc.Address, metadata.Metadata{Label: "savings"}))
+
+	// Trashed keys keep their metadata, deleted ones lose it
+	trashed, err := ks.Trash(acc, "foo", filepath.Join(dir, ".trash"))
+	assert.Nil(t, err)
+	_, ok := md.Get(acc.Address)
+	assert.True(t, ok)
+	acc, err = ks.Restore(trashed, "foo")
+	assert.Nil(t, err)
+	assert.Nil(t, ks.Delete(acc, "foo"))
+	_, ok = md.Get(acc.Address)
+	assert.False(t, ok)
 }
 
 func TestImportECDSA(t *testing.T) {
@@ -318,10 +545,30 @@ func TestImportPreSaleKey(t *testing.T) {
 	dir, ks := tmpKeyStore(t, true)
 	defer os.RemoveAll(dir)
 
-	keyJons := make([]byte, 20)
-
-	_, err := ks.ImportPreSaleKey(keyJons, "")
-	assert.Equal(t, nil, err)
+	keyJSON, err := ioutil.ReadFile("testdata/guswallet.json")
+	assert.Nil(t, err)
+
+	_, err = ks.ImportPreSaleKey(make([]byte, 20), "")
+	assert.NotNil(t, err)
+	_, err = ks.ImportPreSaleKey(keyJSON, "bar")
+	assert.Equal(t, ErrDecrypt, err)
+
+	acc, err := ks.ImportPreSaleKey(keyJSON, "foo")
+	assert.Nil(t, err)
+	assert.Equal(t, "0xd4584b5f6229b7be90727b0fc8c6b91bb427821f", strings.ToLower(acc.Address.Hex()))
+	assert.True(t, ks.HasAddress(acc.Address))
+	_, key, err := ks.GetDecryptedKey(acc, "foo")
+	assert.Nil(t, err)
+	assert.NotNil(t, key.Id)
+
+	_, err = ks.ImportPreSaleKey(keyJSON, "foo")
+	assert.Equal(t, ErrAccountAlreadyExists, err)
+
+	// A file recording another address is rejected
+	tampered := strings.Replace(string(keyJSON), "d4584b5f", "00000000", 1)
+	_, err = ks.ImportPreSaleKey([]byte(tampered), "foo")
+	assert.NotNil(t, err)
+	assert.Contains(t, err.Error(), "instead of the expected 000000006229b7be90727b0fc8c6b91bb427821f")
 }
 
 func tmpKeyStore(t *testing.T, encrypted bool) (string, *KeyStore) {
@@ -335,3 +582,92 @@ func tmpKeyStore(t *testing.T, encrypted bool) (string, *KeyStore) {
 	}
 	return d, new(string(d))
 }
+
+func TestWalletNotifications(t *testing.T) {
+	dir, ks := tmpKeyStore(t, true)
+	defer os.RemoveAll(dir)
+
+	events := make(chan accounts.WalletEvent, 4)
+	sub := ks.Subscribe(events)
+	defer sub.Unsubscribe()
+
+	account, err := ks.NewAccount("foo")
+	assert.Nil(t, err)
+	select {
+	case ev := <-events:
+		assert.Equal(t, accounts.WalletArrived, ev.Kind)
+		assert.True(t, ev.Wallet.Contains(account))
+	case <-time.After(time.Second):
+		t.Fatal("wallet arrival event not fired")
+	}
+
+	assert.Nil(t, ks.Delete(account, "foo"))
+	select {
+	case ev := <-events:
+		assert.Equal(t, accounts.WalletDropped, ev.Kind)
+		assert.Equal(t, account.URL, ev.Wallet.URL())
+	case <-time.After(time.Second):
+		t.Fatal("wallet drop event not fired")
+	}
+}
+
+func TestAuditLog(t *testing.T) {
+	dir, ks := tmpKeyStore(t, true)
+	defer os.RemoveAll(dir)
+
+	log, err := audit.Open(filepath.Join(dir, "audit", "audit.log"))
+	assert.Nil(t, err)
+	defer log.Close()
+	ks.SetAuditLog(log)
+
+	a, err := ks.NewAccount("foo")
+	assert.Nil(t, err)
+
+	_, err = ks.SignHash(a, testSigData)
+	assert.Equal(t, ErrLocked, err)
+	_, err = ks.SignHashWithPassphrase(a, "foo", testSigData)
+	assert.Nil(t, err)
+	tx := ctypes.NewTransaction(0, a.Address, big.NewInt(1), 21000, big.NewInt(1), nil, a.Address)
+	_, err = ks.SignTxWithPassphrase(a, "foo", tx, big.NewInt(1))
+	assert.Nil(t, err)
+	assert.Nil(t, ks.Update(a, "foo", "bar"))
+	assert.Equal(t, ErrDecrypt, ks.Delete(a, "foo"))
+
+	entries, err := audit.Read(filepath.Join(dir, "audit", "audit.log"))
+	assert.Nil(t, err)
+	assert.Nil(t, audit.Verify(entries))
+
+	var operations, outcomes []string
+	for _, entry := range entries {
+		assert.Equal(t, a.Address, entry.Account)
+		operations = append(operations, entry.Operation)
+		outcomes = append(outcomes, entry.Outcome)
+	}
+	assert.Equal(t, []string{audit.OpSignHash, audit.OpSignHashWithPassphrase, audit.OpSignTxWithPassphrase, audit.OpUpdate, audit.OpDelete}, operations)
+	assert.Equal(t, []string{ErrLocked.Error(), audit.OutcomeSuccess, audit.OutcomeSuccess, audit.OutcomeSuccess, ErrDecrypt.Error()}, outcomes)
+
+	signer := ctypes.NewEIP155Signer(big.NewInt(1))
+	assert.Equal(t, signer.Hash(tx), *entries[2].Hash)
+	assert.Equal(t, big.NewInt(1), entries[2].ChainID.ToInt())
+}
+
+func TestAuditLogFailure(t *testing.T) {
+	dir, ks := tmpKeyStore(t, true)
+	defer os.RemoveAll(dir)
+
+	log, err := audit.Open(filepath.Join(dir, "audit", "audit.log"))
+	assert.Nil(t, err)
+	ks.SetAuditLog(log)
+	a, err := ks.NewAccount("foo")
+	assert.Nil(t, err)
+
+	// Operations that cannot be recorded yield no result
+	log.Close()
+	sig, err := ks.SignHashWithPassphrase(a, "foo", testSigData)
+	assert.NotNil(t, err)
+	assert.Nil(t, sig)
+	priv, err := ks.ExportECDSA(a, "foo")
+	assert.NotNil(t, err)
+	assert.Nil(t, priv)
+	assert.NotNil(t, ks.Update(a, "foo", "bar"))
+}
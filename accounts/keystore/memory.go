@@ -0,0 +1,122 @@
+package keystore
+
+import (
+	"fmt"
+	"path/filepath"
+	"sort"
+	"sync"
+
+	"github.com/DSiSc/wallet/accounts"
+	"github.com/DSiSc/wallet/common"
+)
+
+// memoryDir is the virtual directory holding the keys of in-memory storages.
+var memoryDir = filepath.FromSlash("/memory")
+
+// storedKey is an encrypted key held by a storage that is not file based.
+type storedKey struct {
+	Address common.Address
+	JSON    []byte
+}
+
+// decrypt decrypts the key, making sure it belongs to the expected address.
+func (k storedKey) decrypt(addr common.Address, auth string) (*Key, error) {
+	key, err := DecryptKey(k.JSON, auth)
+	if err != nil {
+		return nil, err
+	}
+	// Make sure we're really operating on the requested key (no swap attacks)
+	if key.Address != addr {
+		return nil, fmt.Errorf("key content mismatch: have account %x, want %x", key.Address, addr)
+	}
+	return key, nil
+}
+
+// storedAccounts lists the accounts of the keys indexed by path.
+func storedAccounts(keys map[string]storedKey) []accounts.Account {
+	accs := make([]accounts.Account, 0, len(keys))
+	for path, key := range keys {
+		accs = append(accs, accounts.Account{Address: key.Address, URL: accounts.URL{Scheme: KeyStoreScheme, Path: path}})
+	}
+	sort.Sort(accountsByURL(accs))
+	return accs
+}
+
+// memoryStorage keeps the encrypted keys in memory only, so they are lost with
+// the process. It is meant for tests and throwaway accounts.
+type memoryStorage struct {
+	kdf  KDFConfig
+	keys map[string]storedKey // Encrypted keys by path
+
+	mu sync.RWMutex
+}
+
+// NewMemoryStorage creates an empty storage keeping the keys in memory.
+func NewMemoryStorage(kdf KDFConfig) Storage {
+	return &memoryStorage{
+		kdf:  kdf,
+		keys: make(map[string]storedKey),
+	}
+}
+
+func (ms *memoryStorage) GetKey(addr common.Address, filename, auth string) (*Key, error) {
+	ms.mu.RLock()
+	key, ok := ms.keys[filename]
+	ms.mu.RUnlock()
+
+	if !ok {
+		return nil, ErrNoMatch
+	}
+	return key.decrypt(addr, auth)
+}
+
+func (ms *memoryStorage) StoreKey(filename string, key *Key, auth string) error {
+	keyjson, err := ms.kdf.EncryptKey(key, auth)
+	if err != nil {
+		return err
+	}
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	ms.keys[filename] = storedKey{Address: key.Address, JSON: keyjson}
+	return nil
+}
+
+func (ms *memoryStorage) DeleteKey(filename string) error {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	if _, ok := ms.keys[filename]; !ok {
+		return ErrNoMatch
+	}
+	delete(ms.keys, filename)
+	return nil
+}
+
+func (ms *memoryStorage) JoinPath(filename string) string {
+	if filepath.IsAbs(filename) {
+		return filename
+	}
+	return filepath.Join(memoryDir, filename)
+}
+
+func (ms *memoryStorage) Accounts() ([]accounts.Account, error) {
+	ms.mu.RLock()
+	defer ms.mu.RUnlock()
+
+	return storedAccounts(ms.keys), nil
+}
+
+func (ms *memoryStorage) KDFConfig() KDFConfig {
+	return ms.kdf
+}
+
+func (ms *memoryStorage) KeyJSON(filename string) ([]byte, error) {
+	ms.mu.RLock()
+	defer ms.mu.RUnlock()
+
+	if key, ok := ms.keys[filename]; ok {
+		return key.JSON, nil
+	}
+	return nil, ErrNoMatch
+}
@@ -34,6 +34,7 @@ import (
 	"encoding/json"
 	"fmt"
 	"github.com/DSiSc/crypto-suite/crypto"
+	"github.com/DSiSc/wallet/accounts"
 	"github.com/DSiSc/wallet/common"
 	"github.com/DSiSc/wallet/common/math"
 	"github.com/pborman/uuid"
@@ -70,14 +71,20 @@ const (
 
 type keyStorePassphrase struct {
 	keysDirPath string
-	scryptN     int
-	scryptP     int
+	kdf         KDFConfig
 	// skipKeyFileVerification disables the security-feature which does
 	// reads and decrypts any newly created keyfiles. This should be 'false' in all
 	// cases except tests -- setting this to 'true' is not recommended.
 	skipKeyFileVerification bool
 }
 
+// NewFileStorage creates a storage keeping every key in its own file of keydir,
+// encrypted according to the Web3 Secret Storage specification.
+func NewFileStorage(keydir string, kdf KDFConfig) Storage {
+	keydir, _ = filepath.Abs(keydir)
+	return &keyStorePassphrase{keydir, kdf, false}
+}
+
 func (ks keyStorePassphrase) GetKey(addr common.Address, filename, auth string) (*Key, error) {
 	// Load the key from the keystore and decrypt its contents
 	keyjson, err := ioutil.ReadFile(filename)
@@ -97,12 +104,12 @@ func (ks keyStorePassphrase) GetKey(addr common.Address, filename, auth string)
 
 // StoreKey generates a key, encrypts with 'auth' and stores in the given directory
 func StoreKey(dir, auth string, scryptN, scryptP int) (common.Address, error) {
-	_, a, err := storeNewKey(&keyStorePassphrase{dir, scryptN, scryptP, false}, rand.Reader, auth)
+	_, a, err := storeNewKey(&keyStorePassphrase{dir, ScryptKDF(scryptN, scryptP), false}, rand.Reader, auth)
 	return a.Address, err
 }
 
 func (ks keyStorePassphrase) StoreKey(filename string, key *Key, auth string) error {
-	keyjson, err := EncryptKey(key, auth, ks.scryptN, ks.scryptP)
+	keyjson, err := ks.kdf.EncryptKey(key, auth)
 	if err != nil {
 		return err
 	}
@@ -127,6 +134,49 @@ func (ks keyStorePassphrase) StoreKey(filename string, key *Key, auth string) er
 	return os.Rename(tmpName, filename)
 }
 
+func (ks keyStorePassphrase) DeleteKey(filename string) error {
+	return os.Remove(filename)
+}
+
+func (ks keyStorePassphrase) Accounts() ([]accounts.Account, error) {
+	files, err := ioutil.ReadDir(ks.keysDirPath)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var accs []accounts.Account
+	for _, fi := range files {
+		if nonKeyFile(fi) {
+			continue
+		}
+		path := filepath.Join(ks.keysDirPath, fi.Name())
+		keyjson, err := ioutil.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		var key struct {
+			Address string `json:"address"`
+		}
+		if err := json.Unmarshal(keyjson, &key); err != nil {
+			continue
+		}
+		if addr := common.HexToAddress(key.Address); addr != (common.Address{}) {
+			accs = append(accs, accounts.Account{Address: addr, URL: accounts.URL{Scheme: KeyStoreScheme, Path: path}})
+		}
+	}
+	return accs, nil
+}
+
+func (ks keyStorePassphrase) KDFConfig() KDFConfig {
+	return ks.kdf
+}
+
+func (ks keyStorePassphrase) KeyJSON(filename string) ([]byte, error) {
+	return ioutil.ReadFile(filename)
+}
+
 func (ks keyStorePassphrase) JoinPath(filename string) string {
 	if filepath.IsAbs(filename) {
 		return filename
@@ -145,6 +195,19 @@ func EncryptDataV3(data, auth []byte, scryptN, scryptP int) (CryptoJSON, error)
 	if err != nil {
 		return CryptoJSON{}, err
 	}
+
+	scryptParamsJSON := make(map[string]interface{}, 5)
+	scryptParamsJSON["n"] = scryptN
+	scryptParamsJSON["r"] = scryptR
+	scryptParamsJSON["p"] = scryptP
+	scryptParamsJSON["dklen"] = scryptDKLen
+	scryptParamsJSON["salt"] = hex.EncodeToString(salt)
+
+	return encryptDataV3(data, derivedKey, keyHeaderKDF, scryptParamsJSON)
+}
+
+// encryptDataV3 encrypts the data with the key derived by the named KDF.
+func encryptDataV3(data, derivedKey []byte, kdf string, kdfParams map[string]interface{}) (CryptoJSON, error) {
 	encryptKey := derivedKey[:16]
 
 	iv := make([]byte, aes.BlockSize) // 16
@@ -157,12 +220,6 @@ func EncryptDataV3(data, auth []byte, scryptN, scryptP int) (CryptoJSON, error)
 	}
 	mac := crypto.Keccak256(derivedKey[16:32], cipherText)
 
-	scryptParamsJSON := make(map[string]interface{}, 5)
-	scryptParamsJSON["n"] = scryptN
-	scryptParamsJSON["r"] = scryptR
-	scryptParamsJSON["p"] = scryptP
-	scryptParamsJSON["dklen"] = scryptDKLen
-	scryptParamsJSON["salt"] = hex.EncodeToString(salt)
 	cipherParamsJSON := cipherparamsJSON{
 		IV: hex.EncodeToString(iv),
 	}
@@ -171,8 +228,8 @@ func EncryptDataV3(data, auth []byte, scryptN, scryptP int) (CryptoJSON, error)
 		Cipher:       "aes-128-ctr",
 		CipherText:   hex.EncodeToString(cipherText),
 		CipherParams: cipherParamsJSON,
-		KDF:          keyHeaderKDF,
-		KDFParams:    scryptParamsJSON,
+		KDF:          kdf,
+		KDFParams:    kdfParams,
 		MAC:          hex.EncodeToString(mac),
 	}
 	return cryptoStruct, nil
@@ -337,6 +394,9 @@ func getKDFKey(cryptoJSON CryptoJSON, auth string) ([]byte, error) {
 		}
 		key := pbkdf2.Key(authArray, salt, c, dkLen, sha256.New)
 		return key, nil
+
+	} else if cryptoJSON.KDF == keyHeaderKDFArgon2id {
+		return argon2Key(cryptoJSON.KDFParams, authArray, salt, dkLen)
 	}
 
 	return nil, fmt.Errorf("Unsupported KDF: %s", cryptoJSON.KDF)
@@ -1,6 +1,7 @@
 package keystore
 
 import (
+	"encoding/json"
 	"github.com/DSiSc/wallet/common"
 	"io/ioutil"
 	"testing"
@@ -11,6 +12,8 @@ const (
 	veryLightScryptP = 1
 )
 
+var veryLightArgon2 = Argon2Params{Time: 1, Memory: 64, Threads: 1}
+
 // Tests that a json key file can be decrypted and encrypted in multiple rounds.
 func TestKeyEncryptDecrypt(t *testing.T) {
 	keyjson, err := ioutil.ReadFile("testdata/very-light-scrypt.json")
@@ -41,3 +44,70 @@ func TestKeyEncryptDecrypt(t *testing.T) {
 		}
 	}
 }
+
+// Tests that keys encrypted with Argon2id are decrypted transparently.
+func TestKeyEncryptDecryptArgon2(t *testing.T) {
+	keyjson, err := ioutil.ReadFile("testdata/very-light-scrypt.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	key, err := DecryptKey(keyjson, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if keyjson, err = Argon2KDF(veryLightArgon2).EncryptKey(key, "foo"); err != nil {
+		t.Fatalf("failed to encrypt key: %v", err)
+	}
+	var encrypted encryptedKeyJSONV3
+	if err := json.Unmarshal(keyjson, &encrypted); err != nil {
+		t.Fatal(err)
+	}
+	if encrypted.Crypto.KDF != "argon2id" {
+		t.Errorf("kdf mismatch: have %q, want %q", encrypted.Crypto.KDF, "argon2id")
+	}
+	if _, err := DecryptKey(keyjson, "bar"); err != ErrDecrypt {
+		t.Errorf("decrypting with bad password: have %v, want %v", err, ErrDecrypt)
+	}
+	decrypted, err := DecryptKey(keyjson, "foo")
+	if err != nil {
+		t.Fatalf("failed to decrypt key: %v", err)
+	}
+	if decrypted.Address != key.Address {
+		t.Errorf("key address mismatch: have %x, want %x", decrypted.Address, key.Address)
+	}
+}
+
+// Tests that invalid Argon2id parameters are rejected instead of panicking.
+func TestArgon2InvalidParams(t *testing.T) {
+	for i, params := range []Argon2Params{
+		{Time: 0, Memory: 64, Threads: 1},
+		{Time: 1, Memory: 64, Threads: 0},
+		{Time: 1, Memory: 7, Threads: 1},
+	} {
+		if _, err := EncryptDataArgon2([]byte("data"), []byte("foo"), params); err == nil {
+			t.Errorf("test %d: encrypted with invalid params %+v", i, params)
+		}
+	}
+	cryptoJSON, err := EncryptDataArgon2([]byte("data"), []byte("foo"), veryLightArgon2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, tamper := range []func(map[string]interface{}){
+		func(p map[string]interface{}) { p["t"] = float64(0) },
+		func(p map[string]interface{}) { p["p"] = float64(0) },
+		func(p map[string]interface{}) { p["m"] = "64" },
+		func(p map[string]interface{}) { p["m"] = float64(1 << 30) },
+		func(p map[string]interface{}) { p["dklen"] = float64(16) },
+	} {
+		params := map[string]interface{}{
+			"t": float64(1), "m": float64(64), "p": float64(1),
+			"dklen": float64(32), "salt": cryptoJSON.KDFParams["salt"],
+		}
+		tamper(params)
+		tampered := cryptoJSON
+		tampered.KDFParams = params
+		if _, err := DecryptDataV3(tampered, "foo"); err == nil {
+			t.Errorf("test %d: decrypted with invalid params %v", i, params)
+		}
+	}
+}
@@ -25,31 +25,15 @@ import (
 	"errors"
 	"fmt"
 	"github.com/DSiSc/crypto-suite/crypto"
-	"github.com/DSiSc/wallet/accounts"
 	"github.com/DSiSc/wallet/common"
+	"strings"
 
 	"github.com/pborman/uuid"
 	"golang.org/x/crypto/pbkdf2"
 )
 
-// creates a Key and stores that in the given KeyStore by decrypting a presale key JSON
-func importPreSaleKey(keyStore keyStore, keyJSON []byte, password string) (accounts.Account, *Key, error) {
-	key, err := decryptPreSaleKey(keyJSON, password)
-	if err != nil {
-		return accounts.Account{}, nil, err
-	}
-	key.Id = uuid.NewRandom()
-	a := accounts.Account{
-		Address: common.Address(key.Address),
-		URL: accounts.URL{
-			Scheme: KeyStoreScheme,
-			Path:   keyStore.JoinPath(keyFileName(key.Address)),
-		},
-	}
-	err = keyStore.StoreKey(a.URL.Path, key, password)
-	return a, key, err
-}
-
+// decryptPreSaleKey decrypts a presale key JSON into a Key with a fresh id. The
+// address derived from the key must be the one recorded in the file.
 func decryptPreSaleKey(fileContent []byte, password string) (key *Key, err error) {
 	preSaleKeyStruct := struct {
 		EncSeed string
@@ -87,16 +71,16 @@ func decryptPreSaleKey(fileContent []byte, password string) (key *Key, err error
 	ecKey := crypto.ToECDSAUnsafe(ethPriv)
 
 	key = &Key{
-		Id:         nil,
+		Id:         uuid.NewRandom(),
 		Address:    common.Address(crypto.PubkeyToAddress(ecKey.PublicKey)),
 		PrivateKey: ecKey,
 	}
 	derivedAddr := hex.EncodeToString(key.Address.Bytes()) // needed because .Hex() gives leading "0x"
-	expectedAddr := preSaleKeyStruct.EthAddr
+	expectedAddr := strings.TrimPrefix(strings.ToLower(preSaleKeyStruct.EthAddr), "0x")
 	if derivedAddr != expectedAddr {
-		err = fmt.Errorf("decrypted addr '%s' not equal to expected addr '%s'", derivedAddr, expectedAddr)
+		return nil, fmt.Errorf("presale key decrypted to address %s instead of the expected %s, the password is wrong or the file corrupted", derivedAddr, expectedAddr)
 	}
-	return key, err
+	return key, nil
 }
 
 func aesCTRXOR(key, inText, iv []byte) ([]byte, error) {
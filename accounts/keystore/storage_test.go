@@ -0,0 +1,133 @@
+package keystore
+
+import (
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/DSiSc/wallet/accounts"
+	"github.com/stretchr/testify/assert"
+)
+
+func testStorage(t *testing.T, storage Storage) {
+	ks, err := NewKeyStoreWithStorage(storage)
+	assert.Nil(t, err)
+
+	a1, err := ks.NewAccount("foo")
+	assert.Nil(t, err)
+	a2, err := ks.NewAccount("bar")
+	assert.Nil(t, err)
+	assert.Equal(t, KeyStoreScheme, a1.URL.Scheme)
+	assert.True(t, ks.HasAddress(a1.Address))
+	assert.Equal(t, 2, len(ks.Accounts()))
+	assert.Equal(t, 2, len(ks.Wallets()))
+
+	accs, err := storage.Accounts()
+	assert.Nil(t, err)
+	assert.Equal(t, 2, len(accs))
+
+	// Keys can be used and updated through the keystore
+	assert.Nil(t, ks.Unlock(a1, "foo"))
+	_, err = ks.SignHash(accounts.Account{Address: a1.Address}, make([]byte, 32))
+	assert.Nil(t, err)
+	assert.Equal(t, ErrDecrypt, ks.Unlock(a2, "foo"))
+	assert.Nil(t, ks.Update(a2, "bar", "baz"))
+	assert.Nil(t, ks.Unlock(a2, "baz"))
+
+	// Deleted keys are gone from the storage
+	assert.Nil(t, ks.Delete(a1, "foo"))
+	assert.False(t, ks.HasAddress(a1.Address))
+	_, err = storage.GetKey(a1.Address, a1.URL.Path, "foo")
+	assert.NotNil(t, err)
+	assert.NotNil(t, storage.DeleteKey(a1.URL.Path))
+}
+
+func TestMemoryStorage(t *testing.T) {
+	testStorage(t, NewMemoryStorage(ScryptKDF(veryLightScryptN, veryLightScryptP)))
+}
+
+func TestMemoryStorageArgon2(t *testing.T) {
+	testStorage(t, NewMemoryStorage(Argon2KDF(veryLightArgon2)))
+}
+
+func TestFileStorage(t *testing.T) {
+	dir, err := ioutil.TempDir("", "keystore-storage-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	testStorage(t, NewFileStorage(dir, ScryptKDF(veryLightScryptN, veryLightScryptP)))
+}
+
+func TestDBStorage(t *testing.T) {
+	dir, err := ioutil.TempDir("", "keystore-storage-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "keys.db")
+
+	storage, err := NewDBStorage(path, ScryptKDF(veryLightScryptN, veryLightScryptP))
+	assert.Nil(t, err)
+	testStorage(t, storage)
+
+	// The database is kept for the storage until closed
+	_, err = NewDBStorage(path, ScryptKDF(veryLightScryptN, veryLightScryptP))
+	assert.Equal(t, ErrDatabaseInUse, err)
+	storage.(io.Closer).Close()
+
+	// Reopening replays the log: only the updated key survived
+	storage, err = NewDBStorage(path, ScryptKDF(veryLightScryptN, veryLightScryptP))
+	assert.Nil(t, err)
+	ks, err := NewKeyStoreWithStorage(storage)
+	assert.Nil(t, err)
+	accs := ks.Accounts()
+	assert.Equal(t, 1, len(accs))
+	assert.Nil(t, ks.Unlock(accs[0], "baz"))
+	storage.(io.Closer).Close()
+
+	// The stale records were compacted away
+	content, err := ioutil.ReadFile(path)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, countLines(content))
+
+	// A torn record left by an interrupted write is dropped
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0600)
+	assert.Nil(t, err)
+	f.Write([]byte(`{"path":"/torn","acc`))
+	f.Close()
+
+	storage, err = NewDBStorage(path, ScryptKDF(veryLightScryptN, veryLightScryptP))
+	assert.Nil(t, err)
+	ks, err = NewKeyStoreWithStorage(storage)
+	assert.Nil(t, err)
+	assert.Equal(t, accs, ks.Accounts())
+	_, err = ks.NewAccount("qux")
+	assert.Nil(t, err)
+	storage.(io.Closer).Close()
+
+	storage, err = NewDBStorage(path, ScryptKDF(veryLightScryptN, veryLightScryptP))
+	assert.Nil(t, err)
+	accs, err = storage.Accounts()
+	assert.Nil(t, err)
+	assert.Equal(t, 2, len(accs))
+	storage.(io.Closer).Close()
+
+	// Corruption within the log is reported
+	assert.Nil(t, ioutil.WriteFile(path, []byte("garbage\n"), 0600))
+	_, err = NewDBStorage(path, ScryptKDF(veryLightScryptN, veryLightScryptP))
+	assert.NotNil(t, err)
+}
+
+func countLines(content []byte) int {
+	lines := 0
+	for _, b := range content {
+		if b == '\n' {
+			lines++
+		}
+	}
+	return lines
+}
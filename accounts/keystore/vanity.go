@@ -0,0 +1,152 @@
+package keystore
+
+import (
+	crand "crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"math"
+	"regexp"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/DSiSc/wallet/accounts"
+	"github.com/DSiSc/wallet/common"
+)
+
+// vanityProgressInterval is the time between two progress reports of a vanity
+// search.
+const vanityProgressInterval = time.Second
+
+// VanityPattern selects addresses by their hex digits. All the parts given must
+// match, regardless of case.
+type VanityPattern struct {
+	Prefix string         // Leading hex digits, without 0x
+	Suffix string         // Trailing hex digits
+	Regexp *regexp.Regexp // Matched against the 40 lowercase hex digits
+}
+
+// NewVanityPattern checks the prefix and suffix and compiles the regular
+// expression of a pattern. Empty parts match any address.
+func NewVanityPattern(prefix, suffix, expr string) (*VanityPattern, error) {
+	p := &VanityPattern{
+		Prefix: strings.ToLower(strings.TrimPrefix(prefix, "0x")),
+		Suffix: strings.ToLower(suffix),
+	}
+	for _, part := range []string{p.Prefix, p.Suffix} {
+		if strings.Trim(part, "0123456789abcdef") != "" {
+			return nil, fmt.Errorf("%q is not hex", part)
+		}
+	}
+	if len(p.Prefix) > 2*common.AddressLength || len(p.Suffix) > 2*common.AddressLength {
+		return nil, fmt.Errorf("pattern longer than an address")
+	}
+	if expr != "" {
+		re, err := regexp.Compile(expr)
+		if err != nil {
+			return nil, err
+		}
+		p.Regexp = re
+	}
+	return p, nil
+}
+
+// Match reports whether the address fits the pattern.
+func (p *VanityPattern) Match(addr common.Address) bool {
+	digits := hex.EncodeToString(addr[:])
+	return strings.HasPrefix(digits, p.Prefix) && strings.HasSuffix(digits, p.Suffix) &&
+		(p.Regexp == nil || p.Regexp.MatchString(digits))
+}
+
+// Difficulty returns the average number of keys to generate for one match, or 0
+// when unknown because of the regular expression.
+func (p *VanityPattern) Difficulty() float64 {
+	if p.Regexp != nil {
+		return 0
+	}
+	return math.Pow(16, float64(len(p.Prefix)+len(p.Suffix)))
+}
+
+// VanityProgress reports the state of a running vanity search.
+type VanityProgress struct {
+	Attempts uint64        // Keys generated so far
+	Found    int           // Matches stored so far
+	Elapsed  time.Duration // Time since the start of the search
+}
+
+// NewVanityAccounts generates keys on the given number of goroutines until count
+// of them have addresses accepted by match. Every match is stored as soon as it
+// is found, encrypted with the passphrase, so an interrupted search keeps the
+// accounts found until then. The progress function, if any, is called every
+// second from the calling goroutine.
+func (ks *KeyStore) NewVanityAccounts(match func(common.Address) bool, count, workers int, passphrase string, progress func(VanityProgress)) ([]accounts.Account, error) {
+	if count < 1 || workers < 1 {
+		return nil, fmt.Errorf("invalid vanity search of %d keys on %d workers", count, workers)
+	}
+	var (
+		attempts uint64
+		found    = make(chan *Key)
+		errc     = make(chan error, workers)
+		quit     = make(chan struct{})
+		wg       sync.WaitGroup
+	)
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				select {
+				case <-quit:
+					return
+				default:
+				}
+				key, err := newKey(crand.Reader)
+				if err != nil {
+					errc <- err
+					return
+				}
+				atomic.AddUint64(&attempts, 1)
+				if !match(key.Address) {
+					continue
+				}
+				select {
+				case found <- key:
+				case <-quit:
+					zeroKey(key.PrivateKey)
+					return
+				}
+			}
+		}()
+	}
+	defer wg.Wait()
+	defer close(quit)
+
+	start := time.Now()
+	ticker := time.NewTicker(vanityProgressInterval)
+	defer ticker.Stop()
+
+	var accs []accounts.Account
+	for len(accs) < count {
+		select {
+		case key := <-found:
+			a, err := storeKey(ks.storage, key, passphrase)
+			zeroKey(key.PrivateKey)
+			if err != nil {
+				return accs, err
+			}
+			ks.cache.add(a)
+			ks.refreshWallets()
+			accs = append(accs, a)
+
+		case err := <-errc:
+			return accs, err
+
+		case <-ticker.C:
+			if progress != nil {
+				progress(VanityProgress{Attempts: atomic.LoadUint64(&attempts), Found: len(accs), Elapsed: time.Since(start)})
+			}
+		}
+	}
+	return accs, nil
+}
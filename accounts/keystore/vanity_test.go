@@ -0,0 +1,61 @@
+package keystore
+
+import (
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/DSiSc/wallet/common"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestVanityPattern(t *testing.T) {
+	addr := common.HexToAddress("0x00Ab8483F64d9C6d1EcF9b849Ae677dD3315835c")
+
+	tests := []struct {
+		prefix, suffix, expr string
+		match                bool
+	}{
+		{"", "", "", true},
+		{"0x00ab", "", "", true},
+		{"00AB", "835C", "", true},
+		{"01", "", "", false},
+		{"", "835d", "", false},
+		{"", "", "^00.*dd", true},
+		{"00", "", "^00ab0", false},
+	}
+	for _, test := range tests {
+		p, err := NewVanityPattern(test.prefix, test.suffix, test.expr)
+		assert.Nil(t, err)
+		assert.Equal(t, test.match, p.Match(addr), "%+v", test)
+	}
+
+	p, _ := NewVanityPattern("abc", "d", "")
+	assert.Equal(t, float64(65536), p.Difficulty())
+	p, _ = NewVanityPattern("", "", "^0")
+	assert.Equal(t, float64(0), p.Difficulty())
+
+	for _, bad := range [][]string{{"0xg", "", ""}, {"", "", "("}, {strings.Repeat("0", 41), "", ""}} {
+		_, err := NewVanityPattern(bad[0], bad[1], bad[2])
+		assert.NotNil(t, err, "%q", bad)
+	}
+}
+
+func TestNewVanityAccounts(t *testing.T) {
+	dir, ks := tmpKeyStore(t, true)
+	defer os.RemoveAll(dir)
+
+	p, err := NewVanityPattern("a", "", "")
+	assert.Nil(t, err)
+	accs, err := ks.NewVanityAccounts(p.Match, 2, 4, "foo", nil)
+	assert.Nil(t, err)
+	assert.Len(t, accs, 2)
+	for _, a := range accs {
+		assert.True(t, p.Match(a.Address))
+		assert.True(t, ks.HasAddress(a.Address))
+		assert.Nil(t, ks.Unlock(a, "foo"))
+	}
+
+	_, err = ks.NewVanityAccounts(p.Match, 0, 4, "foo", nil)
+	assert.NotNil(t, err)
+}
@@ -20,14 +20,20 @@ import (
 	"reflect"
 	"sort"
 	"sync"
+
+	"github.com/DSiSc/wallet/event"
 )
 
 // Manager is an overarching account manager that can communicate with various
 // backends for signing transactions.
 type Manager struct {
 	backends map[reflect.Type][]Backend // Index of backends currently registered
+	updaters []event.Subscription       // Wallet update subscriptions for all backends
+	updates  chan WalletEvent           // Subscription sink for backend wallet changes
 	wallets  []Wallet                   // Cache of all wallets from all registered backends
 
+	feed event.Feed // Wallet feed notifying of arrivals/departures
+
 	quit chan chan error
 	lock sync.RWMutex
 }
@@ -40,10 +46,18 @@ func NewManager(backends ...Backend) *Manager {
 	for _, backend := range backends {
 		wallets = merge(wallets, backend.Wallets()...)
 	}
+	// Subscribe to wallet notifications from all backends
+	updates := make(chan WalletEvent, 4*len(backends))
 
+	subs := make([]event.Subscription, len(backends))
+	for i, backend := range backends {
+		subs[i] = backend.Subscribe(updates)
+	}
 	// Assemble the account manager and return
 	am := &Manager{
 		backends: make(map[reflect.Type][]Backend),
+		updaters: subs,
+		updates:  updates,
 		wallets:  wallets,
 		quit:     make(chan chan error),
 	}
@@ -67,7 +81,38 @@ func (am *Manager) Close() error {
 // and updating the cache of wallets.
 func (am *Manager) update() {
 	// Close all subscriptions when the manager terminates
-
+	defer func() {
+		am.lock.Lock()
+		for _, sub := range am.updaters {
+			sub.Unsubscribe()
+		}
+		am.updaters = nil
+		am.lock.Unlock()
+	}()
+
+	// Loop until termination
+	for {
+		select {
+		case event := <-am.updates:
+			// Wallet event arrived, update local cache
+			am.lock.Lock()
+			switch event.Kind {
+			case WalletArrived:
+				am.wallets = merge(am.wallets, event.Wallet)
+			case WalletDropped:
+				am.wallets = drop(am.wallets, event.Wallet)
+			}
+			am.lock.Unlock()
+
+			// Notify any listeners of the event
+			am.feed.Send(event)
+
+		case errc := <-am.quit:
+			// Manager terminating, return
+			errc <- nil
+			return
+		}
+	}
 }
 
 // Backends retrieves the backend(s) with the given type from the account manager.
@@ -94,7 +139,7 @@ func (am *Manager) Wallet(url string) (Wallet, error) {
 	if err != nil {
 		return nil, err
 	}
-	for _, wallet := range am.Wallets() {
+	for _, wallet := range am.wallets {
 		if wallet.URL() == parsed {
 			return wallet, nil
 		}
@@ -117,6 +162,12 @@ func (am *Manager) Find(account Account) (Wallet, error) {
 	return nil, ErrUnknownAccount
 }
 
+// Subscribe creates an async subscription to receive notifications when the
+// manager detects the arrival or departure of a wallet from any of its backends.
+func (am *Manager) Subscribe(sink chan<- WalletEvent) event.Subscription {
+	return am.feed.Subscribe(sink)
+}
+
 // merge is a sorted analogue of append for wallets, where the ordering of the
 // origin list is preserved by inserting new wallets at the correct position.
 //
@@ -138,7 +189,7 @@ func merge(slice []Wallet, wallets ...Wallet) []Wallet {
 func drop(slice []Wallet, wallets ...Wallet) []Wallet {
 	for _, wallet := range wallets {
 		n := sort.Search(len(slice), func(i int) bool { return slice[i].URL().Cmp(wallet.URL()) >= 0 })
-		if n == len(slice) {
+		if n == len(slice) || slice[n].URL().Cmp(wallet.URL()) != 0 {
 			// Wallet not found, may happen during startup
 			continue
 		}
@@ -1,11 +1,13 @@
 package accounts
 
 import (
+	"github.com/DSiSc/wallet/event"
 	"github.com/cespare/cp"
 	"github.com/stretchr/testify/assert"
 	"io/ioutil"
 	"path/filepath"
 	"testing"
+	"time"
 )
 
 func tmpdir(t *testing.T) string {
@@ -66,3 +68,57 @@ func TestManager_Find(t *testing.T) {
 	_, err := mana.Find(acc)
 	assert.Equal(t, ErrUnknownAccount, err)
 }
+
+// testWallet is a wallet stub only identified by its URL.
+type testWallet struct {
+	Wallet
+	url URL
+}
+
+func (w *testWallet) URL() URL { return w.url }
+
+// testBackend is a backend stub whose wallet events are fired manually.
+type testBackend struct {
+	feed event.Feed
+}
+
+func (b *testBackend) Wallets() []Wallet { return nil }
+
+func (b *testBackend) Subscribe(sink chan<- WalletEvent) event.Subscription {
+	return b.feed.Subscribe(sink)
+}
+
+func TestManager_Subscribe(t *testing.T) {
+	backend := new(testBackend)
+	mana := NewManager(backend)
+
+	events := make(chan WalletEvent, 2)
+	sub := mana.Subscribe(events)
+	defer sub.Unsubscribe()
+
+	wallet := &testWallet{url: URL{Scheme: "test", Path: "wallet"}}
+	backend.feed.Send(WalletEvent{Wallet: wallet, Kind: WalletArrived})
+	select {
+	case ev := <-events:
+		assert.Equal(t, WalletArrived, ev.Kind)
+		assert.Equal(t, wallet.URL(), ev.Wallet.URL())
+	case <-time.After(time.Second):
+		t.Fatal("wallet arrival not forwarded")
+	}
+	assert.Len(t, mana.Wallets(), 1)
+
+	found, err := mana.Wallet("test://wallet")
+	assert.Nil(t, err)
+	assert.Equal(t, wallet.URL(), found.URL())
+
+	backend.feed.Send(WalletEvent{Wallet: wallet, Kind: WalletDropped})
+	select {
+	case ev := <-events:
+		assert.Equal(t, WalletDropped, ev.Kind)
+	case <-time.After(time.Second):
+		t.Fatal("wallet drop not forwarded")
+	}
+	assert.Len(t, mana.Wallets(), 0)
+
+	assert.Nil(t, mana.Close())
+}
@@ -0,0 +1,189 @@
+// Package metadata keeps descriptive information about accounts, such as human
+// readable labels, next to their keys.
+//
+// The store is a single JSON document mapping addresses to their metadata. It
+// is rewritten atomically on every change.
+package metadata
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/DSiSc/wallet/common"
+	"github.com/DSiSc/wallet/common/icap"
+)
+
+// FileName is the name of the metadata file within the keystore directory. It
+// is hidden so that the keystore does not take it for a key file.
+const FileName = ".metadata.json"
+
+// Metadata is the information kept about an account besides its key.
+type Metadata struct {
+	Label   string    `json:"label,omitempty"`   // Unique name the account can be referred to by
+	Tags    []string  `json:"tags,omitempty"`    // Free-form tags for grouping accounts
+	Created time.Time `json:"created"`           // Creation of the account, or of its metadata for accounts created elsewhere
+	Notes   string    `json:"notes,omitempty"`   // Free-form notes
+	ChainID uint64    `json:"chainId,omitempty"` // Default chain ID of the transactions of the account, 0 if unset
+}
+
+// Store holds the metadata of the accounts of a keystore.
+type Store struct {
+	path    string
+	entries map[common.Address]Metadata
+
+	mu sync.RWMutex
+}
+
+// Open loads the metadata file at path. A missing file is an empty store; it is
+// created by the first change.
+func Open(path string) (*Store, error) {
+	s := &Store{path: path, entries: make(map[common.Address]Metadata)}
+	content, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return s, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(content, &s.entries); err != nil {
+		return nil, fmt.Errorf("invalid account metadata file %s: %v", path, err)
+	}
+	return s, nil
+}
+
+// Get returns the metadata of the account.
+func (s *Store) Get(addr common.Address) (Metadata, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	md, ok := s.entries[addr]
+	return md, ok
+}
+
+// Lookup returns the account with the label, compared case-insensitively.
+func (s *Store) Lookup(label string) (common.Address, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	for addr, md := range s.entries {
+		if md.Label != "" && strings.EqualFold(md.Label, label) {
+			return addr, true
+		}
+	}
+	return common.Address{}, false
+}
+
+// Addresses returns the accounts having metadata, in ascending order.
+func (s *Store) Addresses() []common.Address {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	addrs := make([]common.Address, 0, len(s.entries))
+	for addr := range s.entries {
+		addrs = append(addrs, addr)
+	}
+	sort.Slice(addrs, func(i, j int) bool { return bytes.Compare(addrs[i][:], addrs[j][:]) < 0 })
+	return addrs
+}
+
+// Set replaces the metadata of the account. A zero creation time is set to the
+// current time, or kept from the previous metadata. The label must be unique
+// and must not be mistaken for an address or an account index.
+func (s *Store) Set(addr common.Address, md Metadata) error {
+	if err := ValidateLabel(md.Label); err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for other, omd := range s.entries {
+		if other != addr && md.Label != "" && strings.EqualFold(omd.Label, md.Label) {
+			return fmt.Errorf("label %q already used by account %x", md.Label, other)
+		}
+	}
+	if md.Created.IsZero() {
+		if prev, ok := s.entries[addr]; ok {
+			md.Created = prev.Created
+		} else {
+			md.Created = time.Now().UTC()
+		}
+	}
+	prev, existed := s.entries[addr]
+	s.entries[addr] = md
+	if err := s.save(); err != nil {
+		if existed {
+			s.entries[addr] = prev
+		} else {
+			delete(s.entries, addr)
+		}
+		return err
+	}
+	return nil
+}
+
+// Delete drops the metadata of the account.
+func (s *Store) Delete(addr common.Address) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	prev, ok := s.entries[addr]
+	if !ok {
+		return nil
+	}
+	delete(s.entries, addr)
+	if err := s.save(); err != nil {
+		s.entries[addr] = prev
+		return err
+	}
+	return nil
+}
+
+// save atomically replaces the metadata file with the current entries.
+func (s *Store) save() error {
+	content, err := json.MarshalIndent(s.entries, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(s.path), 0700); err != nil {
+		return err
+	}
+	f, err := ioutil.TempFile(filepath.Dir(s.path), "."+filepath.Base(s.path)+".tmp")
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(content); err != nil {
+		f.Close()
+		os.Remove(f.Name())
+		return err
+	}
+	f.Close()
+	return os.Rename(f.Name(), s.path)
+}
+
+// ValidateLabel checks that the label can refer to an account unambiguously. The
+// empty label, meaning none, is valid.
+func ValidateLabel(label string) error {
+	switch {
+	case label == "":
+		return nil
+	case strings.TrimSpace(label) != label:
+		return fmt.Errorf("label %q has surrounding spaces", label)
+	case common.IsHexAddress(label):
+		return fmt.Errorf("label %q is an address", label)
+	case icap.IsICAP(label):
+		return fmt.Errorf("label %q could be taken for an ICAP address", label)
+	}
+	if _, err := strconv.Atoi(label); err == nil {
+		return fmt.Errorf("label %q is an account index", label)
+	}
+	return nil
+}
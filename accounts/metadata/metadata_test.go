@@ -0,0 +1,89 @@
+package metadata
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/DSiSc/wallet/common"
+	"github.com/stretchr/testify/assert"
+)
+
+var (
+	testAddress1 = common.HexToAddress("0x1000000000000000000000000000000000000001")
+	testAddress2 = common.HexToAddress("0x2000000000000000000000000000000000000002")
+)
+
+func tmpStore(t *testing.T) (string, string) {
+	dir, err := ioutil.TempDir("", "metadata-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return dir, filepath.Join(dir, FileName)
+}
+
+func TestStore(t *testing.T) {
+	dir, path := tmpStore(t)
+	defer os.RemoveAll(dir)
+
+	s, err := Open(path)
+	assert.Nil(t, err)
+	_, ok := s.Get(testAddress1)
+	assert.False(t, ok)
+
+	assert.Nil(t, s.Set(testAddress1, Metadata{Label: "Savings", Tags: []string{"cold"}, ChainID: 18}))
+	assert.Nil(t, s.Set(testAddress2, Metadata{Notes: "hot wallet"}))
+	md, ok := s.Get(testAddress1)
+	assert.True(t, ok)
+	assert.False(t, md.Created.IsZero())
+	created := md.Created
+
+	// Labels are looked up case-insensitively and must be unique
+	addr, ok := s.Lookup("savings")
+	assert.True(t, ok)
+	assert.Equal(t, testAddress1, addr)
+	assert.NotNil(t, s.Set(testAddress2, Metadata{Label: "SAVINGS"}))
+
+	// Updates keep the creation time
+	md.Created = time.Time{}
+	md.Label = "Vault"
+	assert.Nil(t, s.Set(testAddress1, md))
+
+	// Reopening the store loads the saved metadata
+	s, err = Open(path)
+	assert.Nil(t, err)
+	md, ok = s.Get(testAddress1)
+	assert.True(t, ok)
+	assert.Equal(t, "Vault", md.Label)
+	assert.Equal(t, []string{"cold"}, md.Tags)
+	assert.Equal(t, uint64(18), md.ChainID)
+	assert.True(t, created.Equal(md.Created))
+	assert.Equal(t, []common.Address{testAddress1, testAddress2}, s.Addresses())
+	_, ok = s.Lookup("savings")
+	assert.False(t, ok)
+
+	assert.Nil(t, s.Delete(testAddress2))
+	s, err = Open(path)
+	assert.Nil(t, err)
+	assert.Equal(t, []common.Address{testAddress1}, s.Addresses())
+}
+
+func TestValidateLabel(t *testing.T) {
+	for _, label := range []string{"", "savings", "cold wallet", "0x12"} {
+		assert.Nil(t, ValidateLabel(label), label)
+	}
+	for _, label := range []string{" savings", "3", testAddress1.Hex(), "1000000000000000000000000000000000000001", "XE7338O073KYGTWWZN0F2WZ0R8PX5ZPPZS", "xerxes"} {
+		assert.NotNil(t, ValidateLabel(label), label)
+	}
+}
+
+func TestOpenInvalid(t *testing.T) {
+	dir, path := tmpStore(t)
+	defer os.RemoveAll(dir)
+
+	assert.Nil(t, ioutil.WriteFile(path, []byte("garbage"), 0600))
+	_, err := Open(path)
+	assert.NotNil(t, err)
+}
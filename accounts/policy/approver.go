@@ -0,0 +1,59 @@
+package policy
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/DSiSc/wallet/common"
+	"github.com/DSiSc/wallet/common/hexutil"
+)
+
+// TerminalApprover asks the user to confirm signing requests on a terminal.
+type TerminalApprover struct {
+	in  *bufio.Reader
+	out io.Writer
+}
+
+// NewTerminalApprover creates an approver printing requests to out and reading
+// the answers from in.
+func NewTerminalApprover(in io.Reader, out io.Writer) *TerminalApprover {
+	return &TerminalApprover{in: bufio.NewReader(in), out: out}
+}
+
+// Approve implements Approver, showing the request and waiting for the user to
+// confirm it. Anything but an explicit yes declines the request.
+func (a *TerminalApprover) Approve(req *Request) (bool, error) {
+	fmt.Fprintln(a.out, "-------- Signing request --------")
+	fmt.Fprintf(a.out, "Account:   %s\n", req.Account.Address.Hex())
+	if tx := req.Tx; tx != nil {
+		if tx.Data.Recipient == nil {
+			fmt.Fprintln(a.out, "To:        <contract creation>")
+		} else {
+			fmt.Fprintf(a.out, "To:        %s\n", common.Address(*tx.Data.Recipient).Hex())
+		}
+		fmt.Fprintf(a.out, "Value:     %v\n", req.Value())
+		fmt.Fprintf(a.out, "Nonce:     %d\n", tx.Data.AccountNonce)
+		fmt.Fprintf(a.out, "Gas:       %d\n", tx.Data.GasLimit)
+		fmt.Fprintf(a.out, "Gas price: %v\n", tx.Data.Price)
+		if req.ChainID != nil {
+			fmt.Fprintf(a.out, "Chain ID:  %v\n", req.ChainID)
+		} else {
+			fmt.Fprintln(a.out, "Chain ID:  <unprotected>")
+		}
+		if len(tx.Data.Payload) > 0 {
+			fmt.Fprintf(a.out, "Data:      %s\n", hexutil.Encode(tx.Data.Payload))
+		}
+	} else {
+		fmt.Fprintf(a.out, "Hash:      %s\n", hexutil.Encode(req.Hash))
+	}
+	fmt.Fprint(a.out, "Approve? [y/N] ")
+
+	answer, err := a.in.ReadString('\n')
+	if err != nil && answer == "" {
+		return false, err
+	}
+	answer = strings.ToLower(strings.TrimSpace(answer))
+	return answer == "y" || answer == "yes", nil
+}
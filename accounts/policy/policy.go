@@ -0,0 +1,219 @@
+// Package policy implements a rule engine guarding the signing operations of
+// account wallets. Every signing request is evaluated against a set of rules
+// before it reaches the underlying wallet; requests no rule decides on are
+// either approved automatically or handed to an interactive approver.
+package policy
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"sync"
+	"time"
+
+	"github.com/DSiSc/craft/types"
+	"github.com/DSiSc/wallet/accounts"
+	"github.com/DSiSc/wallet/common"
+	"github.com/DSiSc/wallet/common/hexutil"
+	"github.com/DSiSc/wallet/common/math"
+)
+
+// ErrNoApprover is returned when a request needs manual approval but the engine
+// has no approver to ask.
+var ErrNoApprover = errors.New("no approver available for request")
+
+// ErrDeclined is returned when the approver declines a request.
+var ErrDeclined = errors.New("declined by user")
+
+// RejectedError is returned for signing requests denied by the policy.
+type RejectedError struct {
+	Reason error
+}
+
+func (err *RejectedError) Error() string {
+	return "signing request rejected: " + err.Reason.Error()
+}
+
+// Decision is the verdict of a rule on a signing request.
+type Decision int
+
+const (
+	// Undecided leaves the request to the other rules and the approver.
+	Undecided Decision = iota
+	// Approve signs the request without asking the approver, unless another
+	// rule rejects it.
+	Approve
+	// Reject denies the request.
+	Reject
+)
+
+// Request describes a single signing operation.
+type Request struct {
+	Account accounts.Account
+	Tx      *types.Transaction // Transaction to sign, nil for hash signing
+	ChainID *big.Int           // Chain ID the transaction is signed for, nil if unprotected
+	Hash    []byte             // Hash to sign, nil for transaction signing
+}
+
+// Value returns the amount transferred by the request.
+func (req *Request) Value() *big.Int {
+	if req.Tx == nil || req.Tx.Data.Amount == nil {
+		return new(big.Int)
+	}
+	return req.Tx.Data.Amount
+}
+
+// Rule is a single check applied to signing requests. A rule returning Reject
+// must also return the reason for the rejection.
+type Rule interface {
+	Evaluate(req *Request) (Decision, error)
+}
+
+// Recorder is implemented by stateful rules that need to learn about the
+// requests that were signed, e.g. to enforce spending limits.
+type Recorder interface {
+	Record(req *Request)
+}
+
+// Approver is asked to decide on requests that no rule approved or rejected.
+type Approver interface {
+	Approve(req *Request) (bool, error)
+}
+
+// Config is the declarative form of a policy, usually loaded from a JSON file.
+type Config struct {
+	MaxValue           *math.HexOrDecimal256                    `json:"maxValue,omitempty"`           // Maximum value of a single transaction
+	DailyLimit         *math.HexOrDecimal256                    `json:"dailyLimit,omitempty"`         // Maximum value sent by any account within 24 hours
+	AccountDailyLimits map[common.Address]*math.HexOrDecimal256 `json:"accountDailyLimits,omitempty"` // Per account overrides of DailyLimit
+	AllowedRecipients  []common.Address                         `json:"allowedRecipients,omitempty"`  // Recipients transactions may be sent to
+	AllowedChainIDs    []uint64                                 `json:"allowedChainIds,omitempty"`    // Chain IDs transactions may be signed for
+	Payload            *PayloadConfig                           `json:"payload,omitempty"`            // Restrictions on transaction payloads
+	AutoApprove        bool                                     `json:"autoApprove"`                  // Sign requests passing all rules without asking
+}
+
+// PayloadConfig restricts the payload of transactions. Calls are matched by
+// the 4-byte method selector at the start of the payload.
+type PayloadConfig struct {
+	AllowCreate bool            `json:"allowCreate"`     // Whether contract creations may be signed
+	Allow       []hexutil.Bytes `json:"allow,omitempty"` // Selectors that may be called, any if empty
+	Deny        []hexutil.Bytes `json:"deny,omitempty"`  // Selectors that may never be called
+}
+
+// LoadConfig reads a policy from a JSON file.
+func LoadConfig(file string) (*Config, error) {
+	content, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	config := new(Config)
+	if err := json.Unmarshal(content, config); err != nil {
+		return nil, fmt.Errorf("invalid policy %s: %v", file, err)
+	}
+	return config, nil
+}
+
+// Engine evaluates signing requests against its rules. Requests are processed
+// one at a time, so stateful rules see a consistent history and the approver
+// is never asked about two requests at once.
+type Engine struct {
+	rules       []Rule
+	approver    Approver
+	autoApprove bool
+
+	mu sync.Mutex
+}
+
+// New creates an engine enforcing the given policy. The approver is asked about
+// requests that aren't decided by the rules and may be nil, in which case such
+// requests are rejected unless the policy approves them automatically.
+func New(config *Config, approver Approver) *Engine {
+	engine := &Engine{approver: approver, autoApprove: config.AutoApprove}
+	if config.MaxValue != nil {
+		engine.AddRule(&maxValueRule{max: (*big.Int)(config.MaxValue)})
+	}
+	if config.DailyLimit != nil || len(config.AccountDailyLimits) > 0 {
+		limits := make(map[common.Address]*big.Int, len(config.AccountDailyLimits))
+		for address, limit := range config.AccountDailyLimits {
+			limits[address] = (*big.Int)(limit)
+		}
+		engine.AddRule(newDailyLimitRule((*big.Int)(config.DailyLimit), limits, time.Now))
+	}
+	if config.AllowedRecipients != nil {
+		engine.AddRule(newRecipientRule(config.AllowedRecipients))
+	}
+	if config.AllowedChainIDs != nil {
+		engine.AddRule(newChainIDRule(config.AllowedChainIDs))
+	}
+	if config.Payload != nil {
+		engine.AddRule(newPayloadRule(config.Payload))
+	}
+	return engine
+}
+
+// AddRule appends a custom rule to the engine.
+func (e *Engine) AddRule(rule Rule) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	e.rules = append(e.rules, rule)
+}
+
+// Wallet wraps the wallet so that all its signing operations are subject to
+// the engine's rules.
+func (e *Engine) Wallet(wallet accounts.Wallet) accounts.Wallet {
+	return &guardedWallet{Wallet: wallet, engine: e}
+}
+
+// sign authorizes the request and runs the signing operation if allowed,
+// recording the request with the stateful rules once it succeeds.
+func (e *Engine) sign(req *Request, signer func() error) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if err := e.authorize(req); err != nil {
+		return err
+	}
+	if err := signer(); err != nil {
+		return err
+	}
+	for _, rule := range e.rules {
+		if recorder, ok := rule.(Recorder); ok {
+			recorder.Record(req)
+		}
+	}
+	return nil
+}
+
+// authorize evaluates the rules on the request, falling back to the approver if
+// none of them decides. Callers must hold e.mu.
+func (e *Engine) authorize(req *Request) error {
+	approved := e.autoApprove
+	for _, rule := range e.rules {
+		decision, err := rule.Evaluate(req)
+		switch decision {
+		case Reject:
+			if err == nil {
+				err = errors.New("denied by rule")
+			}
+			return &RejectedError{Reason: err}
+		case Approve:
+			approved = true
+		}
+	}
+	if approved {
+		return nil
+	}
+	if e.approver == nil {
+		return &RejectedError{Reason: ErrNoApprover}
+	}
+	ok, err := e.approver.Approve(req)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return &RejectedError{Reason: ErrDeclined}
+	}
+	return nil
+}
@@ -0,0 +1,222 @@
+package policy
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DSiSc/craft/types"
+	"github.com/DSiSc/wallet/accounts"
+	"github.com/DSiSc/wallet/common"
+	"github.com/DSiSc/wallet/common/hexutil"
+	"github.com/DSiSc/wallet/common/math"
+	local "github.com/DSiSc/wallet/core/types"
+	"github.com/stretchr/testify/assert"
+)
+
+var (
+	testAccount   = accounts.Account{Address: common.HexToAddress("0x1000000000000000000000000000000000000001")}
+	testRecipient = common.HexToAddress("0x2000000000000000000000000000000000000002")
+)
+
+// testWallet is a wallet stub counting the signatures it produces.
+type testWallet struct {
+	accounts.Wallet
+	signed int
+}
+
+func (w *testWallet) SignHash(account accounts.Account, hash []byte) ([]byte, error) {
+	w.signed++
+	return hash, nil
+}
+
+func (w *testWallet) SignTx(account accounts.Account, tx *types.Transaction, chainID *big.Int) (*types.Transaction, error) {
+	w.signed++
+	return tx, nil
+}
+
+func (w *testWallet) SignTxWithPassphrase(account accounts.Account, passphrase string, tx *types.Transaction, chainID *big.Int) (*types.Transaction, error) {
+	if passphrase != "foo" {
+		return nil, errors.New("could not decrypt key with given passphrase")
+	}
+	return w.SignTx(account, tx, chainID)
+}
+
+// testApprover answers every request with a fixed verdict.
+type testApprover struct {
+	approve bool
+	asked   int
+}
+
+func (a *testApprover) Approve(req *Request) (bool, error) {
+	a.asked++
+	return a.approve, nil
+}
+
+func newTx(to *common.Address, value int64, payload []byte) *types.Transaction {
+	tx := local.NewTransaction(0, common.Address{}, big.NewInt(value), 21000, big.NewInt(1), payload, testAccount.Address)
+	if to == nil {
+		tx.Data.Recipient = nil
+	} else {
+		tx.Data.Recipient = local.TypeConvert(to)
+	}
+	return tx
+}
+
+func bigValue(v int64) *math.HexOrDecimal256 {
+	return (*math.HexOrDecimal256)(big.NewInt(v))
+}
+
+func TestMaxValue(t *testing.T) {
+	wallet := New(&Config{MaxValue: bigValue(100), AutoApprove: true}, nil).Wallet(&testWallet{})
+
+	_, err := wallet.SignTx(testAccount, newTx(&testRecipient, 100, nil), nil)
+	assert.Nil(t, err)
+
+	_, err = wallet.SignTx(testAccount, newTx(&testRecipient, 101, nil), nil)
+	assert.IsType(t, &RejectedError{}, err)
+}
+
+func TestDailyLimit(t *testing.T) {
+	other := accounts.Account{Address: common.HexToAddress("0x3000000000000000000000000000000000000003")}
+	now := time.Now()
+	rule := newDailyLimitRule(big.NewInt(100), map[common.Address]*big.Int{other.Address: big.NewInt(10)}, func() time.Time { return now })
+	engine := New(&Config{AutoApprove: true}, nil)
+	engine.AddRule(rule)
+	stub := &testWallet{}
+	wallet := engine.Wallet(stub)
+
+	_, err := wallet.SignTx(testAccount, newTx(&testRecipient, 60, nil), nil)
+	assert.Nil(t, err)
+	_, err = wallet.SignTx(testAccount, newTx(&testRecipient, 50, nil), nil)
+	assert.IsType(t, &RejectedError{}, err)
+	_, err = wallet.SignTx(testAccount, newTx(&testRecipient, 40, nil), nil)
+	assert.Nil(t, err)
+
+	// Failed signatures don't count against the limit
+	_, err = wallet.SignTxWithPassphrase(other, "bar", newTx(&testRecipient, 10, nil), nil)
+	assert.NotNil(t, err)
+	_, err = wallet.SignTxWithPassphrase(other, "foo", newTx(&testRecipient, 10, nil), nil)
+	assert.Nil(t, err)
+	_, err = wallet.SignTx(other, newTx(&testRecipient, 1, nil), nil)
+	assert.IsType(t, &RejectedError{}, err)
+
+	// The window slides after a day
+	now = now.Add(dailyWindow)
+	_, err = wallet.SignTx(testAccount, newTx(&testRecipient, 100, nil), nil)
+	assert.Nil(t, err)
+	assert.Equal(t, 4, stub.signed)
+}
+
+func TestRecipients(t *testing.T) {
+	wallet := New(&Config{AllowedRecipients: []common.Address{testRecipient}, AutoApprove: true}, nil).Wallet(&testWallet{})
+
+	_, err := wallet.SignTx(testAccount, newTx(&testRecipient, 1, nil), nil)
+	assert.Nil(t, err)
+
+	_, err = wallet.SignTx(testAccount, newTx(&testAccount.Address, 1, nil), nil)
+	assert.IsType(t, &RejectedError{}, err)
+}
+
+func TestChainIDs(t *testing.T) {
+	wallet := New(&Config{AllowedChainIDs: []uint64{1}, AutoApprove: true}, nil).Wallet(&testWallet{})
+
+	_, err := wallet.SignTx(testAccount, newTx(&testRecipient, 1, nil), big.NewInt(1))
+	assert.Nil(t, err)
+
+	_, err = wallet.SignTx(testAccount, newTx(&testRecipient, 1, nil), big.NewInt(2))
+	assert.IsType(t, &RejectedError{}, err)
+
+	_, err = wallet.SignTx(testAccount, newTx(&testRecipient, 1, nil), nil)
+	assert.IsType(t, &RejectedError{}, err)
+}
+
+func TestPayload(t *testing.T) {
+	transfer := hexutil.MustDecode("0xa9059cbb")
+	approve := hexutil.MustDecode("0x095ea7b3")
+	config := &Config{
+		Payload:     &PayloadConfig{Allow: []hexutil.Bytes{transfer, approve}, Deny: []hexutil.Bytes{approve}},
+		AutoApprove: true,
+	}
+	wallet := New(config, nil).Wallet(&testWallet{})
+
+	_, err := wallet.SignTx(testAccount, newTx(&testRecipient, 0, append(transfer, 1, 2, 3)), nil)
+	assert.Nil(t, err)
+	_, err = wallet.SignTx(testAccount, newTx(&testRecipient, 1, nil), nil)
+	assert.Nil(t, err)
+
+	_, err = wallet.SignTx(testAccount, newTx(&testRecipient, 0, approve), nil)
+	assert.IsType(t, &RejectedError{}, err)
+	_, err = wallet.SignTx(testAccount, newTx(&testRecipient, 0, []byte{1, 2, 3, 4}), nil)
+	assert.IsType(t, &RejectedError{}, err)
+	_, err = wallet.SignTx(testAccount, newTx(nil, 0, []byte{0x60}), nil)
+	assert.IsType(t, &RejectedError{}, err)
+}
+
+func TestApprover(t *testing.T) {
+	approver := &testApprover{approve: true}
+	stub := &testWallet{}
+	wallet := New(&Config{MaxValue: bigValue(10)}, approver).Wallet(stub)
+
+	_, err := wallet.SignTx(testAccount, newTx(&testRecipient, 1, nil), nil)
+	assert.Nil(t, err)
+	_, err = wallet.SignHash(testAccount, make([]byte, 32))
+	assert.Nil(t, err)
+
+	// Rejected requests never reach the approver
+	_, err = wallet.SignTx(testAccount, newTx(&testRecipient, 11, nil), nil)
+	assert.IsType(t, &RejectedError{}, err)
+	assert.Equal(t, 2, approver.asked)
+
+	approver.approve = false
+	_, err = wallet.SignTx(testAccount, newTx(&testRecipient, 1, nil), nil)
+	assert.Equal(t, ErrDeclined, err.(*RejectedError).Reason)
+	assert.Equal(t, 2, stub.signed)
+
+	// Without approver undecided requests are rejected
+	wallet = New(&Config{}, nil).Wallet(stub)
+	_, err = wallet.SignTx(testAccount, newTx(&testRecipient, 1, nil), nil)
+	assert.Equal(t, ErrNoApprover, err.(*RejectedError).Reason)
+}
+
+func TestTerminalApprover(t *testing.T) {
+	var out bytes.Buffer
+	approver := NewTerminalApprover(strings.NewReader("y\nno\n"), &out)
+
+	ok, err := approver.Approve(&Request{Account: testAccount, Tx: newTx(&testRecipient, 1, nil), ChainID: big.NewInt(1)})
+	assert.Nil(t, err)
+	assert.True(t, ok)
+	assert.Contains(t, out.String(), testRecipient.Hex())
+
+	ok, err = approver.Approve(&Request{Account: testAccount, Hash: make([]byte, 32)})
+	assert.Nil(t, err)
+	assert.False(t, ok)
+
+	_, err = approver.Approve(&Request{Account: testAccount, Hash: make([]byte, 32)})
+	assert.NotNil(t, err)
+}
+
+func TestConfigJSON(t *testing.T) {
+	config := new(Config)
+	err := json.Unmarshal([]byte(`{
+		"maxValue": "0x10",
+		"dailyLimit": "100",
+		"accountDailyLimits": {"0x1000000000000000000000000000000000000001": "5"},
+		"allowedRecipients": ["0x2000000000000000000000000000000000000002"],
+		"allowedChainIds": [1, 2],
+		"payload": {"allowCreate": true, "deny": ["0xa9059cbb"]},
+		"autoApprove": true
+	}`), config)
+	assert.Nil(t, err)
+	assert.Equal(t, big.NewInt(16), (*big.Int)(config.MaxValue))
+	assert.Equal(t, big.NewInt(100), (*big.Int)(config.DailyLimit))
+	assert.Equal(t, big.NewInt(5), (*big.Int)(config.AccountDailyLimits[testAccount.Address]))
+	assert.Equal(t, []common.Address{testRecipient}, config.AllowedRecipients)
+	assert.Equal(t, []uint64{1, 2}, config.AllowedChainIDs)
+	assert.True(t, config.Payload.AllowCreate)
+	assert.True(t, config.AutoApprove)
+}
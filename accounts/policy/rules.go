@@ -0,0 +1,198 @@
+package policy
+
+import (
+	"bytes"
+	"fmt"
+	"math/big"
+	"time"
+
+	"github.com/DSiSc/wallet/common"
+	"github.com/DSiSc/wallet/common/hexutil"
+)
+
+// dailyWindow is the period over which daily limits are enforced.
+const dailyWindow = 24 * time.Hour
+
+// selectorLength is the length of the method selector prefixing call payloads.
+const selectorLength = 4
+
+// maxValueRule rejects transactions sending more than a fixed amount.
+type maxValueRule struct {
+	max *big.Int
+}
+
+func (r *maxValueRule) Evaluate(req *Request) (Decision, error) {
+	if value := req.Value(); value.Cmp(r.max) > 0 {
+		return Reject, fmt.Errorf("value %v exceeds the per transaction maximum of %v", value, r.max)
+	}
+	return Undecided, nil
+}
+
+// spend is a value sent by an account at a given time.
+type spend struct {
+	time  time.Time
+	value *big.Int
+}
+
+// dailyLimitRule rejects transactions that would push the total value sent by
+// an account within the last 24 hours over its limit. The history is kept in
+// memory only.
+type dailyLimitRule struct {
+	limit    *big.Int                    // Limit applied to accounts without an explicit one, nil for none
+	accounts map[common.Address]*big.Int // Per account limits
+	spends   map[common.Address][]spend  // Values sent within the current window
+	now      func() time.Time
+}
+
+func newDailyLimitRule(limit *big.Int, accounts map[common.Address]*big.Int, now func() time.Time) *dailyLimitRule {
+	return &dailyLimitRule{
+		limit:    limit,
+		accounts: accounts,
+		spends:   make(map[common.Address][]spend),
+		now:      now,
+	}
+}
+
+// limitOf returns the daily limit of the address, or nil if it is unlimited.
+func (r *dailyLimitRule) limitOf(address common.Address) *big.Int {
+	if limit, ok := r.accounts[address]; ok {
+		return limit
+	}
+	return r.limit
+}
+
+// spent drops the expired history of the address and returns the value sent
+// within the current window.
+func (r *dailyLimitRule) spent(address common.Address) *big.Int {
+	cutoff := r.now().Add(-dailyWindow)
+	spends := r.spends[address]
+	for len(spends) > 0 && !spends[0].time.After(cutoff) {
+		spends = spends[1:]
+	}
+	r.spends[address] = spends
+
+	total := new(big.Int)
+	for _, s := range spends {
+		total.Add(total, s.value)
+	}
+	return total
+}
+
+func (r *dailyLimitRule) Evaluate(req *Request) (Decision, error) {
+	limit := r.limitOf(req.Account.Address)
+	if req.Tx == nil || limit == nil {
+		return Undecided, nil
+	}
+	total := r.spent(req.Account.Address)
+	if total.Add(total, req.Value()).Cmp(limit) > 0 {
+		return Reject, fmt.Errorf("value %v exceeds the remaining daily limit of account %s", req.Value(), req.Account.Address.Hex())
+	}
+	return Undecided, nil
+}
+
+func (r *dailyLimitRule) Record(req *Request) {
+	if req.Tx == nil || req.Value().Sign() == 0 {
+		return
+	}
+	address := req.Account.Address
+	r.spends[address] = append(r.spends[address], spend{time: r.now(), value: new(big.Int).Set(req.Value())})
+}
+
+// recipientRule rejects transactions to recipients outside of an allow list.
+// Contract creations have no recipient and are left to the payload rule.
+type recipientRule struct {
+	allowed map[common.Address]bool
+}
+
+func newRecipientRule(recipients []common.Address) *recipientRule {
+	allowed := make(map[common.Address]bool, len(recipients))
+	for _, recipient := range recipients {
+		allowed[recipient] = true
+	}
+	return &recipientRule{allowed: allowed}
+}
+
+func (r *recipientRule) Evaluate(req *Request) (Decision, error) {
+	if req.Tx == nil || req.Tx.Data.Recipient == nil {
+		return Undecided, nil
+	}
+	if to := common.Address(*req.Tx.Data.Recipient); !r.allowed[to] {
+		return Reject, fmt.Errorf("recipient %s is not allowed", to.Hex())
+	}
+	return Undecided, nil
+}
+
+// chainIDRule rejects transactions signed for chains outside of an allow list,
+// including unprotected transactions.
+type chainIDRule struct {
+	allowed map[uint64]bool
+}
+
+func newChainIDRule(chainIDs []uint64) *chainIDRule {
+	allowed := make(map[uint64]bool, len(chainIDs))
+	for _, id := range chainIDs {
+		allowed[id] = true
+	}
+	return &chainIDRule{allowed: allowed}
+}
+
+func (r *chainIDRule) Evaluate(req *Request) (Decision, error) {
+	if req.Tx == nil {
+		return Undecided, nil
+	}
+	if req.ChainID == nil {
+		return Reject, fmt.Errorf("unprotected transactions are not allowed")
+	}
+	if !req.ChainID.IsUint64() || !r.allowed[req.ChainID.Uint64()] {
+		return Reject, fmt.Errorf("chain ID %v is not allowed", req.ChainID)
+	}
+	return Undecided, nil
+}
+
+// payloadRule restricts contract creations and the methods called by
+// transaction payloads.
+type payloadRule struct {
+	allowCreate bool
+	allow       []hexutil.Bytes
+	deny        []hexutil.Bytes
+}
+
+func newPayloadRule(config *PayloadConfig) *payloadRule {
+	return &payloadRule{allowCreate: config.AllowCreate, allow: config.Allow, deny: config.Deny}
+}
+
+func (r *payloadRule) Evaluate(req *Request) (Decision, error) {
+	if req.Tx == nil {
+		return Undecided, nil
+	}
+	payload := req.Tx.Data.Payload
+	if req.Tx.Data.Recipient == nil {
+		if !r.allowCreate {
+			return Reject, fmt.Errorf("contract creation is not allowed")
+		}
+		return Undecided, nil
+	}
+	if len(payload) == 0 {
+		return Undecided, nil
+	}
+	selector := payload
+	if len(selector) > selectorLength {
+		selector = selector[:selectorLength]
+	}
+	if containsSelector(r.deny, selector) {
+		return Reject, fmt.Errorf("method %s is denied", hexutil.Encode(selector))
+	}
+	if len(r.allow) > 0 && !containsSelector(r.allow, selector) {
+		return Reject, fmt.Errorf("method %s is not allowed", hexutil.Encode(selector))
+	}
+	return Undecided, nil
+}
+
+func containsSelector(selectors []hexutil.Bytes, selector []byte) bool {
+	for _, s := range selectors {
+		if bytes.Equal(s, selector) {
+			return true
+		}
+	}
+	return false
+}
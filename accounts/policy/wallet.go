@@ -0,0 +1,54 @@
+package policy
+
+import (
+	"math/big"
+
+	"github.com/DSiSc/craft/types"
+	"github.com/DSiSc/wallet/accounts"
+)
+
+// guardedWallet wraps an accounts.Wallet, submitting every signing operation
+// to the policy engine before delegating it to the wrapped wallet.
+type guardedWallet struct {
+	accounts.Wallet
+	engine *Engine
+}
+
+// SignHash implements accounts.Wallet, signing the hash if the policy allows it.
+func (w *guardedWallet) SignHash(account accounts.Account, hash []byte) (signature []byte, err error) {
+	err = w.engine.sign(&Request{Account: account, Hash: hash}, func() error {
+		signature, err = w.Wallet.SignHash(account, hash)
+		return err
+	})
+	return signature, err
+}
+
+// SignTx implements accounts.Wallet, signing the transaction if the policy
+// allows it.
+func (w *guardedWallet) SignTx(account accounts.Account, tx *types.Transaction, chainID *big.Int) (signed *types.Transaction, err error) {
+	err = w.engine.sign(&Request{Account: account, Tx: tx, ChainID: chainID}, func() error {
+		signed, err = w.Wallet.SignTx(account, tx, chainID)
+		return err
+	})
+	return signed, err
+}
+
+// SignHashWithPassphrase implements accounts.Wallet, signing the hash if the
+// policy allows it.
+func (w *guardedWallet) SignHashWithPassphrase(account accounts.Account, passphrase string, hash []byte) (signature []byte, err error) {
+	err = w.engine.sign(&Request{Account: account, Hash: hash}, func() error {
+		signature, err = w.Wallet.SignHashWithPassphrase(account, passphrase, hash)
+		return err
+	})
+	return signature, err
+}
+
+// SignTxWithPassphrase implements accounts.Wallet, signing the transaction if
+// the policy allows it.
+func (w *guardedWallet) SignTxWithPassphrase(account accounts.Account, passphrase string, tx *types.Transaction, chainID *big.Int) (signed *types.Transaction, err error) {
+	err = w.engine.sign(&Request{Account: account, Tx: tx, ChainID: chainID}, func() error {
+		signed, err = w.Wallet.SignTxWithPassphrase(account, passphrase, tx, chainID)
+		return err
+	})
+	return signed, err
+}
@@ -0,0 +1,230 @@
+// Package shamir implements Shamir's secret sharing over GF(2^8), to back up a
+// key as N shares of which any M rebuild it while fewer reveal nothing.
+//
+// Every byte of the secret is the constant term of its own random polynomial of
+// degree M-1; share i holds the values of the polynomials at x = i. Shares are
+// written as printable text carrying a checksum, so that typing mistakes are
+// caught before the secret is rebuilt.
+//
+// Shares also carry a public identifier of their secret, so that shares of
+// different secrets are not mixed up. It must not be derived from the secret
+// alone, which would tell every holder something about it: the address of a
+// key is fine, a hash of the key is not. Callers check that the rebuilt secret
+// matches the identifier, as only they know how.
+package shamir
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/DSiSc/crypto-suite/crypto"
+)
+
+// MaxShares is the largest number of shares of a secret, as share indexes are
+// the non-zero elements of GF(2^8).
+const MaxShares = 255
+
+// sharePrefix starts the text form of the shares, giving its version.
+const sharePrefix = "wshare1"
+
+var (
+	// ErrTooFewShares is returned by Combine when given fewer shares than the
+	// threshold.
+	ErrTooFewShares = errors.New("too few shares to rebuild the secret")
+
+	// ErrMixedShares is returned by Combine when the shares belong to different
+	// secrets.
+	ErrMixedShares = errors.New("shares of different secrets")
+
+	// ErrNotShare is returned by ParseShare when the text is not a share at all.
+	ErrNotShare = errors.New("not a share")
+
+	// ErrBadChecksum is returned by ParseShare when the text was altered.
+	ErrBadChecksum = errors.New("share checksum mismatch, check for typing mistakes")
+)
+
+// Share is one share of a secret.
+type Share struct {
+	Threshold int    // Number of shares needed to rebuild the secret
+	Index     byte   // Point of the polynomials, from 1
+	ID        []byte // Public identifier of the secret
+	Value     []byte // Values of the polynomials at Index
+}
+
+// Split splits the secret into n shares of which any threshold rebuild it. The
+// shares carry the public identifier of the secret.
+func Split(secret, id []byte, threshold, n int) ([]Share, error) {
+	return split(rand.Reader, secret, id, threshold, n)
+}
+
+func split(rand io.Reader, secret, id []byte, threshold, n int) ([]Share, error) {
+	switch {
+	case len(secret) == 0:
+		return nil, errors.New("empty secret")
+	case len(id) == 0:
+		return nil, errors.New("empty secret identifier")
+	case threshold < 2:
+		return nil, fmt.Errorf("threshold %d, want at least 2", threshold)
+	case n < threshold:
+		return nil, fmt.Errorf("%d shares, want at least the threshold %d", n, threshold)
+	case n > MaxShares:
+		return nil, fmt.Errorf("%d shares, want at most %d", n, MaxShares)
+	}
+	shares := make([]Share, n)
+	for i := range shares {
+		shares[i] = Share{Threshold: threshold, Index: byte(i + 1), ID: id, Value: make([]byte, len(secret))}
+	}
+	coeffs := make([]byte, threshold)
+	defer zero(coeffs)
+	for j, b := range secret {
+		coeffs[0] = b
+		if _, err := io.ReadFull(rand, coeffs[1:]); err != nil {
+			return nil, err
+		}
+		for i := range shares {
+			shares[i].Value[j] = evaluate(coeffs, shares[i].Index)
+		}
+	}
+	return shares, nil
+}
+
+// Combine rebuilds the secret from at least threshold shares of it. A share
+// corrupted without breaking its checksum yields a wrong secret, which the
+// caller detects by checking it against the identifier of the shares.
+func Combine(shares []Share) ([]byte, error) {
+	if len(shares) == 0 {
+		return nil, ErrTooFewShares
+	}
+	first := shares[0]
+	seen := make(map[byte]bool)
+	for _, share := range shares {
+		if share.Threshold != first.Threshold || !bytes.Equal(share.ID, first.ID) || len(share.Value) != len(first.Value) {
+			return nil, ErrMixedShares
+		}
+		if share.Index == 0 {
+			return nil, errors.New("invalid share index 0")
+		}
+		if seen[share.Index] {
+			return nil, fmt.Errorf("share %d given twice", share.Index)
+		}
+		seen[share.Index] = true
+	}
+	if len(shares) < first.Threshold {
+		return nil, ErrTooFewShares
+	}
+	shares = shares[:first.Threshold]
+
+	// Lagrange interpolation at x = 0.
+	secret := make([]byte, len(first.Value))
+	for i, share := range shares {
+		basis := byte(1)
+		for j, other := range shares {
+			if i != j {
+				basis = mul(basis, div(other.Index, other.Index^share.Index))
+			}
+		}
+		for k, y := range share.Value {
+			secret[k] ^= mul(y, basis)
+		}
+	}
+	return secret, nil
+}
+
+// String returns the text form of the share:
+//
+//	wshare1-<threshold>-<index>-<id>-<value>-<checksum>
+//
+// where the checksum is the leading 4 bytes of the keccak256 hash of the text
+// before it.
+func (s Share) String() string {
+	body := fmt.Sprintf("%s-%d-%d-%x-%x", sharePrefix, s.Threshold, s.Index, s.ID, s.Value)
+	return fmt.Sprintf("%s-%x", body, crypto.Keccak256([]byte(body))[:4])
+}
+
+// ParseShare parses the text form of a share, ignoring surrounding space.
+func ParseShare(text string) (Share, error) {
+	text = strings.TrimSpace(text)
+	parts := strings.Split(text, "-")
+	if len(parts) != 6 || parts[0] != sharePrefix {
+		return Share{}, ErrNotShare
+	}
+	body := text[:strings.LastIndex(text, "-")]
+	if checksum, err := hex.DecodeString(parts[5]); err != nil || !bytes.Equal(checksum, crypto.Keccak256([]byte(body))[:4]) {
+		return Share{}, ErrBadChecksum
+	}
+	threshold, err := strconv.Atoi(parts[1])
+	if err != nil || threshold < 2 || threshold > MaxShares {
+		return Share{}, fmt.Errorf("invalid share threshold %q", parts[1])
+	}
+	index, err := strconv.ParseUint(parts[2], 10, 8)
+	if err != nil || index == 0 {
+		return Share{}, fmt.Errorf("invalid share index %q", parts[2])
+	}
+	id, err := hex.DecodeString(parts[3])
+	if err != nil || len(id) == 0 {
+		return Share{}, fmt.Errorf("invalid share identifier %q", parts[3])
+	}
+	value, err := hex.DecodeString(parts[4])
+	if err != nil || len(value) == 0 {
+		return Share{}, errors.New("invalid share value")
+	}
+	return Share{Threshold: threshold, Index: byte(index), ID: id, Value: value}, nil
+}
+
+// evaluate returns the value of the polynomial at x, by Horner's rule.
+func evaluate(coeffs []byte, x byte) byte {
+	var y byte
+	for i := len(coeffs) - 1; i >= 0; i-- {
+		y = mul(y, x) ^ coeffs[i]
+	}
+	return y
+}
+
+// Logarithm and exponential tables of GF(2^8) with the AES polynomial
+// x^8 + x^4 + x^3 + x + 1, for the generator 3.
+var (
+	expTable [510]byte
+	logTable [256]byte
+)
+
+func init() {
+	x := byte(1)
+	for i := 0; i < 255; i++ {
+		expTable[i], expTable[i+255] = x, x
+		logTable[x] = byte(i)
+		// x *= 3
+		hi := x & 0x80
+		x2 := x << 1
+		if hi != 0 {
+			x2 ^= 0x1b
+		}
+		x ^= x2
+	}
+}
+
+func mul(a, b byte) byte {
+	if a == 0 || b == 0 {
+		return 0
+	}
+	return expTable[int(logTable[a])+int(logTable[b])]
+}
+
+// div divides by a non-zero b.
+func div(a, b byte) byte {
+	if a == 0 {
+		return 0
+	}
+	return expTable[int(logTable[a])+255-int(logTable[b])]
+}
+
+func zero(b []byte) {
+	for i := range b {
+		b[i] = 0
+	}
+}
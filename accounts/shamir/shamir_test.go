@@ -0,0 +1,91 @@
+package shamir
+
+import (
+	"bytes"
+	"encoding/hex"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestField(t *testing.T) {
+	for a := 1; a < 256; a++ {
+		for b := 1; b < 256; b++ {
+			if div(mul(byte(a), byte(b)), byte(b)) != byte(a) {
+				t.Fatalf("%d * %d / %d != %d", a, b, b, a)
+			}
+		}
+	}
+	// 0x57 * 0x83 = 0xc1 in the AES field
+	assert.Equal(t, byte(0xc1), mul(0x57, 0x83))
+}
+
+func TestSplitCombine(t *testing.T) {
+	secret, id := []byte("correct horse battery staple, 32"), []byte("horse")
+	shares, err := Split(secret, id, 3, 5)
+	assert.Nil(t, err)
+	assert.Len(t, shares, 5)
+
+	// Any 3 shares rebuild the secret
+	for _, subset := range [][]int{{0, 1, 2}, {4, 2, 0}, {1, 3, 4}, {0, 1, 2, 3, 4}} {
+		var some []Share
+		for _, i := range subset {
+			some = append(some, shares[i])
+		}
+		rebuilt, err := Combine(some)
+		assert.Nil(t, err)
+		assert.Equal(t, secret, rebuilt)
+	}
+
+	_, err = Combine(shares[:2])
+	assert.Equal(t, ErrTooFewShares, err)
+	_, err = Combine([]Share{shares[0], shares[0], shares[1]})
+	assert.NotNil(t, err)
+
+	other, err := Split(secret, []byte("battery"), 3, 5)
+	assert.Nil(t, err)
+	assert.False(t, bytes.Equal(shares[0].Value, other[0].Value))
+	_, err = Combine([]Share{shares[0], shares[1], other[2]})
+	assert.Equal(t, ErrMixedShares, err)
+
+	// Shares reveal nothing of the secret but its length
+	for _, share := range shares {
+		assert.NotContains(t, share.String(), hex.EncodeToString(secret[:4]))
+	}
+
+	// Corrupted values yield another secret, for the caller to reject
+	shares[1].Value[0] ^= 1
+	rebuilt, err := Combine(shares[:3])
+	assert.Nil(t, err)
+	assert.NotEqual(t, secret, rebuilt)
+}
+
+func TestSplitErrors(t *testing.T) {
+	for _, test := range []struct{ threshold, n int }{{1, 3}, {3, 2}, {2, 256}} {
+		_, err := Split([]byte{1}, []byte{2}, test.threshold, test.n)
+		assert.NotNil(t, err, "%d of %d", test.threshold, test.n)
+	}
+	_, err := Split(nil, []byte{2}, 2, 3)
+	assert.NotNil(t, err)
+	_, err = Split([]byte{1}, nil, 2, 3)
+	assert.NotNil(t, err)
+}
+
+func TestShareText(t *testing.T) {
+	share := Share{Threshold: 2, Index: 3, ID: []byte{0xde, 0xad, 0xbe, 0xef}, Value: []byte{0x01, 0x02}}
+	text := share.String()
+	assert.Equal(t, "wshare1-2-3-deadbeef-0102-", text[:len(text)-8])
+
+	parsed, err := ParseShare(" " + text + "\n")
+	assert.Nil(t, err)
+	assert.Equal(t, share, parsed)
+
+	// A typing mistake anywhere breaks the checksum
+	typo := []byte(text)
+	typo[16] = 'c'
+	_, err = ParseShare(string(typo))
+	assert.Equal(t, ErrBadChecksum, err)
+
+	_, err = ParseShare("wshare2-2-3-deadbeef-0102-00000000")
+	assert.NotNil(t, err)
+}
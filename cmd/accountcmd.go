@@ -1,13 +1,27 @@
 package cmd
 
 import (
+	"crypto/ecdsa"
+	"encoding/hex"
+	"encoding/json"
 	"fmt"
 	"github.com/DSiSc/crypto-suite/crypto"
 	"github.com/DSiSc/wallet/accounts"
 	"github.com/DSiSc/wallet/accounts/keystore"
+	"github.com/DSiSc/wallet/accounts/metadata"
+	"github.com/DSiSc/wallet/accounts/shamir"
+	"github.com/DSiSc/wallet/common"
 	"github.com/DSiSc/wallet/utils"
 	"github.com/urfave/cli"
+	"golang.org/x/crypto/ssh/terminal"
+	"io"
+	"io/ioutil"
+	"math"
+	"os"
 	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
 )
 
 var (
@@ -25,6 +39,8 @@ account, create a new account or update an existing account.`,
 				Flags: []cli.Flag{
 					utils.DataDirFlag,
 					utils.KeyStoreDirFlag,
+					utils.KeyStoreBackendFlag,
+					utils.OutputFlag,
 				},
 				Description: `Print a short summary of all accounts`,
 			},
@@ -35,11 +51,72 @@ account, create a new account or update an existing account.`,
 				Flags: []cli.Flag{
 					utils.DataDirFlag,
 					utils.KeyStoreDirFlag,
+					utils.KeyStoreBackendFlag,
+					utils.OutputFlag,
 					utils.PasswordFileFlag,
+					utils.PasswordFDFlag,
+					utils.PasswordHelperFlag,
 					utils.LightKDFFlag,
+					utils.KDFFlag,
+					utils.Argon2TimeFlag,
+					utils.Argon2MemoryFlag,
+					utils.Argon2ThreadsFlag,
+					utils.LabelFlag,
 				},
 				Description: `geth account new`,
 			},
+			{
+				Name:   "vanity",
+				Usage:  "Create accounts with chosen address patterns",
+				Action: utils.MigrateFlags(accountVanity),
+				Flags: []cli.Flag{
+					utils.DataDirFlag,
+					utils.KeyStoreDirFlag,
+					utils.KeyStoreBackendFlag,
+					utils.OutputFlag,
+					utils.PasswordFileFlag,
+					utils.PasswordFDFlag,
+					utils.PasswordHelperFlag,
+					utils.LightKDFFlag,
+					utils.KDFFlag,
+					utils.Argon2TimeFlag,
+					utils.Argon2MemoryFlag,
+					utils.Argon2ThreadsFlag,
+					utils.VanityPrefixFlag,
+					utils.VanitySuffixFlag,
+					utils.VanityRegexFlag,
+					utils.VanityICAPFlag,
+					utils.VanityCountFlag,
+					utils.VanityWorkersFlag,
+				},
+				Description: `Generates keys on all cores until --count of them have addresses matching all
+of --prefix, --suffix and --regex, regardless of case, and stores them locked
+with the same new password. With --icap the addresses also start with 00, so
+that they fit a direct ICAP account number.
+
+Every hex digit of the prefix and suffix makes the search 16 times longer; the
+progress shows the time by which a match has an even chance. Accounts found
+before the search is interrupted are kept.`,
+			},
+			{
+				Name:   "label",
+				Usage:  "Show or edit the metadata of an account",
+				Action: utils.MigrateFlags(accountLabel),
+				Flags: []cli.Flag{
+					utils.DataDirFlag,
+					utils.KeyStoreDirFlag,
+					utils.KeyStoreBackendFlag,
+					utils.OutputFlag,
+					utils.LabelFlag,
+					utils.TagFlag,
+					utils.NotesFlag,
+					utils.AccountChainIDFlag,
+				},
+				ArgsUsage: "<address|label>",
+				Description: `Shows the metadata kept about the account next to the keystore, after
+setting the fields given by the flags. The label can then be used instead of
+the address wherever an account is expected. An empty value clears a field.`,
+			},
 			{
 				Name:   "update",
 				Usage:  "Update an existing account",
@@ -47,9 +124,49 @@ account, create a new account or update an existing account.`,
 				Flags: []cli.Flag{
 					utils.DataDirFlag,
 					utils.KeyStoreDirFlag,
+					utils.KeyStoreBackendFlag,
+					utils.OutputFlag,
+					utils.PasswordFileFlag,
+					utils.PasswordFDFlag,
+					utils.PasswordHelperFlag,
+					utils.LightKDFFlag,
+					utils.KDFFlag,
+					utils.Argon2TimeFlag,
+					utils.Argon2MemoryFlag,
+					utils.Argon2ThreadsFlag,
+					utils.AuditLogFlag,
+				},
+				ArgsUsage: "<address> [<address>...]",
+				Description: `Update the password of existing accounts. The password file gives the current
+password on its first line and the new one on the second.`,
+			},
+			{
+				Name:   "migrate",
+				Usage:  "Re-encrypt all keys with a new key derivation function",
+				Action: utils.MigrateFlags(accountMigrate),
+				Flags: []cli.Flag{
+					utils.DataDirFlag,
+					utils.KeyStoreDirFlag,
+					utils.KeyStoreBackendFlag,
+					utils.OutputFlag,
+					utils.PasswordFileFlag,
+					utils.PasswordFDFlag,
+					utils.PasswordHelperFlag,
 					utils.LightKDFFlag,
+					utils.KDFFlag,
+					utils.Argon2TimeFlag,
+					utils.Argon2MemoryFlag,
+					utils.Argon2ThreadsFlag,
+					utils.ForceFlag,
+					utils.AuditLogFlag,
 				},
-				Description: `Update an existing account`,
+				Description: `Decrypts every key of the keystore and encrypts it again with its passphrase,
+using the key derivation function selected by --kdf and its parameters. Keys
+already using them are left alone. Keys protected by a stronger key derivation
+are not downgraded unless --force is given.
+
+The passphrases are read from --password, one line per keystore account in the
+order of their indexes in "account list", or asked once for all accounts.`,
 			},
 			{
 				Name:   "import",
@@ -58,43 +175,263 @@ account, create a new account or update an existing account.`,
 				Flags: []cli.Flag{
 					utils.DataDirFlag,
 					utils.KeyStoreDirFlag,
+					utils.KeyStoreBackendFlag,
+					utils.OutputFlag,
 					utils.PasswordFileFlag,
+					utils.PasswordFDFlag,
+					utils.PasswordHelperFlag,
 					utils.LightKDFFlag,
+					utils.KDFFlag,
+					utils.Argon2TimeFlag,
+					utils.Argon2MemoryFlag,
+					utils.Argon2ThreadsFlag,
+					utils.ImportJSONFlag,
+					utils.ImportPresaleFlag,
+				},
+				ArgsUsage: "<keyFile>",
+				Description: `Imports an unencrypted private key from <keyfile> and creates a new account.
+
+With --json, <keyFile> is instead an encrypted JSON key, as written by this or
+other Ethereum compatible wallets, or a directory of them. The keys are
+re-encrypted with the key derivation function of this keystore. The password
+file gives the password of the imported keys on its first line and the new
+one on the second. Keys of accounts already in the keystore are skipped.
+
+With --presale, <keyFile> is an Ethereum presale wallet. Its key is stored
+locked with the presale password.`,
+			},
+			{
+				Name:   "delete",
+				Usage:  "Delete the key of an account",
+				Action: utils.MigrateFlags(accountDelete),
+				Flags: []cli.Flag{
+					utils.DataDirFlag,
+					utils.KeyStoreDirFlag,
+					utils.KeyStoreBackendFlag,
+					utils.OutputFlag,
+					utils.PasswordFileFlag,
+					utils.PasswordFDFlag,
+					utils.PasswordHelperFlag,
+					utils.AuditLogFlag,
+					utils.TrashFlag,
 				},
-				ArgsUsage:   "<keyFile>",
-				Description: `Imports an unencrypted private key from <keyfile> and creates a new account`,
+				ArgsUsage: "<address>",
+				Description: `Deletes the key of the account after checking its password. The address must
+be typed again to confirm the deletion; without the key the funds of the
+account are lost for good.
+
+With --trash the key is moved to the .trash directory of the keystore instead,
+from where "account restore" brings it back.`,
+			},
+			{
+				Name:   "restore",
+				Usage:  "Restore a key moved to the trash",
+				Action: utils.MigrateFlags(accountRestore),
+				Flags: []cli.Flag{
+					utils.DataDirFlag,
+					utils.KeyStoreDirFlag,
+					utils.KeyStoreBackendFlag,
+					utils.OutputFlag,
+					utils.PasswordFileFlag,
+					utils.PasswordFDFlag,
+					utils.PasswordHelperFlag,
+					utils.AuditLogFlag,
+				},
+				ArgsUsage: "[<trashFile>]",
+				Description: `Restores the key of a file of the .trash directory, as listed when no file is
+given, after checking its password.`,
+			},
+			{
+				Name:   "export",
+				Usage:  "Export the key of an account",
+				Action: utils.MigrateFlags(accountExport),
+				Flags: []cli.Flag{
+					utils.DataDirFlag,
+					utils.KeyStoreDirFlag,
+					utils.KeyStoreBackendFlag,
+					utils.OutputFlag,
+					utils.PasswordFileFlag,
+					utils.PasswordFDFlag,
+					utils.PasswordHelperFlag,
+					utils.AuditLogFlag,
+					utils.ExportFileFlag,
+					utils.ExportPlaintextFlag,
+				},
+				ArgsUsage: "<address>",
+				Description: `Exports the key of the account as an encrypted JSON key, locked with a new
+password, that "account import" or another keystore accepts. The password
+file gives the current password on its first line and the new one on the
+second.
+
+With --plaintext the unencrypted private key is exported in hex instead, as
+read by "account import". Anyone reading it controls the account, so it is
+only written to the file given by --out after an explicit confirmation.
+
+Existing files are never overwritten.`,
+			},
+			{
+				Name:   "split",
+				Usage:  "Split the key of an account into shares",
+				Action: utils.MigrateFlags(accountSplit),
+				Flags: []cli.Flag{
+					utils.DataDirFlag,
+					utils.KeyStoreDirFlag,
+					utils.KeyStoreBackendFlag,
+					utils.OutputFlag,
+					utils.PasswordFileFlag,
+					utils.PasswordFDFlag,
+					utils.PasswordHelperFlag,
+					utils.AuditLogFlag,
+					utils.ShareThresholdFlag,
+					utils.ShareCountFlag,
+				},
+				ArgsUsage: "<address>",
+				Description: `Splits the unencrypted private key of the account into --shares shares, printed
+one per line, with Shamir's secret sharing: any --threshold of them rebuild the
+key with "account combine", while fewer reveal nothing about it. Every share
+ends with a checksum catching typing mistakes.
+
+Give each share to a different holder; the key stays in the keystore.`,
+			},
+			{
+				Name:   "combine",
+				Usage:  "Rebuild the key of an account from its shares",
+				Action: utils.MigrateFlags(accountCombine),
+				Flags: []cli.Flag{
+					utils.DataDirFlag,
+					utils.KeyStoreDirFlag,
+					utils.KeyStoreBackendFlag,
+					utils.OutputFlag,
+					utils.PasswordFileFlag,
+					utils.PasswordFDFlag,
+					utils.PasswordHelperFlag,
+					utils.LightKDFFlag,
+					utils.KDFFlag,
+					utils.Argon2TimeFlag,
+					utils.Argon2MemoryFlag,
+					utils.Argon2ThreadsFlag,
+				},
+				ArgsUsage: "[<shareFile>...]",
+				Description: `Rebuilds the key split by "account split" and imports it into the keystore,
+locked with a new password. The shares are read from the files given, one or
+more per file among other text, or else typed in one at a time until there are
+enough of them.`,
 			},
 		},
 	}
 )
 
-func AccountList(ctx *cli.Context) error {
-	var index int
+// accountResult is the result of the commands adding an account to the
+// keystore.
+type accountResult struct {
+	Address string `json:"address"`
+	URL     string `json:"url"`
+	Label   string `json:"label,omitempty"`
+
+	message string // Plain output
+}
 
-	dataDir := ctx.GlobalString(utils.DataDirFlag.Name)
-	keyStoreDir := ctx.GlobalString(utils.KeyStoreDirFlag.Name)
-	if keyStoreDir == "" {
-		keyStoreDir = keystore.KeyStoreScheme
+func newAccountResult(ks *keystore.KeyStore, account accounts.Account, message string) *accountResult {
+	md, _ := ks.Metadata().Get(account.Address)
+	return &accountResult{
+		Address: account.Address.Hex(),
+		URL:     account.URL.String(),
+		Label:   md.Label,
+		message: message,
 	}
-	keyStoreDir = filepath.Join(dataDir, keyStoreDir)
+}
 
-	manager, _, err := utils.MakeAccountManager(keyStoreDir)
-	if err != nil {
-		utils.Fatalf("Could not make account manager: %v", err)
+func (r *accountResult) Plain(w io.Writer) {
+	fmt.Fprintln(w, r.message)
+}
+
+func (r *accountResult) Table() ([]string, [][]string) {
+	return []string{"ADDRESS", "URL", "LABEL"}, [][]string{{r.Address, r.URL, r.Label}}
+}
+
+// listedAccount is an account of the "account list" result. Only keystore
+// accounts have an index, which commands accept in place of their address.
+type listedAccount struct {
+	Index   *int     `json:"index,omitempty"`
+	Address string   `json:"address"`
+	URL     string   `json:"url"`
+	Label   string   `json:"label,omitempty"`
+	Tags    []string `json:"tags,omitempty"`
+	Status  string   `json:"status"`
+	Locked  bool     `json:"locked"`
+}
+
+type accountListResult struct {
+	Accounts []listedAccount `json:"accounts"`
+}
+
+func (r *accountListResult) Plain(w io.Writer) {
+	for _, a := range r.Accounts {
+		if a.Index != nil {
+			fmt.Fprintf(w, "Account #%d: {%s} %s", *a.Index, strings.ToLower(a.Address[2:]), a.URL)
+		} else {
+			fmt.Fprintf(w, "Account: {%s} %s", strings.ToLower(a.Address[2:]), a.URL)
+		}
+		if a.Label != "" {
+			fmt.Fprintf(w, " %q", a.Label)
+		}
+		if len(a.Tags) > 0 {
+			fmt.Fprintf(w, " [%s]", strings.Join(a.Tags, ", "))
+		}
+		fmt.Fprintln(w)
 	}
+}
 
+func (r *accountListResult) Table() ([]string, [][]string) {
+	rows := make([][]string, len(r.Accounts))
+	for i, a := range r.Accounts {
+		var index string
+		if a.Index != nil {
+			index = strconv.Itoa(*a.Index)
+		}
+		rows[i] = []string{index, a.Address, a.Label, strings.Join(a.Tags, ","), a.Status, a.URL}
+	}
+	return []string{"INDEX", "ADDRESS", "LABEL", "TAGS", "STATUS", "URL"}, rows
+}
+
+func AccountList(ctx *cli.Context) error {
+	manager := makeAccountManager(ctx)
+	ks := manager.Backends(keystore.KeyStoreType)[0].(*keystore.KeyStore)
+	md := ks.Metadata()
+
+	// Number the keystore accounts as utils.MakeAddress resolves indexes
+	indexes := make(map[accounts.URL]int)
+	for i, account := range ks.Accounts() {
+		indexes[account.URL] = i
+	}
+	result := &accountListResult{Accounts: []listedAccount{}}
 	for _, wallet := range manager.Wallets() {
+		status, err := wallet.Status()
+		if err != nil {
+			status = err.Error()
+		}
 		for _, account := range wallet.Accounts() {
-			fmt.Printf("Account #%d: {%x} %s\n", index, account.Address, &account.URL)
-			index++
+			m, _ := md.Get(account.Address)
+			listed := listedAccount{
+				Address: account.Address.Hex(),
+				URL:     account.URL.String(),
+				Label:   m.Label,
+				Tags:    m.Tags,
+				Status:  status,
+				Locked:  status != "Unlocked" && status != "Opened",
+			}
+			if i, ok := indexes[account.URL]; ok {
+				listed.Index = &i
+			}
+			result.Accounts = append(result.Accounts, listed)
 		}
 	}
-
+	utils.PrintResult(result)
 	return nil
 }
 
 // tries unlocking the specified account a few times.
-func unlockAccount(ctx *cli.Context, ks *keystore.KeyStore, address string, i int, passwords []string) (accounts.Account, string) {
+func unlockAccount(ctx *cli.Context, ks *keystore.KeyStore, address string, i int, passwords utils.PasswordProvider) (accounts.Account, string) {
 	account, err := utils.MakeAddress(ks, address)
 	if err != nil {
 		utils.Fatalf("Could not list accounts: %v", err)
@@ -115,6 +452,10 @@ func unlockAccount(ctx *cli.Context, ks *keystore.KeyStore, address string, i in
 			// No need to prompt again if the error is not decryption-related.
 			break
 		}
+		if _, ok := passwords.(utils.PasswordList); ok {
+			// Nor if the password would be the same.
+			break
+		}
 	}
 	// All trials expended to unlock account, bail out
 	utils.Fatalf("Failed to unlock account %s (%v)", address, err)
@@ -123,11 +464,12 @@ func unlockAccount(ctx *cli.Context, ks *keystore.KeyStore, address string, i in
 }
 
 func ambiguousAddrRecovery(ks *keystore.KeyStore, err *keystore.AmbiguousAddrError, auth string) accounts.Account {
-	fmt.Printf("Multiple key files exist for address %x:\n", err.Addr)
+	w := utils.MessageWriter()
+	fmt.Fprintf(w, "Multiple key files exist for address %x:\n", err.Addr)
 	for _, a := range err.Matches {
-		fmt.Println("  ", a.URL)
+		fmt.Fprintln(w, "  ", a.URL)
 	}
-	fmt.Println("Testing your passphrase against all of them...")
+	fmt.Fprintln(w, "Testing your passphrase against all of them...")
 	var match *accounts.Account
 	for _, a := range err.Matches {
 		if err := ks.Unlock(a, auth); err == nil {
@@ -138,11 +480,11 @@ func ambiguousAddrRecovery(ks *keystore.KeyStore, err *keystore.AmbiguousAddrErr
 	if match == nil {
 		utils.Fatalf("None of the listed files could be unlocked.")
 	}
-	fmt.Printf("Your passphrase unlocked %s\n", match.URL)
-	fmt.Println("In order to avoid this warning, you need to remove the following duplicate key files:")
+	fmt.Fprintf(w, "Your passphrase unlocked %s\n", match.URL)
+	fmt.Fprintln(w, "In order to avoid this warning, you need to remove the following duplicate key files:")
 	for _, a := range err.Matches {
 		if a != *match {
-			fmt.Println("  ", a.URL)
+			fmt.Fprintln(w, "  ", a.URL)
 		}
 	}
 	return *match
@@ -150,18 +492,169 @@ func ambiguousAddrRecovery(ks *keystore.KeyStore, err *keystore.AmbiguousAddrErr
 
 // accountCreate creates a new account into the keystore defined by the CLI flags.
 func accountCreate(ctx *cli.Context) error {
+	ks := makeAccountManager(ctx).Backends(keystore.KeyStoreType)[0].(*keystore.KeyStore)
+
+	label := ctx.String(utils.LabelFlag.Name)
+	if err := metadata.ValidateLabel(label); err != nil {
+		utils.Fatalf("Invalid --%s: %v", utils.LabelFlag.Name, err)
+	}
+	if _, ok := ks.Metadata().Lookup(label); ok && label != "" {
+		utils.Fatalf("Invalid --%s: label %q already in use", utils.LabelFlag.Name, label)
+	}
+	password := getPassPhrase("Your new account is locked with a password. Please give a password. Do not forget this password.", true, 0, utils.MakePasswordProvider(ctx))
+	account, err := ks.NewAccount(password)
+	if err != nil {
+		utils.Fatalf("Failed to create account: %v", err)
+	}
+	if err := ks.Metadata().Set(account.Address, metadata.Metadata{Label: label}); err != nil {
+		utils.Fatalf("Failed to record the metadata of account {%x}: %v", account.Address, err)
+	}
+	utils.PrintResult(newAccountResult(ks, account, fmt.Sprintf("Address: {%x}", account.Address)))
+	return nil
+}
+
+// accountVanity generates accounts until enough of them match the pattern given
+// by the CLI flags.
+func accountVanity(ctx *cli.Context) error {
+	prefix := ctx.String(utils.VanityPrefixFlag.Name)
+	if ctx.Bool(utils.VanityICAPFlag.Name) {
+		prefix = strings.TrimPrefix(prefix, "0x")
+		if !strings.HasPrefix(prefix, "00") {
+			prefix = "00" + prefix
+		}
+	}
+	pattern, err := keystore.NewVanityPattern(prefix, ctx.String(utils.VanitySuffixFlag.Name), ctx.String(utils.VanityRegexFlag.Name))
+	if err != nil {
+		utils.Fatalf("Invalid address pattern: %v", err)
+	}
+	count, workers := ctx.Int(utils.VanityCountFlag.Name), ctx.Int(utils.VanityWorkersFlag.Name)
+	if count < 1 {
+		utils.Fatalf("Invalid --%s %d", utils.VanityCountFlag.Name, count)
+	}
+	if workers < 1 {
+		utils.Fatalf("Invalid --%s %d", utils.VanityWorkersFlag.Name, workers)
+	}
+	ks := makeAccountManager(ctx).Backends(keystore.KeyStoreType)[0].(*keystore.KeyStore)
+	password := getPassPhrase("Your new accounts are locked with a password. Please give a password. Do not forget this password.", true, 0, utils.MakePasswordProvider(ctx))
+
+	// Progress is only shown on terminals, where each report overwrites the last.
+	w := utils.MessageWriter()
+	if f, ok := w.(*os.File); !ok || !terminal.IsTerminal(int(f.Fd())) {
+		w = ioutil.Discard
+	}
+	difficulty := pattern.Difficulty()
+	progress := func(p keystore.VanityProgress) {
+		rate := float64(p.Attempts) / p.Elapsed.Seconds()
+		fmt.Fprintf(w, "\r%d keys tried, %.0f keys/s, %d/%d found", p.Attempts, rate, p.Found, count)
+		if difficulty > 0 && rate > 0 {
+			// Attempts after which a match has a 50% chance.
+			half := math.Log(0.5) / math.Log1p(-1/difficulty)
+			fmt.Fprintf(w, ", 50%% chance of the next match within %v", time.Duration(half/rate*float64(time.Second)).Round(time.Second))
+		}
+		fmt.Fprint(w, "   ")
+	}
+	accs, err := ks.NewVanityAccounts(pattern.Match, count, workers, password, progress)
+	fmt.Fprint(w, "\r\033[K")
+	result := &vanityResult{Accounts: make([]*accountResult, len(accs))}
+	for i, account := range accs {
+		result.Accounts[i] = newAccountResult(ks, account, fmt.Sprintf("Address: {%x}", account.Address))
+	}
+	utils.PrintResult(result)
+	if err != nil {
+		utils.Failf("Failed to create account: %v", err)
+	}
+	return nil
+}
+
+// vanityResult is the result of "account vanity".
+type vanityResult struct {
+	Accounts []*accountResult `json:"accounts"`
+}
+
+func (r *vanityResult) Plain(w io.Writer) {
+	for _, account := range r.Accounts {
+		account.Plain(w)
+	}
+}
+
+func (r *vanityResult) Table() ([]string, [][]string) {
+	rows := make([][]string, len(r.Accounts))
+	for i, account := range r.Accounts {
+		rows[i] = []string{account.Address, account.URL}
+	}
+	return []string{"ADDRESS", "URL"}, rows
+}
+
+// accountLabel shows the metadata of the account given as argument, updating
+// the fields given by the CLI flags first.
+func accountLabel(ctx *cli.Context) error {
+	if len(ctx.Args()) != 1 {
+		utils.Fatalf("The account must be given as the only argument")
+	}
+	ks := makeAccountManager(ctx).Backends(keystore.KeyStoreType)[0].(*keystore.KeyStore)
+	account, err := utils.MakeAddress(ks, ctx.Args().First())
+	if err != nil {
+		utils.Fatalf("Could not find the account: %v", err)
+	}
+	if !ks.HasAddress(account.Address) {
+		utils.Fatalf("No key for account {%x}", account.Address)
+	}
+	store := ks.Metadata()
+	md, _ := store.Get(account.Address)
+
+	var changed bool
+	if ctx.IsSet(utils.LabelFlag.Name) {
+		md.Label, changed = ctx.String(utils.LabelFlag.Name), true
+	}
+	if ctx.IsSet(utils.TagFlag.Name) {
+		md.Tags, changed = ctx.StringSlice(utils.TagFlag.Name), true
+	}
+	if ctx.IsSet(utils.NotesFlag.Name) {
+		md.Notes, changed = ctx.String(utils.NotesFlag.Name), true
+	}
+	if ctx.IsSet(utils.AccountChainIDFlag.Name) {
+		md.ChainID, changed = parseUint64(utils.AccountChainIDFlag.Name, ctx.String(utils.AccountChainIDFlag.Name)), true
+	}
+	if changed {
+		if err := store.Set(account.Address, md); err != nil {
+			utils.Fatalf("Could not update the account metadata: %v", err)
+		}
+		md, _ = store.Get(account.Address)
+	}
 
-	dataDir := ctx.GlobalString(utils.DataDirFlag.Name)
-	//get keyStoreDir from KeyStoreDirFlag, if not use the default value
-	keyStoreDir := ctx.GlobalString(utils.KeyStoreDirFlag.Name)
-	if keyStoreDir == "" {
-		keyStoreDir = keystore.KeyStoreScheme
+	utils.PrintResult(&metadataResult{Address: account.Address.Hex(), Metadata: md})
+	return nil
+}
+
+// metadataResult is the result of "account label".
+type metadataResult struct {
+	Address string `json:"address"`
+	metadata.Metadata
+}
+
+func (r *metadataResult) Plain(w io.Writer) {
+	fmt.Fprintf(w, "Address:  {%s}\n", strings.ToLower(r.Address[2:]))
+	fmt.Fprintf(w, "Label:    %s\n", r.Label)
+	fmt.Fprintf(w, "Tags:     %s\n", strings.Join(r.Tags, ", "))
+	if !r.Created.IsZero() {
+		fmt.Fprintf(w, "Created:  %s\n", r.Created.Format(time.RFC3339))
+	}
+	fmt.Fprintf(w, "Notes:    %s\n", r.Notes)
+	if r.ChainID != 0 {
+		fmt.Fprintf(w, "Chain ID: %d\n", r.ChainID)
 	}
-	keyStoreDir = filepath.Join(dataDir, keyStoreDir)
-	password := getPassPhrase("Your new account is locked with a password. Please give a password. Do not forget this password.", true, 0, utils.MakePasswordList(ctx))
-	_, err := utils.NewAccount(keyStoreDir, password)
+}
 
-	return err
+func (r *metadataResult) Table() ([]string, [][]string) {
+	var created, chainID string
+	if !r.Created.IsZero() {
+		created = r.Created.Format(time.RFC3339)
+	}
+	if r.ChainID != 0 {
+		chainID = strconv.FormatUint(r.ChainID, 10)
+	}
+	return []string{"ADDRESS", "LABEL", "TAGS", "CREATED", "NOTES", "CHAIN ID"},
+		[][]string{{r.Address, r.Label, strings.Join(r.Tags, ","), created, r.Notes, chainID}}
 }
 
 func accountUpdate(ctx *cli.Context) error {
@@ -169,61 +662,531 @@ func accountUpdate(ctx *cli.Context) error {
 		utils.Fatalf("No accounts specified to update")
 	}
 
-	dataDir := ctx.GlobalString(utils.DataDirFlag.Name)
-	keyStoreDir := ctx.GlobalString(utils.KeyStoreDirFlag.Name)
-	if keyStoreDir == "" {
-		keyStoreDir = keystore.KeyStoreScheme
-	}
-	keyStoreDir = filepath.Join(dataDir, keyStoreDir)
-
-	manager, _, _ := utils.MakeAccountManager(keyStoreDir)
+	manager := makeAccountManager(ctx)
 	ks := manager.Backends(keystore.KeyStoreType)[0].(*keystore.KeyStore)
+	defer openAuditLog(ctx, ks).Close()
 
+	passwords := utils.MakePasswordProvider(ctx)
+	result := &updateResult{Updated: []string{}}
 	for _, addr := range ctx.Args() {
-		account, oldPassword := unlockAccount(ctx, ks, addr, 0, nil)
-		newPassword := getPassPhrase("Please give a new password. Do not forget this password.", true, 0, nil)
+		account, oldPassword := unlockAccount(ctx, ks, addr, 0, passwords)
+		newPassword := getPassPhrase("Please give a new password. Do not forget this password.", true, 1, passwords)
 		if err := ks.Update(account, oldPassword, newPassword); err != nil {
 			utils.Fatalf("Could not update the account: %v", err)
 		}
+		result.Updated = append(result.Updated, account.Address.Hex())
 	}
+	utils.PrintResult(result)
 	return nil
 }
 
-// getPassPhrase retrieves the password associated with an account, either fetched
-// from a list of preloaded passphrases, or requested interactively from the user.
-func getPassPhrase(prompt string, confirmation bool, i int, passwords []string) string {
-	// If a list of passwords was supplied, retrieve from them
-	if len(passwords) > 0 {
-		if i < len(passwords) {
-			return passwords[i]
+// updateResult is the result of "account update", listing the accounts whose
+// password changed.
+type updateResult struct {
+	Updated []string `json:"updated"`
+}
+
+// Plain prints nothing, the password prompts already tell the progress.
+func (r *updateResult) Plain(w io.Writer) {}
+
+func (r *updateResult) Table() ([]string, [][]string) {
+	rows := make([][]string, len(r.Updated))
+	for i, addr := range r.Updated {
+		rows[i] = []string{addr}
+	}
+	return []string{"UPDATED"}, rows
+}
+
+// accountMigrate re-encrypts every key of the keystore with the key derivation
+// function selected by the CLI flags.
+func accountMigrate(ctx *cli.Context) error {
+	manager := makeAccountManager(ctx)
+	ks := manager.Backends(keystore.KeyStoreType)[0].(*keystore.KeyStore)
+	defer openAuditLog(ctx, ks).Close()
+
+	result := &migrateResult{Keys: []keyStatus{}}
+	accs := ks.Accounts()
+	if len(accs) == 0 {
+		utils.PrintResult(result)
+		return nil
+	}
+	passwords := utils.MakePasswordProvider(ctx)
+	if _, ok := passwords.(utils.PasswordList); !ok {
+		passwords = utils.PasswordList{getPassPhrase("Please give the password of the accounts.", false, 0, passwords)}
+	}
+	var failed int
+	for i, account := range accs {
+		key := keyStatus{Address: account.Address.Hex(), URL: account.URL.String()}
+		ok, err := ks.Migrate(account, getPassPhrase("", false, i, passwords), ctx.Bool(utils.ForceFlag.Name))
+		switch {
+		case err == keystore.ErrKDFDowngrade:
+			key.Status, key.Error = keySkipped, fmt.Sprintf("stronger key derivation in use, --%s to downgrade", utils.ForceFlag.Name)
+		case err != nil:
+			key.Status, key.Error = keyFailed, err.Error()
+			failed++
+		case ok:
+			key.Status = keyMigrated
+			result.Migrated++
+		default:
+			key.Status = keyUpToDate
 		}
-		return passwords[len(passwords)-1]
+		result.Keys = append(result.Keys, key)
 	}
-	// Otherwise prompt the user for the password
-	if prompt != "" {
-		fmt.Println(prompt)
+	utils.PrintResult(result)
+	if failed > 0 {
+		utils.Failf("Could not migrate %d keys", failed)
 	}
+	return nil
+}
+
+// Statuses of the keys processed by the commands handling several keys.
+const (
+	keyMigrated = "migrated"
+	keyUpToDate = "upToDate"
+	keyImported = "imported"
+	keySkipped  = "skipped"
+	keyFailed   = "failed"
+)
+
+// keyStatus is the outcome for a key of the commands handling several keys.
+type keyStatus struct {
+	File    string `json:"file,omitempty"`
+	Address string `json:"address,omitempty"`
+	URL     string `json:"url,omitempty"`
+	Status  string `json:"status"`
+	Error   string `json:"error,omitempty"`
+}
 
-	var password string
-	fmt.Println("Passphrase: ")
-	_, err := fmt.Scanln(&password)
+// migrateResult is the result of "account migrate".
+type migrateResult struct {
+	Keys     []keyStatus `json:"keys"`
+	Migrated int         `json:"migrated"`
+}
+
+func (r *migrateResult) Plain(w io.Writer) {
+	if len(r.Keys) == 0 {
+		fmt.Fprintln(w, "No accounts to migrate")
+		return
+	}
+	for _, key := range r.Keys {
+		account := fmt.Sprintf("{%s} %s", strings.ToLower(key.Address[2:]), key.URL)
+		switch key.Status {
+		case keyMigrated:
+			fmt.Fprintf(w, "Migrated %s\n", account)
+		case keyUpToDate:
+			fmt.Fprintf(w, "Up to date %s\n", account)
+		case keySkipped:
+			fmt.Fprintf(w, "Skipped %s: %s\n", account, key.Error)
+		default:
+			fmt.Fprintf(w, "Failed %s: %s\n", account, key.Error)
+		}
+	}
+	fmt.Fprintf(w, "Migrated %d of %d keys\n", r.Migrated, len(r.Keys))
+}
+
+func (r *migrateResult) Table() ([]string, [][]string) {
+	rows := make([][]string, len(r.Keys))
+	for i, key := range r.Keys {
+		rows[i] = []string{key.Address, key.Status, key.URL, key.Error}
+	}
+	return []string{"ADDRESS", "STATUS", "URL", "ERROR"}, rows
+}
+
+// getPassPhrase retrieves the password associated with an account from the
+// password source selected by the CLI flags, which may ask the user for it.
+func getPassPhrase(prompt string, confirmation bool, i int, passwords utils.PasswordProvider) string {
+	password, err := passwords.Password(prompt, confirmation, i)
+	if err != nil {
+		utils.Fatalf("Failed to get passphrase: %v", err)
+	}
+	return password
+}
+
+// trashDir returns the directory holding the keys deleted with --trash.
+func trashDir(ctx *cli.Context) string {
+	return filepath.Join(keyStoreDir(ctx), ".trash")
+}
+
+// accountDelete deletes the key of the account given as argument, or moves it
+// to the trash.
+func accountDelete(ctx *cli.Context) error {
+	if len(ctx.Args()) != 1 {
+		utils.Fatalf("The address of the account to delete must be given as argument")
+	}
+	manager := makeAccountManager(ctx)
+	ks := manager.Backends(keystore.KeyStoreType)[0].(*keystore.KeyStore)
+	defer openAuditLog(ctx, ks).Close()
+
+	account, password := unlockAccount(ctx, ks, ctx.Args().First(), 0, utils.MakePasswordProvider(ctx))
+	ks.Lock(account.Address)
+	account, err := ks.Find(account)
 	if err != nil {
-		utils.Fatalf("Failed to read passphrase: %v", err)
+		utils.Fatalf("Could not find the account: %v", err)
 	}
 
-	if confirmation {
-		fmt.Println("Repeat passphrase: ")
-		var confirm string
-		_, err := fmt.Scanln(&confirm)
+	w := utils.MessageWriter()
+	fmt.Fprintf(w, "Address: {%x}\n", account.Address)
+	fmt.Fprintf(w, "File:    %s\n", &account.URL)
+	if ctx.Bool(utils.TrashFlag.Name) {
+		fmt.Fprintf(w, "The key will be moved to %s.\n", trashDir(ctx))
+	} else {
+		fmt.Fprintln(w, "The key will be deleted for good, the funds of the account are lost without it.")
+	}
+	fmt.Fprint(w, "Type the address of the account to confirm: ")
+	confirm, _ := utils.ReadLine()
+	if !strings.EqualFold(strings.TrimPrefix(confirm, "0x"), fmt.Sprintf("%x", account.Address)) {
+		utils.Fatalf("Address mismatch, deletion aborted")
+	}
 
+	if ctx.Bool(utils.TrashFlag.Name) {
+		trashed, err := ks.Trash(account, password, trashDir(ctx))
 		if err != nil {
-			utils.Fatalf("Failed to read passphrase confirmation: %v", err)
+			utils.Fatalf("Could not move the key to the trash: %v", err)
 		}
-		if password != confirm {
-			utils.Fatalf("Passphrases do not match")
+		utils.PrintResult(&deleteResult{Address: account.Address.Hex(), URL: account.URL.String(), Trash: trashed})
+		return nil
+	}
+	if err := ks.Delete(account, password); err != nil {
+		utils.Fatalf("Could not delete the key: %v", err)
+	}
+	utils.PrintResult(&deleteResult{Address: account.Address.Hex(), URL: account.URL.String()})
+	return nil
+}
+
+// deleteResult is the result of "account delete". Trash is the file the key was
+// moved to, empty if it was deleted for good.
+type deleteResult struct {
+	Address string `json:"address"`
+	URL     string `json:"url"`
+	Trash   string `json:"trash,omitempty"`
+}
+
+func (r *deleteResult) Plain(w io.Writer) {
+	if r.Trash != "" {
+		fmt.Fprintf(w, "Moved {%s} to %s\n", strings.ToLower(r.Address[2:]), r.Trash)
+	} else {
+		fmt.Fprintf(w, "Deleted {%s}\n", strings.ToLower(r.Address[2:]))
+	}
+}
+
+func (r *deleteResult) Table() ([]string, [][]string) {
+	return []string{"ADDRESS", "URL", "TRASH"}, [][]string{{r.Address, r.URL, r.Trash}}
+}
+
+// accountRestore restores the key of the trash file given as argument, or lists
+// the trash files if there is none.
+func accountRestore(ctx *cli.Context) error {
+	trash := trashDir(ctx)
+	if len(ctx.Args()) == 0 {
+		var files []string
+		if _, err := os.Stat(trash); err == nil {
+			files = keyFiles(trash)
+		}
+		result := &trashResult{Trash: []trashedKey{}}
+		for _, file := range files {
+			var key struct {
+				Address string `json:"address"`
+			}
+			if keyJSON, err := ioutil.ReadFile(file); err == nil {
+				json.Unmarshal(keyJSON, &key)
+			}
+			trashed := trashedKey{File: filepath.Base(file)}
+			if common.IsHexAddress(key.Address) {
+				trashed.Address = common.HexToAddress(key.Address).Hex()
+			}
+			result.Trash = append(result.Trash, trashed)
 		}
+		utils.PrintResult(result)
+		return nil
 	}
-	return password
+	file := ctx.Args().First()
+	if _, err := os.Stat(file); os.IsNotExist(err) && filepath.Base(file) == file {
+		file = filepath.Join(trash, file)
+	}
+	manager := makeAccountManager(ctx)
+	ks := manager.Backends(keystore.KeyStoreType)[0].(*keystore.KeyStore)
+	defer openAuditLog(ctx, ks).Close()
+
+	passwords := utils.MakePasswordProvider(ctx)
+	for trials := 0; ; trials++ {
+		password := getPassPhrase(fmt.Sprintf("Restoring %s | Attempt %d/%d", filepath.Base(file), trials+1, 3), false, 0, passwords)
+		account, err := ks.Restore(file, password)
+		if err == nil {
+			utils.PrintResult(newAccountResult(ks, account, fmt.Sprintf("Address: {%x} restored to %s", account.Address, &account.URL)))
+			return nil
+		}
+		if _, ok := passwords.(utils.PasswordList); ok || err != keystore.ErrDecrypt || trials == 2 {
+			utils.Fatalf("Could not restore the key: %v", err)
+		}
+	}
+}
+
+// trashedKey is a key file of the trash, with the address of its account unless
+// the file is unreadable.
+type trashedKey struct {
+	Address string `json:"address"`
+	File    string `json:"file"`
+}
+
+// trashResult is the listing of the trash by "account restore".
+type trashResult struct {
+	Trash []trashedKey `json:"trash"`
+}
+
+func (r *trashResult) Plain(w io.Writer) {
+	if len(r.Trash) == 0 {
+		fmt.Fprintln(w, "The trash is empty")
+	}
+	for _, key := range r.Trash {
+		addr := key.Address
+		if addr != "" {
+			addr = strings.ToLower(addr[2:])
+		}
+		fmt.Fprintf(w, "{%s} %s\n", addr, key.File)
+	}
+}
+
+func (r *trashResult) Table() ([]string, [][]string) {
+	rows := make([][]string, len(r.Trash))
+	for i, key := range r.Trash {
+		rows[i] = []string{key.Address, key.File}
+	}
+	return []string{"ADDRESS", "FILE"}, rows
+}
+
+// accountExport exports the key of the account given as argument, either
+// encrypted with a new password or in plaintext.
+func accountExport(ctx *cli.Context) error {
+	if len(ctx.Args()) != 1 {
+		utils.Fatalf("The address of the account to export must be given as argument")
+	}
+	out := ctx.String(utils.ExportFileFlag.Name)
+	plaintext := ctx.Bool(utils.ExportPlaintextFlag.Name)
+	if plaintext && out == "" {
+		utils.Fatalf("Plaintext keys are only exported to a file, use --%s", utils.ExportFileFlag.Name)
+	}
+	if out != "" {
+		if _, err := os.Stat(out); err == nil {
+			utils.Fatalf("Refusing to overwrite %s", out)
+		}
+	}
+	manager := makeAccountManager(ctx)
+	ks := manager.Backends(keystore.KeyStoreType)[0].(*keystore.KeyStore)
+	defer openAuditLog(ctx, ks).Close()
+
+	passwords := utils.MakePasswordProvider(ctx)
+	account, password := unlockAccount(ctx, ks, ctx.Args().First(), 0, passwords)
+
+	var exported []byte
+	if plaintext {
+		w := utils.MessageWriter()
+		fmt.Fprintf(w, "The unencrypted private key of {%x} gives full control over the account.\n", account.Address)
+		fmt.Fprintf(w, "Type \"yes\" to write it to %s: ", out)
+		confirm, _ := utils.ReadLine()
+		if confirm != "yes" {
+			utils.Fatalf("Export aborted")
+		}
+		key, err := ks.ExportECDSA(account, password)
+		if err != nil {
+			utils.Fatalf("Could not export the account: %v", err)
+		}
+		raw := crypto.FromECDSA(key)
+		exported = make([]byte, hex.EncodedLen(len(raw)))
+		hex.Encode(exported, raw)
+		zeroBytes(raw)
+		zeroKey(key)
+	} else {
+		newPassword := getPassPhrase("Please give a password for the exported key. Do not forget this password.", true, 1, passwords)
+		keyJSON, err := ks.Export(account, password, newPassword)
+		if err != nil {
+			utils.Fatalf("Could not export the account: %v", err)
+		}
+		exported = keyJSON
+	}
+	if out == "" {
+		utils.PrintResult(&exportResult{Address: account.Address.Hex(), Key: json.RawMessage(exported)})
+		return nil
+	}
+	err := writeSecretFile(out, exported)
+	if plaintext {
+		zeroBytes(exported)
+	}
+	if err != nil {
+		utils.Fatalf("Could not write the exported key: %v", err)
+	}
+	utils.PrintResult(&exportResult{Address: account.Address.Hex(), File: out})
+	return nil
+}
+
+// exportResult is the result of "account export": the encrypted key, or the
+// file it was written to.
+type exportResult struct {
+	Address string          `json:"address"`
+	Key     json.RawMessage `json:"key,omitempty"`
+	File    string          `json:"file,omitempty"`
+}
+
+func (r *exportResult) Plain(w io.Writer) {
+	if r.File == "" {
+		fmt.Fprintln(w, string(r.Key))
+	} else {
+		fmt.Fprintf(w, "Exported {%s} to %s\n", strings.ToLower(r.Address[2:]), r.File)
+	}
+}
+
+func (r *exportResult) Table() ([]string, [][]string) {
+	return []string{"ADDRESS", "FILE", "KEY"}, [][]string{{r.Address, r.File, string(r.Key)}}
+}
+
+func accountSplit(ctx *cli.Context) error {
+	if len(ctx.Args()) != 1 {
+		utils.Fatalf("The address of the account to split must be given as argument")
+	}
+	threshold, n := ctx.Int(utils.ShareThresholdFlag.Name), ctx.Int(utils.ShareCountFlag.Name)
+	if threshold < 2 || n < threshold || n > shamir.MaxShares {
+		utils.Fatalf("Invalid %d of %d shares, want 2 <= --%s <= --%s <= %d",
+			threshold, n, utils.ShareThresholdFlag.Name, utils.ShareCountFlag.Name, shamir.MaxShares)
+	}
+	manager := makeAccountManager(ctx)
+	ks := manager.Backends(keystore.KeyStoreType)[0].(*keystore.KeyStore)
+	defer openAuditLog(ctx, ks).Close()
+
+	account, password := unlockAccount(ctx, ks, ctx.Args().First(), 0, utils.MakePasswordProvider(ctx))
+	shares, err := ks.SplitKey(account, password, threshold, n)
+	if err != nil {
+		utils.Fatalf("Could not split the key: %v", err)
+	}
+	result := &splitResult{Address: account.Address.Hex(), Threshold: threshold, Shares: make([]string, len(shares))}
+	for i, share := range shares {
+		result.Shares[i] = share.String()
+	}
+	fmt.Fprintf(utils.MessageWriter(), "Any %d of these %d shares rebuild the key of {%x}. Give each to a different holder.\n", threshold, n, account.Address)
+	utils.PrintResult(result)
+	return nil
+}
+
+// splitResult is the result of "account split".
+type splitResult struct {
+	Address   string   `json:"address"`
+	Threshold int      `json:"threshold"`
+	Shares    []string `json:"shares"`
+}
+
+func (r *splitResult) Plain(w io.Writer) {
+	for _, share := range r.Shares {
+		fmt.Fprintln(w, share)
+	}
+}
+
+func (r *splitResult) Table() ([]string, [][]string) {
+	rows := make([][]string, len(r.Shares))
+	for i, share := range r.Shares {
+		rows[i] = []string{strconv.Itoa(i + 1), share}
+	}
+	return []string{"#", "SHARE"}, rows
+}
+
+func accountCombine(ctx *cli.Context) error {
+	var shares []shamir.Share
+	if len(ctx.Args()) > 0 {
+		for _, file := range ctx.Args() {
+			text, err := ioutil.ReadFile(file)
+			if err != nil {
+				utils.Fatalf("Failed to read the shares: %v", err)
+			}
+			for _, line := range strings.Split(string(text), "\n") {
+				// Skip the other text saved with the shares
+				share, err := shamir.ParseShare(line)
+				if err == shamir.ErrNotShare {
+					continue
+				}
+				if err != nil {
+					utils.Fatalf("Invalid share in %s: %v", file, err)
+				}
+				shares = append(shares, share)
+			}
+		}
+	} else {
+		shares = readShares()
+	}
+	secret, err := shamir.Combine(shares)
+	if err != nil {
+		utils.Fatalf("Could not rebuild the key: %v", err)
+	}
+	defer zeroBytes(secret)
+	key, err := crypto.ToECDSA(secret)
+	if err != nil {
+		utils.Fatalf("Could not rebuild the key: %v", err)
+	}
+	// Shares are identified by the address of their key, which catches the
+	// corruptions their checksums missed.
+	if want := common.BytesToAddress(shares[0].ID); common.Address(crypto.PubkeyToAddress(key.PublicKey)) != want {
+		utils.Fatalf("Could not rebuild the key: the shares do not give the key of {%x}", want)
+	}
+	manager := makeAccountManager(ctx)
+	ks := manager.Backends(keystore.KeyStoreType)[0].(*keystore.KeyStore)
+
+	passphrase := getPassPhrase("Your new account is locked with a password. Please give a password. Do not forget this password.", true, 0, utils.MakePasswordProvider(ctx))
+	acct, err := ks.ImportECDSA(key, passphrase)
+	if err != nil {
+		utils.Fatalf("Could not import the key: %v", err)
+	}
+	utils.PrintResult(newAccountResult(ks, acct, fmt.Sprintf("Address: {%x}", acct.Address)))
+	return nil
+}
+
+// readShares asks for shares on standard input until the threshold of the first
+// one is reached, asking again for mistyped ones.
+func readShares() []shamir.Share {
+	w := utils.MessageWriter()
+	var shares []shamir.Share
+	for len(shares) == 0 || len(shares) < shares[0].Threshold {
+		if len(shares) == 0 {
+			fmt.Fprint(w, "Share: ")
+		} else {
+			fmt.Fprintf(w, "Share %d of %d: ", len(shares)+1, shares[0].Threshold)
+		}
+		line, err := utils.ReadLine()
+		if err != nil {
+			utils.Fatalf("Failed to read the shares: %v", err)
+		}
+		share, err := shamir.ParseShare(line)
+		if err != nil {
+			fmt.Fprintf(w, "Invalid share: %v\n", err)
+			continue
+		}
+		shares = append(shares, share)
+	}
+	return shares
+}
+
+// zeroKey overwrites a private key once it is no longer needed.
+func zeroKey(k *ecdsa.PrivateKey) {
+	b := k.D.Bits()
+	for i := range b {
+		b[i] = 0
+	}
+}
+
+// zeroBytes overwrites secret data once it is no longer needed.
+func zeroBytes(b []byte) {
+	for i := range b {
+		b[i] = 0
+	}
+}
+
+// writeSecretFile writes data to a new file readable by its owner only.
+func writeSecretFile(path string, data []byte) error {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		os.Remove(path)
+		return err
+	}
+	return f.Close()
 }
 
 func accountImport(ctx *cli.Context) error {
@@ -231,26 +1194,137 @@ func accountImport(ctx *cli.Context) error {
 	if len(keyfile) == 0 {
 		utils.Fatalf("keyfile must be given as argument")
 	}
+	if ctx.Bool(utils.ImportJSONFlag.Name) && ctx.Bool(utils.ImportPresaleFlag.Name) {
+		utils.Fatalf("Only one of --%s and --%s may be given", utils.ImportJSONFlag.Name, utils.ImportPresaleFlag.Name)
+	}
+	if ctx.Bool(utils.ImportJSONFlag.Name) {
+		return accountImportJSON(ctx, keyfile)
+	}
+	if ctx.Bool(utils.ImportPresaleFlag.Name) {
+		return accountImportPresale(ctx, keyfile)
+	}
 	key, err := crypto.LoadECDSA(keyfile)
 	if err != nil {
 		utils.Fatalf("Failed to load the private key: %v", err)
 	}
 
-	dataDir := ctx.GlobalString(utils.DataDirFlag.Name)
-	keyStoreDir := ctx.GlobalString(utils.KeyStoreDirFlag.Name)
-	if keyStoreDir == "" {
-		keyStoreDir = keystore.KeyStoreScheme
-	}
-	keyStoreDir = filepath.Join(dataDir, keyStoreDir)
-
-	manager, _, _ := utils.MakeAccountManager(keyStoreDir)
+	manager := makeAccountManager(ctx)
 	ks := manager.Backends(keystore.KeyStoreType)[0].(*keystore.KeyStore)
 
-	passphrase := getPassPhrase("Your new account is locked with a password. Please give a password. Do not forget this password.", true, 0, utils.MakePasswordList(ctx))
+	passphrase := getPassPhrase("Your new account is locked with a password. Please give a password. Do not forget this password.", true, 0, utils.MakePasswordProvider(ctx))
 	acct, err := ks.ImportECDSA(key, passphrase)
 	if err != nil {
 		utils.Fatalf("Could not create the account: %v", err)
 	}
-	fmt.Printf("Address: {%x}\n", acct.Address)
+	utils.PrintResult(newAccountResult(ks, acct, fmt.Sprintf("Address: {%x}", acct.Address)))
+	return nil
+}
+
+// accountImportJSON imports the encrypted JSON key file, or all the key files of
+// the directory, into the keystore.
+func accountImportJSON(ctx *cli.Context, path string) error {
+	files := []string{path}
+	if fi, err := os.Stat(path); err != nil {
+		utils.Fatalf("Failed to load the key file: %v", err)
+	} else if fi.IsDir() {
+		files = keyFiles(path)
+		if len(files) == 0 {
+			utils.Fatalf("No key files in %s", path)
+		}
+	}
+	manager := makeAccountManager(ctx)
+	ks := manager.Backends(keystore.KeyStoreType)[0].(*keystore.KeyStore)
+
+	passwords := utils.MakePasswordProvider(ctx)
+	passphrase := getPassPhrase("Please give the password of the imported keys.", false, 0, passwords)
+	newPassphrase := getPassPhrase("Your new account is locked with a password. Please give a password. Do not forget this password.", true, 1, passwords)
+
+	result := &importResult{Keys: []keyStatus{}}
+	var failed int
+	for _, file := range files {
+		key := keyStatus{File: file}
+		keyJSON, err := ioutil.ReadFile(file)
+		if err == nil {
+			var acct accounts.Account
+			if acct, err = ks.Import(keyJSON, passphrase, newPassphrase); err == nil {
+				key.Address, key.URL, key.Status = acct.Address.Hex(), acct.URL.String(), keyImported
+			}
+		}
+		switch {
+		case err == keystore.ErrAccountAlreadyExists:
+			key.Status, key.Error = keySkipped, err.Error()
+		case err != nil:
+			key.Status, key.Error = keyFailed, err.Error()
+			failed++
+		}
+		result.Keys = append(result.Keys, key)
+	}
+	utils.PrintResult(result)
+	if failed > 0 {
+		utils.Failf("Could not import %d key files", failed)
+	}
 	return nil
 }
+
+// importResult is the result of "account import --json".
+type importResult struct {
+	Keys []keyStatus `json:"keys"`
+}
+
+func (r *importResult) Plain(w io.Writer) {
+	for _, key := range r.Keys {
+		switch key.Status {
+		case keyImported:
+			fmt.Fprintf(w, "Address: {%s} imported from %s\n", strings.ToLower(key.Address[2:]), key.File)
+		case keySkipped:
+			fmt.Fprintf(w, "Skipped %s: %s\n", key.File, key.Error)
+		default:
+			fmt.Fprintf(w, "Failed %s: %s\n", key.File, key.Error)
+		}
+	}
+}
+
+func (r *importResult) Table() ([]string, [][]string) {
+	rows := make([][]string, len(r.Keys))
+	for i, key := range r.Keys {
+		rows[i] = []string{key.File, key.Status, key.Address, key.Error}
+	}
+	return []string{"FILE", "STATUS", "ADDRESS", "ERROR"}, rows
+}
+
+// accountImportPresale imports the key of the presale wallet file into the
+// keystore.
+func accountImportPresale(ctx *cli.Context, keyfile string) error {
+	keyJSON, err := ioutil.ReadFile(keyfile)
+	if err != nil {
+		utils.Fatalf("Could not read wallet file: %v", err)
+	}
+	manager := makeAccountManager(ctx)
+	ks := manager.Backends(keystore.KeyStoreType)[0].(*keystore.KeyStore)
+
+	passphrase := getPassPhrase("Please give the password of the presale wallet.", false, 0, utils.MakePasswordProvider(ctx))
+	acct, err := ks.ImportPreSaleKey(keyJSON, passphrase)
+	if err != nil {
+		utils.Fatalf("Could not import the presale wallet: %v", err)
+	}
+	utils.PrintResult(newAccountResult(ks, acct, fmt.Sprintf("Address: {%x}", acct.Address)))
+	return nil
+}
+
+// keyFiles lists the files of the directory that may hold keys, skipping
+// hidden and editor backup files like the keystore does.
+func keyFiles(dir string) []string {
+	fis, err := ioutil.ReadDir(dir)
+	if err != nil {
+		utils.Fatalf("Failed to read the key directory: %v", err)
+	}
+	var files []string
+	for _, fi := range fis {
+		name := fi.Name()
+		if fi.IsDir() || strings.HasPrefix(name, ".") || strings.HasSuffix(name, "~") {
+			continue
+		}
+		files = append(files, filepath.Join(dir, name))
+	}
+	return files
+}
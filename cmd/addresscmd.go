@@ -0,0 +1,78 @@
+package cmd
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/DSiSc/wallet/common/icap"
+	"github.com/DSiSc/wallet/utils"
+	"github.com/urfave/cli"
+)
+
+var (
+	AddressCommand = cli.Command{
+		Name:     "address",
+		Usage:    "Convert addresses",
+		Category: "ACCOUNT COMMANDS",
+		Subcommands: []cli.Command{
+			{
+				Name:   "icap",
+				Usage:  "Convert an address to or from ICAP",
+				Action: utils.MigrateFlags(addressICAP),
+				Flags: []cli.Flag{
+					utils.OutputFlag,
+				},
+				ArgsUsage: "<address|icap>",
+				Description: `Converts a hex address to its ICAP, the IBAN compatible form starting with XE,
+or an ICAP back to the hex address. Addresses starting with 00 have a Direct
+ICAP of 34 characters; the others only have the Basic ICAP of 35 characters.
+
+The check digits of ICAPs are verified. ICAPs are accepted wherever commands
+expect an address.`,
+			},
+		},
+	}
+)
+
+func addressICAP(ctx *cli.Context) error {
+	if len(ctx.Args()) != 1 {
+		utils.Fatalf("The address or ICAP must be given as the only argument")
+	}
+	input := ctx.Args().First()
+	addr, err := decodeAddress(input)
+	if err != nil {
+		utils.Fatalf("Invalid address: %v", err)
+	}
+
+	result := &icapResult{Address: addr.Hex(), Basic: icap.EncodeBasic(addr), fromICAP: icap.IsICAP(input)}
+	if direct, err := icap.EncodeDirect(addr); err == nil {
+		result.Direct = direct
+	}
+	utils.PrintResult(result)
+	return nil
+}
+
+// icapResult is the result of "address icap". The Direct ICAP is only set for
+// addresses that have one.
+type icapResult struct {
+	Address string `json:"address"`
+	Direct  string `json:"direct,omitempty"`
+	Basic   string `json:"basic"`
+
+	fromICAP bool // Plain output is the hex address
+}
+
+func (r *icapResult) Plain(w io.Writer) {
+	switch {
+	case r.fromICAP:
+		fmt.Fprintln(w, r.Address)
+	case r.Direct != "":
+		fmt.Fprintln(w, r.Direct)
+	default:
+		fmt.Fprintln(w, r.Basic)
+	}
+}
+
+func (r *icapResult) Table() ([]string, [][]string) {
+	return []string{"ADDRESS", "DIRECT", "BASIC"}, [][]string{{r.Address, r.Direct, r.Basic}}
+}
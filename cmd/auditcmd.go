@@ -0,0 +1,149 @@
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	"github.com/DSiSc/wallet/accounts/audit"
+	"github.com/DSiSc/wallet/accounts/keystore"
+	"github.com/DSiSc/wallet/utils"
+	"github.com/urfave/cli"
+)
+
+var (
+	AuditCommand = cli.Command{
+		Name:     "audit",
+		Usage:    "Inspect the audit log of key operations",
+		Category: "ACCOUNT COMMANDS",
+		Description: `Every signature, export, deletion and passphrase update performed through the
+keystore is recorded in a hash-chained, append-only audit log in the datadir.`,
+		Subcommands: []cli.Command{
+			{
+				Name:   "show",
+				Usage:  "Print the entries of the audit log",
+				Action: utils.MigrateFlags(auditShow),
+				Flags: []cli.Flag{
+					utils.DataDirFlag,
+					utils.AuditLogFlag,
+					utils.OutputFlag,
+				},
+				Description: `Print all the entries of the audit log, oldest first`,
+			},
+			{
+				Name:   "verify",
+				Usage:  "Verify the hash chain of the audit log",
+				Action: utils.MigrateFlags(auditVerify),
+				Flags: []cli.Flag{
+					utils.DataDirFlag,
+					utils.AuditLogFlag,
+					utils.OutputFlag,
+				},
+				Description: `Check that no entry of the audit log was modified, removed or reordered`,
+			},
+		},
+	}
+)
+
+// auditLogPath resolves the audit log file from the --datadir and --auditlog
+// flags.
+func auditLogPath(ctx *cli.Context) string {
+	path := ctx.GlobalString(utils.AuditLogFlag.Name)
+	if !filepath.IsAbs(path) {
+		path = filepath.Join(ctx.GlobalString(utils.DataDirFlag.Name), path)
+	}
+	return path
+}
+
+// openAuditLog opens the audit log and attaches it to the keystore.
+func openAuditLog(ctx *cli.Context, ks *keystore.KeyStore) *audit.Log {
+	log, err := audit.Open(auditLogPath(ctx))
+	if err != nil {
+		utils.Fatalf("Could not open audit log: %v", err)
+	}
+	ks.SetAuditLog(log)
+	return log
+}
+
+func auditShow(ctx *cli.Context) error {
+	entries, err := audit.Read(auditLogPath(ctx))
+	if err != nil && !os.IsNotExist(err) {
+		utils.Fatalf("Could not read audit log: %v", err)
+	}
+	result := &auditShowResult{Entries: make([]auditEntry, len(entries))}
+	for i := range entries {
+		result.Entries[i] = auditEntry{Entry: &entries[i], Account: entries[i].Account.Hex()}
+	}
+	utils.PrintResult(result)
+	return nil
+}
+
+// auditEntry is an entry of the audit log, with the checksummed address of its
+// account.
+type auditEntry struct {
+	*audit.Entry
+	Account string `json:"account"`
+}
+
+// auditShowResult is the result of "audit show".
+type auditShowResult struct {
+	Entries []auditEntry `json:"entries"`
+}
+
+func (r *auditShowResult) Plain(w io.Writer) {
+	for _, entry := range r.Entries {
+		fmt.Fprintf(w, "#%d %s %-22s {%x}", entry.Index, entry.Time.Format(time.RFC3339), entry.Operation, entry.Entry.Account)
+		if entry.Hash != nil {
+			fmt.Fprintf(w, " hash=%s", entry.Hash.Hex())
+		}
+		if entry.ChainID != nil {
+			fmt.Fprintf(w, " chainid=%v", entry.ChainID.ToInt())
+		}
+		fmt.Fprintf(w, " outcome=%q\n", entry.Outcome)
+	}
+}
+
+func (r *auditShowResult) Table() ([]string, [][]string) {
+	rows := make([][]string, len(r.Entries))
+	for i, entry := range r.Entries {
+		var hash, chainID string
+		if entry.Hash != nil {
+			hash = entry.Hash.Hex()
+		}
+		if entry.ChainID != nil {
+			chainID = entry.ChainID.ToInt().String()
+		}
+		rows[i] = []string{strconv.FormatUint(entry.Index, 10), entry.Time.Format(time.RFC3339), entry.Operation, entry.Account, hash, chainID, entry.Outcome}
+	}
+	return []string{"INDEX", "TIME", "OPERATION", "ACCOUNT", "HASH", "CHAIN ID", "OUTCOME"}, rows
+}
+
+func auditVerify(ctx *cli.Context) error {
+	entries, err := audit.Read(auditLogPath(ctx))
+	if err != nil && !os.IsNotExist(err) {
+		utils.Fatalf("Could not read audit log: %v", err)
+	}
+	if err := audit.Verify(entries); err != nil {
+		utils.Fatalf("%v", err)
+	}
+	utils.PrintResult(&auditVerifyResult{Intact: true, Entries: len(entries)})
+	return nil
+}
+
+// auditVerifyResult is the result of "audit verify". A broken chain is reported
+// as an error instead.
+type auditVerifyResult struct {
+	Intact  bool `json:"intact"`
+	Entries int  `json:"entries"`
+}
+
+func (r *auditVerifyResult) Plain(w io.Writer) {
+	fmt.Fprintf(w, "Audit log intact, %d entries\n", r.Entries)
+}
+
+func (r *auditVerifyResult) Table() ([]string, [][]string) {
+	return []string{"INTACT", "ENTRIES"}, [][]string{{strconv.FormatBool(r.Intact), strconv.Itoa(r.Entries)}}
+}
@@ -0,0 +1,197 @@
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"syscall"
+
+	"github.com/DSiSc/wallet/accounts"
+	"github.com/DSiSc/wallet/accounts/keystore"
+	"github.com/DSiSc/wallet/accounts/policy"
+	"github.com/DSiSc/wallet/signer"
+	"github.com/DSiSc/wallet/utils"
+	"github.com/urfave/cli"
+)
+
+var (
+	ServeCommand = cli.Command{
+		Name:     "serve",
+		Usage:    "Run the JSON-RPC signing daemon",
+		Category: "ACCOUNT COMMANDS",
+		Action:   utils.MigrateFlags(serve),
+		Flags: []cli.Flag{
+			utils.DataDirFlag,
+			utils.KeyStoreDirFlag,
+			utils.KeyStoreBackendFlag,
+			utils.LightKDFFlag,
+			utils.AuditLogFlag,
+			utils.NoHTTPFlag,
+			utils.RPCListenAddrFlag,
+			utils.RPCPortFlag,
+			utils.IPCDisabledFlag,
+			utils.IPCPathFlag,
+			utils.RulesFlag,
+			utils.OutputFlag,
+		},
+		Description: `Expose the keystore over a local JSON-RPC API, served over HTTP and over a
+Unix domain socket. The following methods are available:
+
+    account_list                                      addresses of all accounts
+    account_new(passphrase)                           create a new account
+    account_unlock(address, passphrase[, seconds])    unlock an account, 0 = until exit
+    account_lock(address)                             lock an account
+    account_signTransaction(tx[, passphrase])         sign a transaction, returns raw RLP
+    account_signData(address, data[, passphrase])     sign the keccak256 hash of data
+
+Without a passphrase the signing methods require the account to be unlocked.
+
+With --rules, signing requests are checked against the JSON policy in the given
+file, for example:
+
+    {
+      "maxValue": "1000000000000000000",
+      "dailyLimit": "0x8ac7230489e80000",
+      "accountDailyLimits": {"0x...": "5000000000000000000"},
+      "allowedRecipients": ["0x..."],
+      "allowedChainIds": [1],
+      "payload": {"allowCreate": false, "allow": ["0xa9059cbb"], "deny": []},
+      "autoApprove": false
+    }
+
+Requests violating a rule are rejected. Unless autoApprove is set, the remaining
+ones must be confirmed on the terminal running the daemon.`,
+	}
+)
+
+// keyStoreDir resolves the keystore directory from the --datadir and
+// --keystore flags.
+func keyStoreDir(ctx *cli.Context) string {
+	dataDir := ctx.GlobalString(utils.DataDirFlag.Name)
+	keyStoreDir := ctx.GlobalString(utils.KeyStoreDirFlag.Name)
+	if keyStoreDir == "" {
+		keyStoreDir = keystore.KeyStoreScheme
+	}
+	return filepath.Join(dataDir, keyStoreDir)
+}
+
+// makeAccountManager creates the account manager of the keystore directory
+// and backend selected by the --datadir, --keystore and --keystore-backend
+// flags, encrypting keys with the key derivation function of the --kdf flags.
+func makeAccountManager(ctx *cli.Context) *accounts.Manager {
+	backend := ctx.GlobalString(utils.KeyStoreBackendFlag.Name)
+	manager, _, err := utils.MakeAccountManagerWithBackend(keyStoreDir(ctx), backend, utils.MakeKDFConfig(ctx))
+	if err != nil {
+		utils.Fatalf("Could not make account manager: %v", err)
+	}
+	return manager
+}
+
+// serve starts the signing daemon and blocks until it is interrupted.
+func serve(ctx *cli.Context) error {
+	manager := makeAccountManager(ctx)
+	defer manager.Close()
+
+	var engine *policy.Engine
+	if file := ctx.GlobalString(utils.RulesFlag.Name); file != "" {
+		config, err := policy.LoadConfig(file)
+		if err != nil {
+			utils.Fatalf("Could not load signing rules: %v", err)
+		}
+		engine = policy.New(config, policy.NewTerminalApprover(os.Stdin, utils.MessageWriter()))
+	}
+	api, err := signer.NewAPI(manager, engine)
+	if err != nil {
+		utils.Fatalf("Could not create signer API: %v", err)
+	}
+	defer openAuditLog(ctx, manager.Backends(keystore.KeyStoreType)[0].(*keystore.KeyStore)).Close()
+	server := signer.NewServer(api)
+
+	var (
+		listeners []net.Listener
+		endpoints serveResult
+	)
+	if !ctx.GlobalBool(utils.NoHTTPFlag.Name) {
+		endpoint := fmt.Sprintf("%s:%d", ctx.GlobalString(utils.RPCListenAddrFlag.Name), ctx.GlobalInt(utils.RPCPortFlag.Name))
+		listener, err := net.Listen("tcp", endpoint)
+		if err != nil {
+			utils.Fatalf("Could not start HTTP endpoint: %v", err)
+		}
+		listeners = append(listeners, listener)
+		go http.Serve(listener, server)
+		endpoints.HTTP = fmt.Sprintf("http://%s", listener.Addr())
+	}
+	if !ctx.GlobalBool(utils.IPCDisabledFlag.Name) {
+		endpoint := ctx.GlobalString(utils.IPCPathFlag.Name)
+		if !filepath.IsAbs(endpoint) {
+			endpoint = filepath.Join(ctx.GlobalString(utils.DataDirFlag.Name), endpoint)
+		}
+		listener, err := ipcListen(endpoint)
+		if err != nil {
+			utils.Fatalf("Could not start IPC endpoint: %v", err)
+		}
+		listeners = append(listeners, listener)
+		go server.ServeListener(listener)
+		endpoints.IPC = endpoint
+	}
+	if len(listeners) == 0 {
+		utils.Fatalf("Both HTTP and IPC endpoints are disabled")
+	}
+	utils.PrintResult(&endpoints)
+
+	sigc := make(chan os.Signal, 1)
+	signal.Notify(sigc, syscall.SIGINT, syscall.SIGTERM)
+	defer signal.Stop(sigc)
+	<-sigc
+
+	for _, listener := range listeners {
+		listener.Close()
+	}
+	return nil
+}
+
+// serveResult lists the endpoints "serve" opened, printed once it is ready for
+// requests.
+type serveResult struct {
+	HTTP string `json:"http,omitempty"`
+	IPC  string `json:"ipc,omitempty"`
+}
+
+func (r *serveResult) Plain(w io.Writer) {
+	if r.HTTP != "" {
+		fmt.Fprintf(w, "HTTP endpoint opened: %s\n", r.HTTP)
+	}
+	if r.IPC != "" {
+		fmt.Fprintf(w, "IPC endpoint opened: %s\n", r.IPC)
+	}
+}
+
+func (r *serveResult) Table() ([]string, [][]string) {
+	var rows [][]string
+	if r.HTTP != "" {
+		rows = append(rows, []string{"http", r.HTTP})
+	}
+	if r.IPC != "" {
+		rows = append(rows, []string{"ipc", r.IPC})
+	}
+	return []string{"ENDPOINT", "ADDRESS"}, rows
+}
+
+// ipcListen creates a Unix domain socket at endpoint, replacing any stale
+// socket file, and restricts access to the current user.
+func ipcListen(endpoint string) (net.Listener, error) {
+	if err := os.MkdirAll(filepath.Dir(endpoint), 0700); err != nil {
+		return nil, err
+	}
+	os.Remove(endpoint)
+	listener, err := net.Listen("unix", endpoint)
+	if err != nil {
+		return nil, err
+	}
+	os.Chmod(endpoint, 0600)
+	return listener, nil
+}
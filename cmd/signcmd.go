@@ -0,0 +1,289 @@
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"strconv"
+	"strings"
+
+	"github.com/DSiSc/wallet/accounts"
+	"github.com/DSiSc/wallet/accounts/eip712"
+	"github.com/DSiSc/wallet/accounts/keystore"
+	"github.com/DSiSc/wallet/common"
+	"github.com/DSiSc/wallet/common/hexutil"
+	"github.com/DSiSc/wallet/utils"
+	"github.com/urfave/cli"
+)
+
+var (
+	SignCommand = cli.Command{
+		Name:     "sign",
+		Usage:    "Sign messages and typed data",
+		Category: "SIGNING COMMANDS",
+		Subcommands: []cli.Command{
+			{
+				Name:   "message",
+				Usage:  "Sign a personal message",
+				Action: utils.MigrateFlags(signMessage),
+				Flags: []cli.Flag{
+					utils.DataDirFlag,
+					utils.KeyStoreDirFlag,
+					utils.KeyStoreBackendFlag,
+					utils.OutputFlag,
+					utils.PasswordFileFlag,
+					utils.PasswordFDFlag,
+					utils.PasswordHelperFlag,
+					utils.AuditLogFlag,
+					utils.MessageHexFlag,
+					utils.VOffsetFlag,
+				},
+				ArgsUsage: "<address> <message>",
+				Description: `Sign the message with the key of the account, as an EIP-191 personal message:
+the signed hash is
+
+    keccak256("\x19Ethereum Signed Message:\n" + len(message) + message)
+
+so that the signature can never pass for the signature of a transaction. The
+65 byte [R || S || V] signature is printed in hex, with V 27 or 28, or 0 or 1
+with --voffset 0.`,
+			},
+			{
+				Name:   "typed-data",
+				Usage:  "Sign EIP-712 typed structured data",
+				Action: utils.MigrateFlags(signTypedData),
+				Flags: []cli.Flag{
+					utils.DataDirFlag,
+					utils.KeyStoreDirFlag,
+					utils.KeyStoreBackendFlag,
+					utils.OutputFlag,
+					utils.PasswordFileFlag,
+					utils.PasswordFDFlag,
+					utils.PasswordHelperFlag,
+					utils.AuditLogFlag,
+					utils.VOffsetFlag,
+				},
+				ArgsUsage: "<address> <file>",
+				Description: `Sign the EIP-712 typed structured data of the JSON file with the key of the
+account. The file holds the struct types, the primary type, the domain and the
+message:
+
+    {"types": {...}, "primaryType": "Mail", "domain": {...}, "message": {...}}
+
+The decoded domain and message are shown before the passphrase is asked for, so
+that they can be checked. The signed hash is
+
+    keccak256("\x19\x01" ‖ domainSeparator ‖ hashStruct(message))
+
+and the 65 byte [R || S || V] signature is printed in hex, with V 27 or 28, or 0
+or 1 with --voffset 0.`,
+			},
+		},
+	}
+	VerifyCommand = cli.Command{
+		Name:     "verify",
+		Usage:    "Verify message signatures",
+		Category: "SIGNING COMMANDS",
+		Subcommands: []cli.Command{
+			{
+				Name:   "message",
+				Usage:  "Verify the signature of a personal message",
+				Action: utils.MigrateFlags(verifyMessage),
+				Flags: []cli.Flag{
+					utils.OutputFlag,
+					utils.MessageHexFlag,
+					utils.SignerFlag,
+				},
+				ArgsUsage: "<signature> <message>",
+				Description: `Recover the address that signed the EIP-191 personal message, as "sign message"
+does, and print it. V may be 27 or 28 as well as 0 or 1. With --signer the
+command fails unless the signature is from that address.`,
+			},
+		},
+	}
+)
+
+// messageArg returns the message given as argument, decoding it with --hex.
+func messageArg(ctx *cli.Context, arg string) []byte {
+	if !ctx.Bool(utils.MessageHexFlag.Name) {
+		return []byte(arg)
+	}
+	msg, err := hexutil.Decode(arg)
+	if err != nil {
+		utils.Fatalf("Invalid hex message: %v", err)
+	}
+	return msg
+}
+
+func signMessage(ctx *cli.Context) error {
+	if len(ctx.Args()) != 2 {
+		utils.Fatalf("The account and the message must be given as arguments")
+	}
+	msg := messageArg(ctx, ctx.Args()[1])
+	offset := ctx.Uint(utils.VOffsetFlag.Name)
+	if offset != 0 && offset != 27 {
+		utils.Fatalf("Invalid --%s %d, want 0 or 27", utils.VOffsetFlag.Name, offset)
+	}
+	manager := makeAccountManager(ctx)
+	ks := manager.Backends(keystore.KeyStoreType)[0].(*keystore.KeyStore)
+	defer openAuditLog(ctx, ks).Close()
+
+	account, _ := unlockAccount(ctx, ks, ctx.Args().First(), 0, utils.MakePasswordProvider(ctx))
+	defer ks.Lock(account.Address)
+
+	wallet, err := manager.Find(account)
+	if err != nil {
+		utils.Fatalf("Could not find the account: %v", err)
+	}
+	sig, err := accounts.SignText(wallet, account, msg)
+	if err != nil {
+		utils.Fatalf("Could not sign the message: %v", err)
+	}
+	sig[64] -= byte(27 - offset)
+
+	utils.PrintResult(&messageSignature{
+		Address:   account.Address.Hex(),
+		Hash:      common.BytesToHash(accounts.TextHash(msg)),
+		Signature: sig,
+	})
+	return nil
+}
+
+// messageSignature is the result of "sign message" and "sign typed-data".
+type messageSignature struct {
+	Address   string        `json:"address"`
+	Hash      common.Hash   `json:"hash"` // EIP-191 or EIP-712 hash of the message
+	Signature hexutil.Bytes `json:"signature"`
+}
+
+func (r *messageSignature) Plain(w io.Writer) {
+	fmt.Fprintln(w, r.Signature)
+}
+
+func (r *messageSignature) Table() ([]string, [][]string) {
+	return []string{"ADDRESS", "HASH", "SIGNATURE"}, [][]string{{r.Address, r.Hash.Hex(), r.Signature.String()}}
+}
+
+func signTypedData(ctx *cli.Context) error {
+	if len(ctx.Args()) != 2 {
+		utils.Fatalf("The account and the typed data file must be given as arguments")
+	}
+	input, err := ioutil.ReadFile(ctx.Args()[1])
+	if err != nil {
+		utils.Fatalf("Failed to read the typed data: %v", err)
+	}
+	data, err := eip712.Parse(input)
+	if err != nil {
+		utils.Fatalf("Invalid typed data: %v", err)
+	}
+	hash, err := data.Hash()
+	if err != nil {
+		utils.Fatalf("Invalid typed data: %v", err)
+	}
+	offset := ctx.Uint(utils.VOffsetFlag.Name)
+	if offset != 0 && offset != 27 {
+		utils.Fatalf("Invalid --%s %d, want 0 or 27", utils.VOffsetFlag.Name, offset)
+	}
+
+	// Show what is about to be signed before asking for the passphrase.
+	w := utils.MessageWriter()
+	for _, part := range []struct {
+		name, typ string
+		value     map[string]interface{}
+	}{
+		{"Domain", eip712.DomainType, data.Domain},
+		{"Message", data.PrimaryType, data.Message},
+	} {
+		fields, err := data.Format(part.typ, part.value)
+		if err != nil {
+			utils.Fatalf("Invalid typed data: %v", err)
+		}
+		fmt.Fprintf(w, "%s (%s):\n", part.name, part.typ)
+		printFields(w, fields, "  ")
+	}
+	fmt.Fprintln(w)
+
+	manager := makeAccountManager(ctx)
+	ks := manager.Backends(keystore.KeyStoreType)[0].(*keystore.KeyStore)
+	defer openAuditLog(ctx, ks).Close()
+
+	account, _ := unlockAccount(ctx, ks, ctx.Args().First(), 0, utils.MakePasswordProvider(ctx))
+	defer ks.Lock(account.Address)
+
+	wallet, err := manager.Find(account)
+	if err != nil {
+		utils.Fatalf("Could not find the account: %v", err)
+	}
+	sig, err := accounts.SignTypedData(wallet, account, data)
+	if err != nil {
+		utils.Fatalf("Could not sign the typed data: %v", err)
+	}
+	sig[64] -= byte(27 - offset)
+
+	utils.PrintResult(&messageSignature{
+		Address:   account.Address.Hex(),
+		Hash:      common.BytesToHash(hash),
+		Signature: sig,
+	})
+	return nil
+}
+
+// printFields prints the decoded fields of typed data, one per line, indenting
+// the members of structs and arrays.
+func printFields(w io.Writer, fields []eip712.Field, indent string) {
+	for _, field := range fields {
+		if field.Fields == nil {
+			fmt.Fprintf(w, "%s%s %s: %s\n", indent, field.Type, field.Name, field.Value)
+			continue
+		}
+		fmt.Fprintf(w, "%s%s %s:\n", indent, field.Type, field.Name)
+		printFields(w, field.Fields, indent+"  ")
+	}
+}
+
+func verifyMessage(ctx *cli.Context) error {
+	if len(ctx.Args()) != 2 {
+		utils.Fatalf("The signature and the message must be given as arguments")
+	}
+	input := ctx.Args().First()
+	if !strings.HasPrefix(input, "0x") {
+		input = "0x" + input
+	}
+	sig, err := hexutil.Decode(input)
+	if err != nil {
+		utils.Fatalf("Invalid signature: %v", err)
+	}
+	signer, err := accounts.VerifyText(messageArg(ctx, ctx.Args()[1]), sig)
+	if err != nil {
+		utils.Fatalf("Invalid signature: %v", err)
+	}
+	result := &messageVerification{Signer: signer.Hex()}
+	if expected := ctx.String(utils.SignerFlag.Name); expected != "" {
+		valid := parseAddress(utils.SignerFlag.Name, expected) == signer
+		result.Valid = &valid
+	}
+	utils.PrintResult(result)
+	if result.Valid != nil && !*result.Valid {
+		utils.Failf("Signature by %s, not %s", signer.Hex(), ctx.String(utils.SignerFlag.Name))
+	}
+	return nil
+}
+
+// messageVerification is the result of "verify message". Valid is only set when
+// the signer was given.
+type messageVerification struct {
+	Signer string `json:"signer"`
+	Valid  *bool  `json:"valid,omitempty"`
+}
+
+func (r *messageVerification) Plain(w io.Writer) {
+	fmt.Fprintln(w, r.Signer)
+}
+
+func (r *messageVerification) Table() ([]string, [][]string) {
+	var valid string
+	if r.Valid != nil {
+		valid = strconv.FormatBool(*r.Valid)
+	}
+	return []string{"SIGNER", "VALID"}, [][]string{{r.Signer, valid}}
+}
@@ -0,0 +1,514 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math/big"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/DSiSc/craft/types"
+	"github.com/DSiSc/wallet/accounts/keystore"
+	"github.com/DSiSc/wallet/common"
+	"github.com/DSiSc/wallet/common/hexutil"
+	"github.com/DSiSc/wallet/common/icap"
+	"github.com/DSiSc/wallet/common/math"
+	local "github.com/DSiSc/wallet/core/types"
+	"github.com/DSiSc/wallet/utils"
+	"github.com/urfave/cli"
+)
+
+var (
+	TxCommand = cli.Command{
+		Name:     "tx",
+		Usage:    "Build and inspect transactions",
+		Category: "TRANSACTION COMMANDS",
+		Description: `Build, sign and inspect transactions without a connection to a node, so that
+signing keys can be kept on an air-gapped machine.`,
+		Subcommands: []cli.Command{
+			{
+				Name:   "build",
+				Usage:  "Build an unsigned transaction",
+				Action: utils.MigrateFlags(txBuild),
+				Flags: []cli.Flag{
+					utils.TxFromFlag,
+					utils.TxToFlag,
+					utils.TxValueFlag,
+					utils.TxGasFlag,
+					utils.TxGasPriceFlag,
+					utils.TxNonceFlag,
+					utils.TxDataFlag,
+					utils.TxChainIDFlag,
+					utils.OutputFlag,
+				},
+				Description: `Build an unsigned transaction and print it as a JSON document:
+
+    {
+      "from":     "0x...",  sender address
+      "to":       "0x...",  recipient address, omitted for contract creations
+      "value":    "0x0",    amount to transfer
+      "gas":      "0x5208", gas limit
+      "gasPrice": "0x1",    gas price
+      "nonce":    "0x0",    sender nonce
+      "data":     "0x",     payload
+      "chainId":  "0x1",    chain ID to sign for, omitted for unprotected transactions
+      "rlp":      "0x..."   RLP encoding of the unsigned transaction
+    }
+
+Quantities are accepted in hex or decimal. --from, --gas and --nonce are required.`,
+			},
+			{
+				Name:   "sign",
+				Usage:  "Sign an unsigned transaction",
+				Action: utils.MigrateFlags(txSign),
+				Flags: []cli.Flag{
+					utils.DataDirFlag,
+					utils.KeyStoreDirFlag,
+					utils.KeyStoreBackendFlag,
+					utils.PasswordFileFlag,
+					utils.PasswordFDFlag,
+					utils.PasswordHelperFlag,
+					utils.AuditLogFlag,
+					utils.TxChainIDFlag,
+					utils.OutputFlag,
+				},
+				ArgsUsage: "<unsigned.json|rlp>",
+				Description: `Sign the transaction built by "tx build" with the key of its sender, using the
+EIP-155 signer. The argument is a file holding either the JSON document or the
+hex encoded RLP of the unsigned transaction, or the hex encoded RLP itself.
+
+The chain ID is taken from the JSON document or from --chainid. The signed
+transaction is printed as:
+
+    {
+      "raw":  "0x...",  RLP encoding of the signed transaction
+      "hash": "0x..."   transaction hash
+    }`,
+			},
+			{
+				Name:   "decode",
+				Usage:  "Print the fields of a transaction",
+				Action: utils.MigrateFlags(txDecode),
+				Flags: []cli.Flag{
+					utils.TxChainIDFlag,
+					utils.OutputFlag,
+				},
+				ArgsUsage: "<signed.json|unsigned.json|rlp>",
+				Description: `Decode a transaction and print its fields. The argument is accepted in any of
+the forms of "tx sign", and the output of "tx sign" itself is accepted too.
+
+For signed transactions the sender is recovered with the signer implied by the
+V value: EIP-155 for the chain ID derived from V if the transaction is
+protected, homestead otherwise. With --chainid the signature is also checked
+against the EIP-155 signer of that chain.`,
+			},
+			{
+				Name:   "send",
+				Usage:  "Broadcast a signed transaction",
+				Action: utils.MigrateFlags(txSend),
+				Flags: []cli.Flag{
+					utils.NodeURLFlag,
+					utils.NodeTimeoutFlag,
+					utils.NodeHeaderFlag,
+					utils.NodeCAFlag,
+					utils.NodeCertFlag,
+					utils.NodeKeyFlag,
+					utils.NodeInsecureFlag,
+					utils.OutputFlag,
+				},
+				ArgsUsage: "<signed.json|rlp>",
+				Description: `Submit a transaction signed by "tx sign" to a node with eth_sendRawTransaction
+and print the hash returned by the node. The argument is the output of
+"tx sign", or the hex encoded RLP of the signed transaction, given directly
+or as the name of a file holding it.`,
+			},
+		},
+	}
+)
+
+// parseBig256 parses a hex or decimal flag value.
+func parseBig256(name, value string) *big.Int {
+	var v math.HexOrDecimal256
+	if err := v.UnmarshalText([]byte(value)); err != nil {
+		utils.Fatalf("Invalid --%s: %v", name, err)
+	}
+	return (*big.Int)(&v)
+}
+
+// parseUint64 parses a hex or decimal flag value.
+func parseUint64(name, value string) uint64 {
+	v, ok := math.ParseUint64(value)
+	if !ok {
+		utils.Fatalf("Invalid --%s: %q", name, value)
+	}
+	return v
+}
+
+// parseAddress parses a hex or ICAP address flag value.
+func parseAddress(name, value string) common.Address {
+	addr, err := decodeAddress(value)
+	if err != nil {
+		utils.Fatalf("Invalid --%s: %v", name, err)
+	}
+	return addr
+}
+
+// decodeAddress decodes a hex or ICAP address.
+func decodeAddress(value string) (common.Address, error) {
+	if icap.IsICAP(value) {
+		return icap.Decode(value)
+	}
+	if !common.IsHexAddress(value) {
+		return common.Address{}, fmt.Errorf("%q is not a hex or ICAP address", value)
+	}
+	return common.HexToAddress(value), nil
+}
+
+func txBuild(ctx *cli.Context) error {
+	for _, flag := range []cli.StringFlag{utils.TxFromFlag, utils.TxGasFlag, utils.TxNonceFlag} {
+		if ctx.String(flag.Name) == "" {
+			utils.Fatalf("Missing --%s", flag.Name)
+		}
+	}
+	utx := &local.UnsignedTx{
+		From:     parseAddress(utils.TxFromFlag.Name, ctx.String(utils.TxFromFlag.Name)),
+		Value:    (*math.HexOrDecimal256)(parseBig256(utils.TxValueFlag.Name, ctx.String(utils.TxValueFlag.Name))),
+		Gas:      math.HexOrDecimal64(parseUint64(utils.TxGasFlag.Name, ctx.String(utils.TxGasFlag.Name))),
+		GasPrice: (*math.HexOrDecimal256)(parseBig256(utils.TxGasPriceFlag.Name, ctx.String(utils.TxGasPriceFlag.Name))),
+		Nonce:    math.HexOrDecimal64(parseUint64(utils.TxNonceFlag.Name, ctx.String(utils.TxNonceFlag.Name))),
+	}
+	if to := ctx.String(utils.TxToFlag.Name); to != "" {
+		addr := parseAddress(utils.TxToFlag.Name, to)
+		utx.To = &addr
+	}
+	if data := ctx.String(utils.TxDataFlag.Name); data != "" {
+		payload, err := hexutil.Decode(data)
+		if err != nil {
+			utils.Fatalf("Invalid --%s: %v", utils.TxDataFlag.Name, err)
+		}
+		utx.Data = payload
+	}
+	var chainID *big.Int
+	if id := ctx.String(utils.TxChainIDFlag.Name); id != "" {
+		chainID = parseBig256(utils.TxChainIDFlag.Name, id)
+	}
+	utx, err := local.NewUnsignedTx(utx.Transaction(), chainID)
+	if err != nil {
+		utils.Fatalf("Could not build transaction: %v", err)
+	}
+	utils.PrintResult(&unsignedTxResult{utx})
+	return nil
+}
+
+// unsignedTxResult is the result of "tx build", printed as the JSON document of
+// the transaction in plain output too.
+type unsignedTxResult struct {
+	*local.UnsignedTx
+}
+
+func (r *unsignedTxResult) Plain(w io.Writer) {
+	out, _ := json.MarshalIndent(r.UnsignedTx, "", "  ")
+	fmt.Fprintln(w, string(out))
+}
+
+func (r *unsignedTxResult) Table() ([]string, [][]string) {
+	rows := [][]string{
+		{"from", r.From.Hex()},
+		{"to", "contract creation"},
+		{"value", (*big.Int)(r.Value).String()},
+		{"gas", strconv.FormatUint(uint64(r.Gas), 10)},
+		{"gasPrice", (*big.Int)(r.GasPrice).String()},
+		{"nonce", strconv.FormatUint(uint64(r.Nonce), 10)},
+		{"data", r.Data.String()},
+		{"chainId", "unprotected"},
+		{"rlp", r.RLP.String()},
+	}
+	if r.To != nil {
+		rows[1][1] = r.To.Hex()
+	}
+	if r.ChainID != nil {
+		rows[7][1] = (*big.Int)(r.ChainID).String()
+	}
+	return []string{"FIELD", "VALUE"}, rows
+}
+
+// loadTransaction reads a transaction from a JSON document or hex encoded RLP,
+// given either directly or as the name of a file holding it. The chain ID is
+// only known for JSON documents.
+func loadTransaction(arg string) (*types.Transaction, *big.Int, error) {
+	input := arg
+	if _, err := os.Stat(arg); err == nil {
+		content, err := ioutil.ReadFile(arg)
+		if err != nil {
+			return nil, nil, err
+		}
+		input = string(content)
+	}
+	input = strings.TrimSpace(input)
+	if strings.HasPrefix(input, "{") {
+		var signed struct {
+			Raw hexutil.Bytes `json:"raw"`
+		}
+		if err := json.Unmarshal([]byte(input), &signed); err == nil && len(signed.Raw) > 0 {
+			tx, err := local.DecodeRLP(signed.Raw)
+			return tx, nil, err
+		}
+		var utx local.UnsignedTx
+		if err := json.Unmarshal([]byte(input), &utx); err != nil {
+			return nil, nil, err
+		}
+		return utx.Transaction(), (*big.Int)(utx.ChainID), nil
+	}
+	if !strings.HasPrefix(input, "0x") {
+		input = "0x" + input
+	}
+	raw, err := hexutil.Decode(input)
+	if err != nil {
+		return nil, nil, err
+	}
+	tx, err := local.DecodeRLP(raw)
+	if err != nil {
+		return nil, nil, err
+	}
+	return tx, nil, nil
+}
+
+func txSign(ctx *cli.Context) error {
+	if len(ctx.Args()) != 1 {
+		utils.Fatalf("The unsigned transaction must be given as the only argument")
+	}
+	tx, chainID, err := loadTransaction(ctx.Args().First())
+	if err != nil {
+		utils.Fatalf("Could not load transaction: %v", err)
+	}
+	if tx.Data.From == nil {
+		utils.Fatalf("Transaction has no sender")
+	}
+	if id := ctx.String(utils.TxChainIDFlag.Name); id != "" {
+		flagID := parseBig256(utils.TxChainIDFlag.Name, id)
+		if chainID != nil && chainID.Cmp(flagID) != 0 {
+			utils.Fatalf("Chain ID %v of the transaction conflicts with --%s %v", chainID, utils.TxChainIDFlag.Name, flagID)
+		}
+		chainID = flagID
+	}
+	ks := makeAccountManager(ctx).Backends(keystore.KeyStoreType)[0].(*keystore.KeyStore)
+	defer openAuditLog(ctx, ks).Close()
+
+	from := common.Address(*tx.Data.From)
+	if md, ok := ks.Metadata().Get(from); ok && chainID == nil && md.ChainID != 0 {
+		chainID = new(big.Int).SetUint64(md.ChainID)
+	}
+	if chainID == nil {
+		utils.Fatalf("No chain ID given, use --%s or set the default of the account", utils.TxChainIDFlag.Name)
+	}
+	account, _ := unlockAccount(ctx, ks, from.Hex(), 0, utils.MakePasswordProvider(ctx))
+	defer ks.Lock(account.Address)
+
+	signed, err := ks.SignTx(account, tx, chainID)
+	if err != nil {
+		utils.Fatalf("Could not sign transaction: %v", err)
+	}
+	raw, err := local.EncodeToRLP(signed)
+	if err != nil {
+		utils.Fatalf("Could not encode transaction: %v", err)
+	}
+	utils.PrintResult(&signedTxResult{Raw: raw, Hash: local.TxHash(signed)})
+	return nil
+}
+
+// signedTxResult is the result of "tx sign", printed as JSON in plain output too.
+type signedTxResult struct {
+	Raw  hexutil.Bytes `json:"raw"`
+	Hash common.Hash   `json:"hash"`
+}
+
+func (r *signedTxResult) Plain(w io.Writer) {
+	out, _ := json.MarshalIndent(r, "", "  ")
+	fmt.Fprintln(w, string(out))
+}
+
+func (r *signedTxResult) Table() ([]string, [][]string) {
+	return []string{"HASH", "RAW"}, [][]string{{r.Hash.Hex(), r.Raw.String()}}
+}
+
+func txDecode(ctx *cli.Context) error {
+	if len(ctx.Args()) != 1 {
+		utils.Fatalf("The transaction must be given as the only argument")
+	}
+	tx, _, err := loadTransaction(ctx.Args().First())
+	if err != nil {
+		utils.Fatalf("Could not load transaction: %v", err)
+	}
+	data := tx.Data
+
+	result := &decodedTx{
+		Hash:     local.TxHash(tx).Hex(),
+		Nonce:    hexutil.Uint64(data.AccountNonce),
+		GasPrice: (*hexutil.Big)(data.Price),
+		Gas:      hexutil.Uint64(data.GasLimit),
+		Value:    (*hexutil.Big)(data.Amount),
+		Data:     data.Payload,
+		Signed:   local.Signed(tx),
+	}
+	if data.From != nil {
+		result.From = common.Address(*data.From).Hex()
+	}
+	if data.Recipient != nil {
+		result.To = common.Address(*data.Recipient).Hex()
+	}
+	if !result.Signed {
+		utils.PrintResult(result)
+		return nil
+	}
+	result.V, result.R, result.S = (*hexutil.Big)(data.V), (*hexutil.Big)(data.R), (*hexutil.Big)(data.S)
+
+	signer := local.TxSigner(tx)
+	if local.Protected(tx) {
+		result.Signer, result.ChainID = "eip155", (*hexutil.Big)(local.ChainId(tx))
+	} else {
+		result.Signer = "homestead"
+	}
+	if sender, err := local.Sender(signer, tx); err != nil {
+		result.SenderError = err.Error()
+	} else {
+		result.Sender = sender.Hex()
+		result.FromMismatch = data.From != nil && common.Address(*data.From) != sender
+	}
+
+	if id := ctx.String(utils.TxChainIDFlag.Name); id != "" {
+		chainID := parseBig256(utils.TxChainIDFlag.Name, id)
+		result.ChainCheck = &chainCheck{ChainID: (*hexutil.Big)(chainID), Valid: true}
+		if _, err := local.Sender(local.NewEIP155Signer(chainID), tx); err != nil {
+			result.ChainCheck.Valid, result.ChainCheck.Error = false, err.Error()
+		}
+	}
+	utils.PrintResult(result)
+	return nil
+}
+
+// decodedTx is the result of "tx decode". The signature fields are only set for
+// signed transactions.
+type decodedTx struct {
+	Hash         string         `json:"hash"`
+	Nonce        hexutil.Uint64 `json:"nonce"`
+	GasPrice     *hexutil.Big   `json:"gasPrice"`
+	Gas          hexutil.Uint64 `json:"gas"`
+	From         string         `json:"from,omitempty"`
+	To           string         `json:"to,omitempty"` // Empty for contract creations
+	Value        *hexutil.Big   `json:"value"`
+	Data         hexutil.Bytes  `json:"data"`
+	Signed       bool           `json:"signed"`
+	V            *hexutil.Big   `json:"v,omitempty"`
+	R            *hexutil.Big   `json:"r,omitempty"`
+	S            *hexutil.Big   `json:"s,omitempty"`
+	Signer       string         `json:"signer,omitempty"`  // "eip155" or "homestead"
+	ChainID      *hexutil.Big   `json:"chainId,omitempty"` // Chain ID derived from V for EIP-155 signatures
+	Sender       string         `json:"sender,omitempty"`
+	SenderError  string         `json:"senderError,omitempty"`
+	FromMismatch bool           `json:"fromMismatch,omitempty"` // Sender differs from the from field
+	ChainCheck   *chainCheck    `json:"chainCheck,omitempty"`
+}
+
+// chainCheck is the check of a signature against the EIP-155 signer of the
+// chain given by --chainid.
+type chainCheck struct {
+	ChainID *hexutil.Big `json:"chainId"`
+	Valid   bool         `json:"valid"`
+	Error   string       `json:"error,omitempty"`
+}
+
+// fields lists the fields of the transaction as in the plain output.
+func (r *decodedTx) fields() [][]string {
+	to := r.To
+	if to == "" {
+		to = "contract creation"
+	}
+	fields := [][]string{
+		{"Hash", r.Hash},
+		{"Nonce", strconv.FormatUint(uint64(r.Nonce), 10)},
+		{"Gas price", r.GasPrice.ToInt().String()},
+		{"Gas limit", strconv.FormatUint(uint64(r.Gas), 10)},
+	}
+	if r.From != "" {
+		fields = append(fields, []string{"From", r.From})
+	}
+	fields = append(fields, []string{"To", to}, []string{"Value", r.Value.ToInt().String()}, []string{"Data", r.Data.String()})
+	if !r.Signed {
+		return append(fields, []string{"Signature", "none"})
+	}
+	fields = append(fields, []string{"V", r.V.String()}, []string{"R", r.R.String()}, []string{"S", r.S.String()})
+	if r.ChainID != nil {
+		fields = append(fields, []string{"Signer", fmt.Sprintf("EIP-155, chain ID %v", r.ChainID.ToInt())})
+	} else {
+		fields = append(fields, []string{"Signer", "homestead, unprotected"})
+	}
+	if r.SenderError != "" {
+		fields = append(fields, []string{"Sender", "invalid signature: " + r.SenderError})
+	} else {
+		fields = append(fields, []string{"Sender", r.Sender})
+		if r.FromMismatch {
+			fields = append(fields, []string{"Warning", "sender does not match the from field"})
+		}
+	}
+	if c := r.ChainCheck; c != nil {
+		if c.Valid {
+			fields = append(fields, []string{fmt.Sprintf("Chain %v", c.ChainID.ToInt()), "signature valid"})
+		} else {
+			fields = append(fields, []string{fmt.Sprintf("Chain %v", c.ChainID.ToInt()), "signature invalid: " + c.Error})
+		}
+	}
+	return fields
+}
+
+func (r *decodedTx) Plain(w io.Writer) {
+	for _, field := range r.fields() {
+		if r.ChainCheck != nil && strings.HasPrefix(field[0], "Chain ") {
+			fmt.Fprintf(w, "%s: %s\n", field[0], field[1])
+			continue
+		}
+		fmt.Fprintf(w, "%-10s %s\n", field[0]+":", field[1])
+	}
+}
+
+func (r *decodedTx) Table() ([]string, [][]string) {
+	return []string{"FIELD", "VALUE"}, r.fields()
+}
+
+func txSend(ctx *cli.Context) error {
+	if len(ctx.Args()) != 1 {
+		utils.Fatalf("The signed transaction must be given as the only argument")
+	}
+	tx, _, err := loadTransaction(ctx.Args().First())
+	if err != nil {
+		utils.Fatalf("Could not load transaction: %v", err)
+	}
+	if !local.Signed(tx) {
+		utils.Fatalf("Transaction is not signed")
+	}
+	client, err := utils.NewRPCClient(utils.MakeRPCConfig(ctx))
+	if err != nil {
+		utils.Fatalf("Could not connect to node: %v", err)
+	}
+	hash, err := client.SendRawTransaction(tx)
+	if err != nil {
+		utils.Fatalf("Could not send transaction: %v", err)
+	}
+	utils.PrintResult(&sentTxResult{Hash: hash})
+	return nil
+}
+
+// sentTxResult is the result of "tx send", the hash returned by the node.
+type sentTxResult struct {
+	Hash common.Hash `json:"hash"`
+}
+
+func (r *sentTxResult) Plain(w io.Writer) {
+	fmt.Fprintln(w, r.Hash.Hex())
+}
+
+func (r *sentTxResult) Table() ([]string, [][]string) {
+	return []string{"HASH"}, [][]string{{r.Hash.Hex()}}
+}
@@ -0,0 +1,115 @@
+// Package icap converts addresses to and from the Inter exchange Client Address
+// Protocol, the IBAN compatible form of Ethereum addresses:
+//
+//	XE <2 check digits> <address in base 36>
+//
+// The Direct form spells the address in 30 digits and only fits addresses below
+// 36^30, such as those starting with 00; the Basic form uses 31 digits and fits
+// all of them. The check digits are those of IBAN, computed with ISO 7064 mod
+// 97-10, so that most typing mistakes are detected.
+package icap
+
+import (
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+
+	"github.com/DSiSc/wallet/common"
+)
+
+const (
+	countryCode  = "XE"
+	directLength = 30 // Base 36 digits of the Direct form
+	basicLength  = 31 // Base 36 digits of the Basic form
+)
+
+var (
+	// ErrNotDirect is returned by EncodeDirect for addresses of 36^30 and more.
+	ErrNotDirect = errors.New("address too large for Direct ICAP")
+
+	// ErrChecksum is returned by Decode when the check digits do not match.
+	ErrChecksum = errors.New("invalid ICAP check digits")
+
+	big36     = big.NewInt(36)
+	maxDirect = new(big.Int).Exp(big36, big.NewInt(directLength), nil)
+)
+
+// Encode returns the Direct ICAP form of the address when it has one, and the
+// Basic form otherwise.
+func Encode(a common.Address) string {
+	if s, err := EncodeDirect(a); err == nil {
+		return s
+	}
+	return EncodeBasic(a)
+}
+
+// EncodeDirect returns the Direct ICAP form of the address.
+func EncodeDirect(a common.Address) (string, error) {
+	if a.Big().Cmp(maxDirect) >= 0 {
+		return "", ErrNotDirect
+	}
+	return encode(a, directLength), nil
+}
+
+// EncodeBasic returns the Basic ICAP form of the address.
+func EncodeBasic(a common.Address) string {
+	return encode(a, basicLength)
+}
+
+func encode(a common.Address, length int) string {
+	bban := strings.ToUpper(a.Big().Text(36))
+	bban = strings.Repeat("0", length-len(bban)) + bban
+	return countryCode + checkDigits(bban) + bban
+}
+
+// Decode parses the Direct or Basic ICAP form of an address. Letters may be of
+// either case and spaces may group the characters, as in printed IBANs.
+func Decode(s string) (common.Address, error) {
+	s = strings.ToUpper(strings.Replace(s, " ", "", -1))
+	if !strings.HasPrefix(s, countryCode) {
+		return common.Address{}, fmt.Errorf("ICAP must start with %s", countryCode)
+	}
+	switch len(s) - 4 {
+	case directLength, basicLength:
+	case 16:
+		return common.Address{}, errors.New("indirect ICAP is not supported")
+	default:
+		return common.Address{}, fmt.Errorf("invalid ICAP length %d", len(s))
+	}
+	bban := s[4:]
+	if strings.Trim(bban, "0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZ") != "" {
+		return common.Address{}, errors.New("invalid ICAP characters")
+	}
+	if s[2:4] != checkDigits(bban) {
+		return common.Address{}, ErrChecksum
+	}
+	v, _ := new(big.Int).SetString(bban, 36)
+	if v.BitLen() > 8*common.AddressLength {
+		return common.Address{}, errors.New("ICAP out of the address range")
+	}
+	return common.BigToAddress(v), nil
+}
+
+// IsICAP reports whether s looks like an ICAP rather than a hex address, label
+// or index; Decode tells whether it is valid.
+func IsICAP(s string) bool {
+	return len(s) > 2 && strings.EqualFold(s[:2], countryCode)
+}
+
+// checkDigits returns the IBAN check digits of the account number: the number
+// moved behind the country code and 00, with letters replaced by 10 to 35, is
+// taken modulo 97 and subtracted from 98.
+func checkDigits(bban string) string {
+	var digits strings.Builder
+	for _, c := range bban + countryCode + "00" {
+		if c >= 'A' {
+			fmt.Fprintf(&digits, "%d", c-'A'+10)
+		} else {
+			digits.WriteRune(c)
+		}
+	}
+	n, _ := new(big.Int).SetString(digits.String(), 10)
+	check := 98 - new(big.Int).Mod(n, big.NewInt(97)).Int64()
+	return fmt.Sprintf("%02d", check)
+}
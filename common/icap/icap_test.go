@@ -0,0 +1,72 @@
+package icap
+
+import (
+	"testing"
+
+	"github.com/DSiSc/wallet/common"
+	"github.com/stretchr/testify/assert"
+)
+
+// Vectors of the go-ethereum ICAP implementation.
+var icapTests = []struct {
+	address string
+	icap    string
+}{
+	// Direct
+	{"0x00c5496aee77c1ba1f0854206a26dda82a81d6d8", "XE7338O073KYGTWWZN0F2WZ0R8PX5ZPPZS"},
+	// Basic
+	{"0x11c5496aee77c1ba1f0854206a26dda82a81d6d8", "XE1222Q908LN1QBBU6XUQSO1OHWJIOS46OO"},
+	{"0x52dc504a422f0e2a9e7632a34a50f1a82f8224c7", "XE499OG1EH8ZZI0KXC6N83EKGT1BM97P2O7"},
+}
+
+func TestEncodeDecode(t *testing.T) {
+	for _, test := range icapTests {
+		addr := common.HexToAddress(test.address)
+		assert.Equal(t, test.icap, Encode(addr))
+
+		decoded, err := Decode(test.icap)
+		assert.Nil(t, err, test.icap)
+		assert.Equal(t, addr, decoded)
+	}
+}
+
+func TestDirectBasic(t *testing.T) {
+	small := common.HexToAddress("0x00c5496aee77c1ba1f0854206a26dda82a81d6d8")
+	basic := EncodeBasic(small)
+	assert.Len(t, basic, 35)
+	decoded, err := Decode(basic)
+	assert.Nil(t, err)
+	assert.Equal(t, small, decoded)
+
+	_, err = EncodeDirect(common.HexToAddress("0x11c5496aee77c1ba1f0854206a26dda82a81d6d8"))
+	assert.Equal(t, ErrNotDirect, err)
+
+	// The zero address and the largest one
+	for _, addr := range []common.Address{{}, common.HexToAddress("0xffffffffffffffffffffffffffffffffffffffff")} {
+		decoded, err := Decode(Encode(addr))
+		assert.Nil(t, err)
+		assert.Equal(t, addr, decoded)
+	}
+}
+
+func TestDecodeErrors(t *testing.T) {
+	decoded, err := Decode("xe73 38o0 73ky gtww zn0f 2wz0 r8px 5zpp zs")
+	assert.Nil(t, err)
+	assert.Equal(t, common.HexToAddress("0x00c5496aee77c1ba1f0854206a26dda82a81d6d8"), decoded)
+
+	for _, s := range []string{
+		"XE7438O073KYGTWWZN0F2WZ0R8PX5ZPPZS",  // Check digits
+		"XE7338O073KYGTWWZN0F2WZ0R8PX5ZPPZT",  // Typo
+		"DE7338O073KYGTWWZN0F2WZ0R8PX5ZPPZS",  // Country
+		"XE7338O073KYGTWWZN0F2WZ0R8PX5ZPPZ",   // Length
+		"XE81ETHXREGGAVOFYORK",                // Indirect
+		"XE73-8O073KYGTWWZN0F2WZ0R8PX5ZPPZS",  // Characters
+		"XE54ZZZZZZZZZZZZZZZZZZZZZZZZZZZZZZZ", // Over 160 bits
+		"XE",                                  // Short
+		"XE1",
+		"xe 12",
+	} {
+		_, err := Decode(s)
+		assert.NotNil(t, err, s)
+	}
+}
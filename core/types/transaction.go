@@ -34,6 +34,9 @@ func CopyBytes(b []byte) (copiedBytes []byte) {
 }
 
 func TypeConvert(a *common.Address) *types.Address {
+	if a == nil {
+		return nil
+	}
 	var address types.Address
 	copy(address[:], a[:])
 	return &address
@@ -113,3 +116,22 @@ func EncodeRLP(tx *types.Transaction, w io.Writer) error {
 func EncodeToRLP(tx *types.Transaction) ([]byte, error) {
 	return rlp.EncodeToBytes(tx)
 }
+
+// DecodeRLP decodes a transaction encoded with EncodeToRLP. Transactions
+// encoded with EncodeRLP, holding only the transaction data, are accepted too.
+func DecodeRLP(raw []byte) (*types.Transaction, error) {
+	tx := new(types.Transaction)
+	if err := rlp.DecodeBytes(raw, tx); err == nil {
+		return tx, nil
+	}
+	if err := rlp.DecodeBytes(raw, &tx.Data); err != nil {
+		return nil, err
+	}
+	return tx, nil
+}
+
+// TxHash returns the hash identifying the transaction, the keccak256 hash of
+// its EncodeToRLP encoding.
+func TxHash(tx *types.Transaction) common.Hash {
+	return rlpHash(tx)
+}
@@ -0,0 +1,94 @@
+// Copyright(c) 2018 DSiSc Group. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package types
+
+import (
+	"errors"
+	"math/big"
+
+	"github.com/DSiSc/craft/types"
+	"github.com/DSiSc/wallet/common"
+	"github.com/DSiSc/wallet/common/hexutil"
+	"github.com/DSiSc/wallet/common/math"
+)
+
+// UnsignedTx is the JSON document describing a transaction awaiting signature,
+// as exchanged between the offline transaction commands:
+//
+//	{
+//	  "from":     "0x...",  sender address
+//	  "to":       "0x...",  recipient address, omitted for contract creations
+//	  "value":    "0x0",    amount to transfer
+//	  "gas":      "0x5208", gas limit
+//	  "gasPrice": "0x1",    gas price
+//	  "nonce":    "0x0",    sender nonce
+//	  "data":     "0x",     payload
+//	  "chainId":  "0x1",    chain ID to sign for, omitted for unprotected transactions
+//	  "rlp":      "0x..."   RLP encoding of the unsigned transaction
+//	}
+//
+// Quantities are accepted in hex or decimal notation and emitted in hex.
+type UnsignedTx struct {
+	From     common.Address        `json:"from"`
+	To       *common.Address       `json:"to,omitempty"`
+	Value    *math.HexOrDecimal256 `json:"value"`
+	Gas      math.HexOrDecimal64   `json:"gas"`
+	GasPrice *math.HexOrDecimal256 `json:"gasPrice"`
+	Nonce    math.HexOrDecimal64   `json:"nonce"`
+	Data     hexutil.Bytes         `json:"data"`
+	ChainID  *math.HexOrDecimal256 `json:"chainId,omitempty"`
+	RLP      hexutil.Bytes         `json:"rlp,omitempty"`
+}
+
+// NewUnsignedTx converts the transaction into its JSON document, including the
+// RLP encoding.
+func NewUnsignedTx(tx *types.Transaction, chainID *big.Int) (*UnsignedTx, error) {
+	if tx.Data.From == nil {
+		return nil, errors.New("transaction has no sender")
+	}
+	raw, err := EncodeToRLP(tx)
+	if err != nil {
+		return nil, err
+	}
+	utx := &UnsignedTx{
+		From:     common.Address(*tx.Data.From),
+		Value:    (*math.HexOrDecimal256)(new(big.Int)),
+		Gas:      math.HexOrDecimal64(tx.Data.GasLimit),
+		GasPrice: (*math.HexOrDecimal256)(new(big.Int)),
+		Nonce:    math.HexOrDecimal64(tx.Data.AccountNonce),
+		Data:     CopyBytes(tx.Data.Payload),
+		RLP:      raw,
+	}
+	if tx.Data.Recipient != nil {
+		to := common.Address(*tx.Data.Recipient)
+		utx.To = &to
+	}
+	if tx.Data.Amount != nil {
+		(*big.Int)(utx.Value).Set(tx.Data.Amount)
+	}
+	if tx.Data.Price != nil {
+		(*big.Int)(utx.GasPrice).Set(tx.Data.Price)
+	}
+	if chainID != nil {
+		utx.ChainID = (*math.HexOrDecimal256)(new(big.Int).Set(chainID))
+	}
+	return utx, nil
+}
+
+// Transaction builds the unsigned transaction described by the document. The
+// RLP field is ignored.
+func (utx *UnsignedTx) Transaction() *types.Transaction {
+	return newTransaction(uint64(utx.Nonce), utx.To, (*big.Int)(utx.Value), uint64(utx.Gas), (*big.Int)(utx.GasPrice), utx.Data, &utx.From)
+}
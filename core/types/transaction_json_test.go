@@ -0,0 +1,75 @@
+// Copyright(c) 2018 DSiSc Group. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package types
+
+import (
+	"encoding/json"
+	"math/big"
+	"testing"
+
+	"github.com/DSiSc/wallet/common"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestUnsignedTx(t *testing.T) {
+	from := common.HexToAddress("0x1000000000000000000000000000000000000001")
+	to := common.HexToAddress("0x2000000000000000000000000000000000000002")
+	tx := NewTransaction(7, to, big.NewInt(1000), 21000, big.NewInt(3), []byte{0xca, 0xfe}, from)
+
+	utx, err := NewUnsignedTx(tx, big.NewInt(5))
+	assert.Nil(t, err)
+	raw, err := EncodeToRLP(tx)
+	assert.Nil(t, err)
+	assert.Equal(t, raw, []byte(utx.RLP))
+
+	blob, err := json.Marshal(utx)
+	assert.Nil(t, err)
+	assert.JSONEq(t, `{
+		"from": "0x1000000000000000000000000000000000000001",
+		"to": "0x2000000000000000000000000000000000000002",
+		"value": "0x3e8",
+		"gas": "0x5208",
+		"gasPrice": "0x3",
+		"nonce": "0x7",
+		"data": "0xcafe",
+		"chainId": "0x5",
+		"rlp": "`+utx.RLP.String()+`"
+	}`, string(blob))
+
+	// Decimal quantities are accepted as well
+	var decoded UnsignedTx
+	assert.Nil(t, json.Unmarshal([]byte(`{
+		"from": "0x1000000000000000000000000000000000000001",
+		"to": "0x2000000000000000000000000000000000000002",
+		"value": "1000", "gas": "21000", "gasPrice": "3", "nonce": "7",
+		"data": "0xcafe", "chainId": "5"
+	}`), &decoded))
+	assert.Equal(t, tx.Data, decoded.Transaction().Data)
+	assert.Equal(t, big.NewInt(5), (*big.Int)(decoded.ChainID))
+}
+
+func TestUnsignedTxCreation(t *testing.T) {
+	from := common.HexToAddress("0x1000000000000000000000000000000000000001")
+	utx := &UnsignedTx{From: from, Data: []byte{0x60}}
+
+	tx := utx.Transaction()
+	assert.Nil(t, tx.Data.Recipient)
+	assert.Equal(t, big.NewInt(0), tx.Data.Amount)
+
+	encoded, err := NewUnsignedTx(tx, nil)
+	assert.Nil(t, err)
+	assert.Nil(t, encoded.To)
+	assert.Nil(t, encoded.ChainID)
+}
@@ -100,6 +100,26 @@ func Sender(signer Signer, tx *types.Transaction) (common.Address, error) {
 	return addr, nil
 }
 
+// Signed reports whether the transaction carries a signature.
+func Signed(tx *types.Transaction) bool {
+	for _, v := range []*big.Int{tx.Data.V, tx.Data.R, tx.Data.S} {
+		if v != nil && v.Sign() != 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// TxSigner returns the signer implied by the V value of a signed transaction:
+// an EIP155 signer for the derived chain ID if the transaction is protected,
+// a homestead signer otherwise.
+func TxSigner(tx *types.Transaction) Signer {
+	if Protected(tx) {
+		return NewEIP155Signer(ChainId(tx))
+	}
+	return HomesteadSigner{}
+}
+
 // Signer encapsulates transaction signature handling. Note that this interface is not a
 // stable API and may change at any time to accommodate new protocol rules.
 type Signer interface {
@@ -231,6 +251,19 @@ func (fs FrontierSigner) Sender(tx *types.Transaction) (common.Address, error) {
 	return recoverPlain(fs.Hash(tx), tx.Data.R, tx.Data.S, tx.Data.V, false)
 }
 
+// RecoverPlain returns the address of the key that produced the 65 byte
+// [R || S || V] signature of the hash, where V is 27 or 28.
+func RecoverPlain(hash common.Hash, sig []byte) (common.Address, error) {
+	if len(sig) != 65 {
+		return common.Address{}, fmt.Errorf("signature length %d, want 65", len(sig))
+	}
+	if sig[64] != 27 && sig[64] != 28 {
+		return common.Address{}, fmt.Errorf("signature V %d, want 27 or 28", sig[64])
+	}
+	R, S, V := new(big.Int).SetBytes(sig[:32]), new(big.Int).SetBytes(sig[32:64]), new(big.Int).SetUint64(uint64(sig[64]))
+	return recoverPlain(hash, R, S, V, true)
+}
+
 func recoverPlain(sighash common.Hash, R, S, Vb *big.Int, homestead bool) (common.Address, error) {
 	if Vb.BitLen() > 8 {
 		return common.Address{}, ErrInvalidSig
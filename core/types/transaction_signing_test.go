@@ -176,3 +176,33 @@ func TestFrontierSigning(t *testing.T) {
 		t.Errorf("exected from and address to be equal. Got %x want %x", from, addr)
 	}
 }
+
+func TestTxSigner(t *testing.T) {
+
+	key, addr := DefaultTestKey()
+
+	tx := NewTransaction(0, addr, new(big.Int), 0, new(big.Int), nil, addr)
+	if Signed(tx) {
+		t.Fatal("didn't expect tx to be signed")
+	}
+
+	for _, signer := range []Signer{NewEIP155Signer(big.NewInt(18)), HomesteadSigner{}} {
+		signed, err := SignTx(tx, signer, key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !Signed(signed) {
+			t.Fatal("expected tx to be signed")
+		}
+		if implied := TxSigner(signed); !implied.Equal(signer) {
+			t.Errorf("expected signer %T, got %T", signer, implied)
+		}
+		from, err := Sender(TxSigner(signed), signed)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if from != addr {
+			t.Errorf("exected from and address to be equal. Got %x want %x", from, addr)
+		}
+	}
+}
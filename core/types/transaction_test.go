@@ -15,6 +15,7 @@
 package types
 
 import (
+	"bytes"
 	"math/big"
 	"testing"
 
@@ -40,3 +41,32 @@ func TestNewTransaction(t *testing.T) {
 	)
 	assert.NotNil(emptyTx)
 }
+
+func TestDecodeRLP(t *testing.T) {
+	assert := assert.New(t)
+	key, addr := DefaultTestKey()
+	tx := NewTransaction(3, addr, big.NewInt(10), 21000, big.NewInt(1), []byte{1, 2}, addr)
+	signed, err := SignTx(tx, NewEIP155Signer(big.NewInt(18)), key)
+	assert.Nil(err)
+
+	raw, err := EncodeToRLP(signed)
+	assert.Nil(err)
+	decoded, err := DecodeRLP(raw)
+	assert.Nil(err)
+	assert.Equal(signed.Data, decoded.Data)
+	assert.Equal(TxHash(signed), TxHash(decoded))
+
+	from, err := Sender(NewEIP155Signer(big.NewInt(18)), decoded)
+	assert.Nil(err)
+	assert.Equal(addr, from)
+
+	// Bare transaction data is accepted as well
+	var buf bytes.Buffer
+	assert.Nil(EncodeRLP(signed, &buf))
+	decoded, err = DecodeRLP(buf.Bytes())
+	assert.Nil(err)
+	assert.Equal(signed.Data, decoded.Data)
+
+	_, err = DecodeRLP([]byte{0x01, 0x02})
+	assert.NotNil(err)
+}
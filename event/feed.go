@@ -0,0 +1,138 @@
+// Package event implements a minimal one-to-many event feed used by the account
+// backends to notify listeners about wallet arrivals and departures.
+package event
+
+import (
+	"errors"
+	"reflect"
+	"sync"
+)
+
+var errBadChannel = errors.New("event: Subscribe argument does not have sendable channel type")
+
+// Subscription represents a stream of events. The carrier of the events is
+// typically a channel, but isn't part of the interface.
+//
+// The Err channel is closed when Unsubscribe is called. Unsubscribe may be
+// called more than once, it is a no-op after the first call.
+type Subscription interface {
+	Err() <-chan error // returns the error channel
+	Unsubscribe()      // cancels sending of events, closing the error channel
+}
+
+// Feed implements one-to-many subscriptions where the carrier of events is a
+// channel. Values sent to a Feed are delivered to all subscribed channels
+// simultaneously.
+//
+// Feeds can only be used with a single type. The type is determined by the
+// first Send or Subscribe operation. Subsequent calls to these methods panic
+// if the type does not match.
+//
+// The zero value is ready to use.
+type Feed struct {
+	etype reflect.Type          // Element type of the subscribed channels
+	subs  map[*feedSub]struct{} // Currently active subscriptions
+
+	mu sync.Mutex
+}
+
+type feedTypeError struct {
+	got, want reflect.Type
+	op        string
+}
+
+func (e feedTypeError) Error() string {
+	return "event: wrong type in " + e.op + " got " + e.got.String() + ", want " + e.want.String()
+}
+
+// Subscribe adds a channel to the feed. Future sends will be delivered on the
+// channel until the subscription is canceled. All channels added must have the
+// same element type.
+//
+// The channel should have ample buffer space to avoid blocking other
+// subscribers. Slow subscribers are not dropped.
+func (f *Feed) Subscribe(channel interface{}) Subscription {
+	chanval := reflect.ValueOf(channel)
+	chantyp := chanval.Type()
+	if chantyp.Kind() != reflect.Chan || chantyp.ChanDir()&reflect.SendDir == 0 {
+		panic(errBadChannel)
+	}
+	sub := &feedSub{feed: f, channel: chanval, quit: make(chan struct{}), err: make(chan error, 1)}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if !f.typecheck(chantyp.Elem()) {
+		panic(feedTypeError{op: "Subscribe", got: chantyp, want: reflect.ChanOf(reflect.SendDir, f.etype)})
+	}
+	if f.subs == nil {
+		f.subs = make(map[*feedSub]struct{})
+	}
+	f.subs[sub] = struct{}{}
+	return sub
+}
+
+// Send delivers to all subscribed channels simultaneously. It returns the
+// number of subscribers that the value was sent to.
+func (f *Feed) Send(value interface{}) (nsent int) {
+	rvalue := reflect.ValueOf(value)
+
+	f.mu.Lock()
+	if !f.typecheck(rvalue.Type()) {
+		f.mu.Unlock()
+		panic(feedTypeError{op: "Send", got: rvalue.Type(), want: f.etype})
+	}
+	subs := make([]*feedSub, 0, len(f.subs))
+	for sub := range f.subs {
+		subs = append(subs, sub)
+	}
+	f.mu.Unlock()
+
+	// Deliver the value, giving up on subscribers that unsubscribe meanwhile
+	for _, sub := range subs {
+		chosen, _, _ := reflect.Select([]reflect.SelectCase{
+			{Dir: reflect.SelectSend, Chan: sub.channel, Send: rvalue},
+			{Dir: reflect.SelectRecv, Chan: reflect.ValueOf(sub.quit)},
+		})
+		if chosen == 0 {
+			nsent++
+		}
+	}
+	return nsent
+}
+
+// typecheck sets the feed type on first use and reports whether typ matches it.
+// Callers must hold f.mu.
+func (f *Feed) typecheck(typ reflect.Type) bool {
+	if f.etype == nil {
+		f.etype = typ
+		return true
+	}
+	return f.etype == typ
+}
+
+func (f *Feed) remove(sub *feedSub) {
+	f.mu.Lock()
+	delete(f.subs, sub)
+	f.mu.Unlock()
+}
+
+type feedSub struct {
+	feed    *Feed
+	channel reflect.Value
+	once    sync.Once
+	quit    chan struct{}
+	err     chan error
+}
+
+func (sub *feedSub) Unsubscribe() {
+	sub.once.Do(func() {
+		sub.feed.remove(sub)
+		close(sub.quit)
+		close(sub.err)
+	})
+}
+
+func (sub *feedSub) Err() <-chan error {
+	return sub.err
+}
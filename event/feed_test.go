@@ -0,0 +1,73 @@
+package event
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func TestFeed(t *testing.T) {
+	var feed Feed
+	ch1, ch2 := make(chan int, 1), make(chan int, 1)
+	sub1 := feed.Subscribe(ch1)
+	sub2 := feed.Subscribe(ch2)
+
+	assert.Equal(t, 2, feed.Send(1))
+	assert.Equal(t, 1, <-ch1)
+	assert.Equal(t, 1, <-ch2)
+
+	sub1.Unsubscribe()
+	assert.Equal(t, 1, feed.Send(2))
+	assert.Equal(t, 2, <-ch2)
+
+	_, ok := <-sub1.Err()
+	assert.False(t, ok)
+	sub2.Unsubscribe()
+	sub2.Unsubscribe()
+	assert.Equal(t, 0, feed.Send(3))
+}
+
+func TestFeedUnsubscribeBlockedSend(t *testing.T) {
+	var feed Feed
+	ch := make(chan int)
+	sub := feed.Subscribe(ch)
+
+	done := make(chan int)
+	go func() { done <- feed.Send(1) }()
+	time.Sleep(10 * time.Millisecond)
+	sub.Unsubscribe()
+
+	select {
+	case nsent := <-done:
+		assert.Equal(t, 0, nsent)
+	case <-time.After(time.Second):
+		t.Fatal("send did not return after unsubscribe")
+	}
+}
+
+func TestFeedTypeMismatch(t *testing.T) {
+	var feed Feed
+	feed.Subscribe(make(chan int))
+
+	assert.Panics(t, func() { feed.Subscribe(make(chan string)) })
+	assert.Panics(t, func() { feed.Send("foo") })
+	assert.Panics(t, func() { feed.Subscribe(make(<-chan int)) })
+}
+
+func TestSubscriptionScope(t *testing.T) {
+	var (
+		feed  Feed
+		scope SubscriptionScope
+	)
+	sub1 := scope.Track(feed.Subscribe(make(chan int, 1)))
+	scope.Track(feed.Subscribe(make(chan int, 1)))
+	assert.Equal(t, 2, scope.Count())
+
+	sub1.Unsubscribe()
+	assert.Equal(t, 1, scope.Count())
+
+	scope.Close()
+	assert.Equal(t, 0, scope.Count())
+	assert.Equal(t, 0, feed.Send(1))
+	assert.Nil(t, scope.Track(feed.Subscribe(make(chan int))))
+}
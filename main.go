@@ -18,11 +18,22 @@ var (
 	nodeFlags = []cli.Flag{
 		utils.DataDirFlag,
 		utils.KeyStoreDirFlag,
+		utils.KeyStoreBackendFlag,
 		utils.PasswordFileFlag,
+		utils.PasswordFDFlag,
+		utils.PasswordHelperFlag,
 		utils.LightKDFFlag,
+		utils.AuditLogFlag,
 	}
 
-	rpcFlags     = []cli.Flag{}
+	rpcFlags = []cli.Flag{
+		utils.NoHTTPFlag,
+		utils.RPCListenAddrFlag,
+		utils.RPCPortFlag,
+		utils.IPCDisabledFlag,
+		utils.IPCPathFlag,
+		utils.RulesFlag,
+	}
 	whisperFlags = []cli.Flag{}
 	metricsFlags = []cli.Flag{}
 )
@@ -33,11 +44,19 @@ func init() {
 	app.Copyright = "Copyright 2018-2023 The justitia Authors"
 	app.Commands = []cli.Command{
 		cmd.AccountCommand,
+		cmd.AddressCommand,
+		cmd.AuditCommand,
+		cmd.ServeCommand,
+		cmd.SignCommand,
+		cmd.TxCommand,
+		cmd.VerifyCommand,
 	}
 
 	sort.Sort(cli.CommandsByName(app.Commands))
 
 	app.Flags = append(app.Flags, nodeFlags...)
+	app.Flags = append(app.Flags, rpcFlags...)
+	app.Flags = append(app.Flags, utils.OutputFlag)
 
 	app.Before = func(ctx *cli.Context) error {
 		return nil
@@ -0,0 +1,185 @@
+// Package signer exposes the accounts of a keystore over a local JSON-RPC API,
+// so that other processes can delegate signing to a single wallet daemon
+// instead of decrypting key files themselves.
+package signer
+
+import (
+	"errors"
+	"math/big"
+	"time"
+
+	"github.com/DSiSc/craft/types"
+	"github.com/DSiSc/crypto-suite/crypto"
+	"github.com/DSiSc/wallet/accounts"
+	"github.com/DSiSc/wallet/accounts/keystore"
+	"github.com/DSiSc/wallet/accounts/policy"
+	"github.com/DSiSc/wallet/common"
+	"github.com/DSiSc/wallet/common/hexutil"
+	local "github.com/DSiSc/wallet/core/types"
+)
+
+// DefaultUnlockDuration is the time an account stays unlocked when
+// account_unlock is called without an explicit duration.
+const DefaultUnlockDuration = 300 * time.Second
+
+// SendTxArgs represents the arguments to sign a transaction.
+type SendTxArgs struct {
+	From     common.Address  `json:"from"`
+	To       *common.Address `json:"to"`
+	Gas      hexutil.Uint64  `json:"gas"`
+	GasPrice *hexutil.Big    `json:"gasPrice"`
+	Value    *hexutil.Big    `json:"value"`
+	Nonce    hexutil.Uint64  `json:"nonce"`
+	Data     hexutil.Bytes   `json:"data"`
+	ChainID  *hexutil.Big    `json:"chainId"`
+}
+
+// toTransaction converts the arguments into an unsigned transaction.
+func (args *SendTxArgs) toTransaction() *types.Transaction {
+	var to common.Address
+	if args.To != nil {
+		to = *args.To
+	}
+	tx := local.NewTransaction(uint64(args.Nonce), to, (*big.Int)(args.Value), uint64(args.Gas), (*big.Int)(args.GasPrice), args.Data, args.From)
+	if args.To == nil {
+		tx.Data.Recipient = nil
+	}
+	return tx
+}
+
+// SignTransactionResult is the response of account_signTransaction.
+type SignTransactionResult struct {
+	Raw  hexutil.Bytes `json:"raw"`
+	Hash common.Hash   `json:"hash"`
+}
+
+// API implements the account_ namespace of the signing daemon on top of an
+// account manager. New accounts and unlock sessions are handled by the
+// keystore backend.
+type API struct {
+	am     *accounts.Manager
+	ks     *keystore.KeyStore
+	policy *policy.Engine
+}
+
+// NewAPI creates a signing API over the wallets of the manager. The manager
+// must contain a keystore backend. If engine is not nil, all signing requests
+// are subject to its rules.
+func NewAPI(am *accounts.Manager, engine *policy.Engine) (*API, error) {
+	backends := am.Backends(keystore.KeyStoreType)
+	if len(backends) == 0 {
+		return nil, errors.New("no keystore backend available")
+	}
+	return &API{am: am, ks: backends[0].(*keystore.KeyStore), policy: engine}, nil
+}
+
+// List returns the addresses of all accounts known to the manager. Keystore
+// accounts are read from the keystore itself, so that accounts created moments
+// ago are included even if the manager hasn't been notified about them yet.
+func (api *API) List() []common.Address {
+	addresses := make([]common.Address, 0)
+	for _, account := range api.ks.Accounts() {
+		addresses = append(addresses, account.Address)
+	}
+	for _, wallet := range api.am.Wallets() {
+		if wallet.URL().Scheme == keystore.KeyStoreScheme {
+			continue
+		}
+		for _, account := range wallet.Accounts() {
+			addresses = append(addresses, account.Address)
+		}
+	}
+	return addresses
+}
+
+// New creates a new keystore account encrypted with the passphrase and
+// returns its address.
+func (api *API) New(passphrase string) (common.Address, error) {
+	account, err := api.ks.NewAccount(passphrase)
+	if err != nil {
+		return common.Address{}, err
+	}
+	return account.Address, nil
+}
+
+// Unlock unlocks the account for the given duration, or DefaultUnlockDuration
+// if none is given. A duration of 0 unlocks the account until the daemon exits.
+func (api *API) Unlock(address common.Address, passphrase string, duration *uint64) error {
+	d := DefaultUnlockDuration
+	if duration != nil {
+		d = time.Duration(*duration) * time.Second
+	}
+	return api.ks.TimedUnlock(accounts.Account{Address: address}, passphrase, d)
+}
+
+// Lock removes the decrypted key of the account from memory.
+func (api *API) Lock(address common.Address) error {
+	return api.ks.Lock(address)
+}
+
+// find returns the wallet holding the account, consulting the keystore directly
+// for accounts the manager hasn't been notified about yet. The wallet is guarded
+// by the signing policy if one is configured.
+func (api *API) find(account accounts.Account) (accounts.Wallet, error) {
+	wallet, err := api.am.Find(account)
+	if err == accounts.ErrUnknownAccount {
+		for _, w := range api.ks.Wallets() {
+			if w.Contains(account) {
+				wallet, err = w, nil
+				break
+			}
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+	if api.policy != nil {
+		wallet = api.policy.Wallet(wallet)
+	}
+	return wallet, nil
+}
+
+// SignTransaction signs the transaction described by args with the key of
+// args.From and returns its RLP encoding. Without a passphrase the account
+// must have been unlocked beforehand.
+func (api *API) SignTransaction(args SendTxArgs, passphrase *string) (*SignTransactionResult, error) {
+	account := accounts.Account{Address: args.From}
+	wallet, err := api.find(account)
+	if err != nil {
+		return nil, err
+	}
+	var (
+		tx      = args.toTransaction()
+		chainID = (*big.Int)(args.ChainID)
+		signed  *types.Transaction
+	)
+	if passphrase != nil {
+		signed, err = wallet.SignTxWithPassphrase(account, *passphrase, tx, chainID)
+	} else {
+		signed, err = wallet.SignTx(account, tx, chainID)
+	}
+	if err != nil {
+		return nil, err
+	}
+	raw, err := local.EncodeToRLP(signed)
+	if err != nil {
+		return nil, err
+	}
+	return &SignTransactionResult{Raw: raw, Hash: local.TxHash(signed)}, nil
+}
+
+// SignData signs the keccak256 hash of data with the key of the account. The
+// signature is in the [R || S || V] format where V is 0 or 1. Without a
+// passphrase the account must have been unlocked beforehand.
+func (api *API) SignData(address common.Address, data hexutil.Bytes, passphrase *string) (hexutil.Bytes, error) {
+	account := accounts.Account{Address: address}
+	wallet, err := api.find(account)
+	if err != nil {
+		return nil, err
+	}
+	hash := crypto.Keccak256(data)
+	if passphrase != nil {
+		return wallet.SignHashWithPassphrase(account, *passphrase, hash)
+	}
+	return wallet.SignHash(account, hash)
+}
@@ -0,0 +1,232 @@
+package signer
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+
+	"github.com/DSiSc/craft/log"
+	"github.com/DSiSc/wallet/common"
+	"github.com/DSiSc/wallet/common/hexutil"
+)
+
+const (
+	jsonrpcVersion           = "2.0"
+	maxRequestContentLength  = 1024 * 512
+	contentType              = "application/json"
+	errcodeParse             = -32700
+	errcodeInvalidRequest    = -32600
+	errcodeMethodNotFound    = -32601
+	errcodeInvalidParams     = -32602
+	errcodeDefault           = -32000
+	errmsgMethodNotFound     = "the method %s does not exist/is not available"
+	errmsgInvalidParamsCount = "expected %d to %d params, got %d"
+)
+
+type jsonRequest struct {
+	Version string          `json:"jsonrpc"`
+	ID      json.RawMessage `json:"id"`
+	Method  string          `json:"method"`
+	Params  json.RawMessage `json:"params"`
+}
+
+type jsonSuccessResponse struct {
+	Version string          `json:"jsonrpc"`
+	ID      json.RawMessage `json:"id"`
+	Result  interface{}     `json:"result"`
+}
+
+type jsonErrResponse struct {
+	Version string          `json:"jsonrpc"`
+	ID      json.RawMessage `json:"id"`
+	Error   jsonError       `json:"error"`
+}
+
+type jsonError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+func (err *jsonError) Error() string {
+	return err.Message
+}
+
+// callback handles a single method call with its positional parameters.
+type callback func(params json.RawMessage) (interface{}, error)
+
+// Server serves the account_ API as JSON-RPC 2.0 over HTTP and over stream
+// connections such as Unix domain sockets.
+type Server struct {
+	callbacks map[string]callback
+}
+
+// NewServer creates a JSON-RPC server dispatching to the given API.
+func NewServer(api *API) *Server {
+	return &Server{callbacks: map[string]callback{
+		"account_list": func(params json.RawMessage) (interface{}, error) {
+			if err := parseParams(params, 0); err != nil {
+				return nil, err
+			}
+			return api.List(), nil
+		},
+		"account_new": func(params json.RawMessage) (interface{}, error) {
+			var passphrase string
+			if err := parseParams(params, 1, &passphrase); err != nil {
+				return nil, err
+			}
+			return api.New(passphrase)
+		},
+		"account_unlock": func(params json.RawMessage) (interface{}, error) {
+			var (
+				address    common.Address
+				passphrase string
+				duration   *uint64
+			)
+			if err := parseParams(params, 2, &address, &passphrase, &duration); err != nil {
+				return nil, err
+			}
+			return true, api.Unlock(address, passphrase, duration)
+		},
+		"account_lock": func(params json.RawMessage) (interface{}, error) {
+			var address common.Address
+			if err := parseParams(params, 1, &address); err != nil {
+				return nil, err
+			}
+			return true, api.Lock(address)
+		},
+		"account_signTransaction": func(params json.RawMessage) (interface{}, error) {
+			var (
+				args       SendTxArgs
+				passphrase *string
+			)
+			if err := parseParams(params, 1, &args, &passphrase); err != nil {
+				return nil, err
+			}
+			return api.SignTransaction(args, passphrase)
+		},
+		"account_signData": func(params json.RawMessage) (interface{}, error) {
+			var (
+				address    common.Address
+				data       hexutil.Bytes
+				passphrase *string
+			)
+			if err := parseParams(params, 2, &address, &data, &passphrase); err != nil {
+				return nil, err
+			}
+			return api.SignData(address, data, passphrase)
+		},
+	}}
+}
+
+// parseParams decodes the positional parameter array into args, requiring at
+// least the first required of them to be present.
+func parseParams(params json.RawMessage, required int, args ...interface{}) error {
+	var values []json.RawMessage
+	if len(params) > 0 && string(params) != "null" {
+		if err := json.Unmarshal(params, &values); err != nil {
+			return &jsonError{Code: errcodeInvalidParams, Message: "non-array params"}
+		}
+	}
+	if len(values) < required || len(values) > len(args) {
+		return &jsonError{Code: errcodeInvalidParams, Message: fmt.Sprintf(errmsgInvalidParamsCount, required, len(args), len(values))}
+	}
+	for i, value := range values {
+		if err := json.Unmarshal(value, args[i]); err != nil {
+			return &jsonError{Code: errcodeInvalidParams, Message: fmt.Sprintf("invalid argument %d: %v", i, err)}
+		}
+	}
+	return nil
+}
+
+// handle executes a single request and builds its response.
+func (s *Server) handle(req *jsonRequest) interface{} {
+	if req.Version != jsonrpcVersion || req.Method == "" {
+		return errResponse(req.ID, &jsonError{Code: errcodeInvalidRequest, Message: "invalid request"})
+	}
+	cb, ok := s.callbacks[req.Method]
+	if !ok {
+		return errResponse(req.ID, &jsonError{Code: errcodeMethodNotFound, Message: fmt.Sprintf(errmsgMethodNotFound, req.Method)})
+	}
+	result, err := cb(req.Params)
+	if err != nil {
+		log.Debug("Signer request %s failed: %v", req.Method, err)
+		return errResponse(req.ID, err)
+	}
+	return &jsonSuccessResponse{Version: jsonrpcVersion, ID: req.ID, Result: result}
+}
+
+func errResponse(id json.RawMessage, err error) *jsonErrResponse {
+	e, ok := err.(*jsonError)
+	if !ok {
+		e = &jsonError{Code: errcodeDefault, Message: err.Error()}
+	}
+	return &jsonErrResponse{Version: jsonrpcVersion, ID: id, Error: *e}
+}
+
+// ServeHTTP implements http.Handler, answering a single JSON-RPC request per
+// POST. Requests carrying an Origin header are rejected, so that web pages
+// opened in a local browser cannot reach the signer.
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if r.Header.Get("Origin") != "" {
+		http.Error(w, "cross-origin requests are not allowed", http.StatusForbidden)
+		return
+	}
+	if r.ContentLength > maxRequestContentLength {
+		http.Error(w, fmt.Sprintf("content length too large (%d>%d)", r.ContentLength, maxRequestContentLength), http.StatusRequestEntityTooLarge)
+		return
+	}
+	if mt := r.Header.Get("Content-Type"); mt != "" && !strings.HasPrefix(mt, contentType) {
+		http.Error(w, "invalid content type, only "+contentType+" is supported", http.StatusUnsupportedMediaType)
+		return
+	}
+	var (
+		req  jsonRequest
+		resp interface{}
+	)
+	if err := json.NewDecoder(io.LimitReader(r.Body, maxRequestContentLength)).Decode(&req); err != nil {
+		resp = errResponse(nil, &jsonError{Code: errcodeParse, Message: err.Error()})
+	} else {
+		resp = s.handle(&req)
+	}
+	w.Header().Set("Content-Type", contentType)
+	json.NewEncoder(w).Encode(resp)
+}
+
+// ServeConn answers the stream of JSON-RPC requests read from conn until the
+// connection is closed or a malformed request is received.
+func (s *Server) ServeConn(conn io.ReadWriteCloser) {
+	defer conn.Close()
+
+	dec, enc := json.NewDecoder(conn), json.NewEncoder(conn)
+	for {
+		var req jsonRequest
+		if err := dec.Decode(&req); err != nil {
+			if err != io.EOF {
+				enc.Encode(errResponse(nil, &jsonError{Code: errcodeParse, Message: err.Error()}))
+			}
+			return
+		}
+		if err := enc.Encode(s.handle(&req)); err != nil {
+			return
+		}
+	}
+}
+
+// ServeListener accepts connections on l and serves each of them in its own
+// goroutine. It returns when the listener is closed.
+func (s *Server) ServeListener(l net.Listener) error {
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			return err
+		}
+		go s.ServeConn(conn)
+	}
+}
@@ -0,0 +1,170 @@
+package signer
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+
+	"github.com/DSiSc/crypto-suite/crypto"
+	"github.com/DSiSc/wallet/accounts"
+	"github.com/DSiSc/wallet/accounts/keystore"
+	"github.com/DSiSc/wallet/common"
+	"github.com/DSiSc/wallet/common/hexutil"
+	"github.com/stretchr/testify/assert"
+)
+
+const (
+	veryLightScryptN = 2
+	veryLightScryptP = 1
+)
+
+type testResponse struct {
+	Result json.RawMessage `json:"result"`
+	Error  *jsonError      `json:"error"`
+}
+
+func tmpServer(t *testing.T) (string, *Server) {
+	dir, err := ioutil.TempDir("", "signer-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	am := accounts.NewManager(keystore.NewKeyStore(dir, veryLightScryptN, veryLightScryptP))
+	api, err := NewAPI(am, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return dir, NewServer(api)
+}
+
+func call(t *testing.T, server *Server, method string, params ...interface{}) testResponse {
+	body, _ := json.Marshal(map[string]interface{}{"jsonrpc": "2.0", "id": 1, "method": method, "params": params})
+	req := httptest.NewRequest(http.MethodPost, "/", bytes.NewReader(body))
+	req.Header.Set("Content-Type", contentType)
+	rec := httptest.NewRecorder()
+	server.ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusOK, rec.Code)
+
+	var resp testResponse
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+		t.Fatal(err)
+	}
+	return resp
+}
+
+func TestServerAccounts(t *testing.T) {
+	dir, server := tmpServer(t)
+	defer os.RemoveAll(dir)
+
+	resp := call(t, server, "account_new", "foo")
+	assert.Nil(t, resp.Error)
+	var address common.Address
+	assert.Nil(t, json.Unmarshal(resp.Result, &address))
+
+	resp = call(t, server, "account_list")
+	assert.Nil(t, resp.Error)
+	var list []common.Address
+	assert.Nil(t, json.Unmarshal(resp.Result, &list))
+	assert.Equal(t, []common.Address{address}, list)
+}
+
+func TestServerSignData(t *testing.T) {
+	dir, server := tmpServer(t)
+	defer os.RemoveAll(dir)
+
+	var address common.Address
+	json.Unmarshal(call(t, server, "account_new", "foo").Result, &address)
+	data := hexutil.Bytes("hello")
+
+	// Locked accounts require a passphrase
+	resp := call(t, server, "account_signData", address, data)
+	assert.NotNil(t, resp.Error)
+	assert.Equal(t, keystore.ErrLocked.Error(), resp.Error.Message)
+
+	resp = call(t, server, "account_signData", address, data, "foo")
+	assert.Nil(t, resp.Error)
+	var sig hexutil.Bytes
+	assert.Nil(t, json.Unmarshal(resp.Result, &sig))
+	pub, err := crypto.SigToPub(crypto.Keccak256(data), sig)
+	assert.Nil(t, err)
+	assert.Equal(t, address, common.Address(crypto.PubkeyToAddress(*pub)))
+
+	// Unlocked accounts sign without one until locked again
+	assert.Nil(t, call(t, server, "account_unlock", address, "foo", 0).Error)
+	assert.Nil(t, call(t, server, "account_signData", address, data).Error)
+	assert.Nil(t, call(t, server, "account_lock", address).Error)
+	assert.NotNil(t, call(t, server, "account_signData", address, data).Error)
+}
+
+func TestServerSignTransaction(t *testing.T) {
+	dir, server := tmpServer(t)
+	defer os.RemoveAll(dir)
+
+	var address common.Address
+	json.Unmarshal(call(t, server, "account_new", "foo").Result, &address)
+
+	args := map[string]interface{}{
+		"from":     address,
+		"to":       common.HexToAddress("0x0000000000000000000000000000000000000001"),
+		"gas":      "0x5208",
+		"gasPrice": "0x1",
+		"value":    "0x10",
+		"nonce":    "0x0",
+		"chainId":  "0x1",
+	}
+	assert.NotNil(t, call(t, server, "account_signTransaction", args, "bar").Error)
+
+	resp := call(t, server, "account_signTransaction", args, "foo")
+	assert.Nil(t, resp.Error)
+	var result SignTransactionResult
+	assert.Nil(t, json.Unmarshal(resp.Result, &result))
+	assert.NotEmpty(t, result.Raw)
+	assert.Equal(t, common.BytesToHash(crypto.Keccak256(result.Raw)), result.Hash)
+}
+
+func TestServerErrors(t *testing.T) {
+	dir, server := tmpServer(t)
+	defer os.RemoveAll(dir)
+
+	resp := call(t, server, "account_foo")
+	assert.Equal(t, errcodeMethodNotFound, resp.Error.Code)
+
+	resp = call(t, server, "account_lock")
+	assert.Equal(t, errcodeInvalidParams, resp.Error.Code)
+
+	resp = call(t, server, "account_lock", "0x01", "0x02")
+	assert.Equal(t, errcodeInvalidParams, resp.Error.Code)
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	rec := httptest.NewRecorder()
+	server.ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusMethodNotAllowed, rec.Code)
+
+	req = httptest.NewRequest(http.MethodPost, "/", bytes.NewReader([]byte("{}")))
+	req.Header.Set("Origin", "http://example.com")
+	rec = httptest.NewRecorder()
+	server.ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusForbidden, rec.Code)
+}
+
+func TestServeConn(t *testing.T) {
+	dir, server := tmpServer(t)
+	defer os.RemoveAll(dir)
+
+	client, conn := net.Pipe()
+	go server.ServeConn(conn)
+	defer client.Close()
+
+	enc, dec := json.NewEncoder(client), json.NewDecoder(client)
+	for i := 0; i < 2; i++ {
+		assert.Nil(t, enc.Encode(map[string]interface{}{"jsonrpc": "2.0", "id": i, "method": "account_list"}))
+		var resp testResponse
+		assert.Nil(t, dec.Decode(&resp))
+		assert.Nil(t, resp.Error)
+		assert.Equal(t, "[]", string(resp.Result))
+	}
+}
@@ -1,14 +1,14 @@
 package utils
 
 import (
-	"flag"
 	"fmt"
 	"github.com/DSiSc/craft/types"
 	"github.com/DSiSc/validator/tools"
 	"github.com/DSiSc/wallet/accounts"
+	"github.com/DSiSc/wallet/accounts/hdwallet"
 	"github.com/DSiSc/wallet/accounts/keystore"
+	"github.com/DSiSc/wallet/accounts/metadata"
 	"github.com/DSiSc/wallet/common"
-	local "github.com/DSiSc/wallet/core/types"
 	web3cmn "github.com/DSiSc/web3go/common"
 	"github.com/DSiSc/web3go/provider"
 	"github.com/DSiSc/web3go/rpc"
@@ -18,7 +18,6 @@ import (
 	"math/big"
 	"os"
 	"path/filepath"
-	"strconv"
 )
 
 func statusOK(code int) bool { return code >= 200 && code <= 299 }
@@ -41,7 +40,40 @@ func AccountConfig(keystoreDir string) (int, int, string, error) {
 	return scryptN, scryptP, keydir, err
 }
 
+// Key storage backends selectable with --keystore-backend.
+const (
+	FileKeyStoreBackend   = "file"   // One file per key in the keystore directory
+	DBKeyStoreBackend     = "db"     // Single database file in the keystore directory
+	MemoryKeyStoreBackend = "memory" // Keys kept in memory only, lost on exit
+)
+
+// keyDatabaseName is the database file of the db backend within the keystore
+// directory. It is hidden so that the file backend does not take it for a key.
+const keyDatabaseName = ".keys.db"
+
+// MakeKeyStorage creates the storage of the named backend for the keystore
+// directory, encrypting new keys as configured by kdf.
+func MakeKeyStorage(backend, keydir string, kdf keystore.KDFConfig) (keystore.Storage, error) {
+	switch backend {
+	case FileKeyStoreBackend, "":
+		return keystore.NewFileStorage(keydir, kdf), nil
+	case DBKeyStoreBackend:
+		return keystore.NewDBStorage(filepath.Join(keydir, keyDatabaseName), kdf)
+	case MemoryKeyStoreBackend:
+		return keystore.NewMemoryStorage(kdf), nil
+	default:
+		return nil, fmt.Errorf("unknown keystore backend %q", backend)
+	}
+}
+
 func MakeAccountManager(keystoreDir string) (*accounts.Manager, string, error) {
+	return MakeAccountManagerWithBackend(keystoreDir, FileKeyStoreBackend, keystore.KDFConfig{})
+}
+
+// MakeAccountManagerWithBackend is like MakeAccountManager, keeping the keys of
+// the keystore in the named storage backend. Keys are encrypted as configured
+// by kdf, or with the standard scrypt parameters if it is the zero value.
+func MakeAccountManagerWithBackend(keystoreDir, backend string, kdf keystore.KDFConfig) (*accounts.Manager, string, error) {
 	scryptN, scryptP, keydir, err := AccountConfig(keystoreDir)
 	var ephemeral string
 	if keydir == "" {
@@ -57,9 +89,26 @@ func MakeAccountManager(keystoreDir string) (*accounts.Manager, string, error) {
 		return nil, "", err
 	}
 
+	if kdf.Argon2 == nil && kdf.ScryptN == 0 {
+		kdf = keystore.ScryptKDF(scryptN, scryptP)
+	}
+	storage, err := MakeKeyStorage(backend, keydir, kdf)
+	if err != nil {
+		return nil, "", err
+	}
+	ks, err := keystore.NewKeyStoreWithStorage(storage)
+	if err != nil {
+		return nil, "", err
+	}
+	md, err := metadata.Open(filepath.Join(keydir, metadata.FileName))
+	if err != nil {
+		return nil, "", err
+	}
+	ks.SetMetadata(md)
 	// Assemble the account manager and supported backends
 	backends := []accounts.Backend{
-		keystore.NewKeyStore(keydir, scryptN, scryptP),
+		ks,
+		hdwallet.NewHub(filepath.Join(keydir, hdwallet.Scheme), scryptN, scryptP),
 	}
 
 	return accounts.NewManager(backends...), ephemeral, nil
@@ -153,78 +202,34 @@ func GetUnlockedKeyByDir(address string, passphrase string, keystoreDir string)
 	return ac, key, err
 }
 
-//Send a signed transaction
+// SendTransaction submits the transaction to the node at DefaultRPCConfig, which
+// signs it. Use RPCClient.SendTransaction to reach other nodes.
 func SendTransaction(tx *types.Transaction) (common.Hash, error) {
-	//format 0x string
-	from := fmt.Sprintf("0x%x", *(tx.Data.From))
-	to := from
-	gas := "0x" + strconv.FormatInt(int64(tx.Data.GasLimit), 16)
-	gasprice := "0x" + tx.Data.Price.String()
-	value := "0x" + tx.Data.Amount.String()
-	data := ""
-
-	if tx.Data.Payload != nil {
-		data = "0x" + string(tx.Data.Payload)
-	} else {
-		data = ""
-	}
-
-	hostname := flag.String("hostname", "127.0.0.1", "The ethereum client RPC host")
-	port := flag.String("port", "47768", "The ethereum client RPC port")
-	verbose := flag.Bool("verbose", true, "Print verbose messages")
-
-	if *verbose {
-		fmt.Printf("Connect to %s:%s\n", *hostname, *port)
-	}
-
-	provider := provider.NewHTTPProvider(*hostname+":"+*port, rpc.GetDefaultMethod())
-	web3 := web3.NewWeb3(provider)
-
-	req := &web3cmn.TransactionRequest{
-		From:     from,
-		To:       to,
-		Gas:      gas,
-		GasPrice: gasprice,
-		Value:    value,
-		Data:     data,
+	client, err := NewRPCClient(DefaultRPCConfig)
+	if err != nil {
+		return common.Hash{}, err
 	}
-
-	hash, err := web3.Eth.SendTransaction(req)
-	return common.Hash(hash), err
+	return client.SendTransaction(tx)
 }
 
+// SendTransactionWeb3 submits the transaction request to the node at
+// DefaultRPCConfig. Use RPCClient.SendTransactionRequest to reach other nodes.
 func SendTransactionWeb3(tx *web3cmn.TransactionRequest) (common.Hash, error) {
-	hostname := flag.String("hostname", "127.0.0.1", "The ethereum client RPC host")
-	port := flag.String("port", "47768", "The ethereum client RPC port")
-	//port := flag.String("port", "8545", "The ethereum client RPC port")
-	verbose := flag.Bool("verbose", true, "Print verbose messages")
-
-	if *verbose {
-		fmt.Printf("Connect to %s:%s\n", *hostname, *port)
+	client, err := NewRPCClient(DefaultRPCConfig)
+	if err != nil {
+		return common.Hash{}, err
 	}
-
-	provider := provider.NewHTTPProvider(*hostname+":"+*port, rpc.GetDefaultMethod())
-	web3 := web3.NewWeb3(provider)
-
-	hash, err := web3.Eth.SendTransaction(tx)
-	return common.Hash(hash), err
+	return client.SendTransactionRequest(tx)
 }
 
+// SendRawTransaction submits the signed transaction to the node at
+// DefaultRPCConfig. Use RPCClient.SendRawTransaction to reach other nodes.
 func SendRawTransaction(tx *types.Transaction) (common.Hash, error) {
-	hostname := flag.String("hostname", "127.0.0.1", "The ethereum client RPC host")
-	port := flag.String("port", "47768", "The ethereum client RPC port")
-	verbose := flag.Bool("verbose", false, "Print verbose messages")
-	if *verbose {
-		fmt.Printf("Connect to %s:%s\n", *hostname, *port)
+	client, err := NewRPCClient(DefaultRPCConfig)
+	if err != nil {
+		return common.Hash{}, err
 	}
-
-	provider := provider.NewHTTPProvider(*hostname+":"+*port, rpc.GetDefaultMethod())
-	web3 := web3.NewWeb3(provider)
-
-	txBytes, _ := local.EncodeToRLP(tx)
-	hash, err := web3.Eth.SendRawTransaction(txBytes)
-
-	return common.Hash(hash), err
+	return client.SendRawTransaction(tx)
 }
 
 func SendRawTransactionWeb3(web *web3.Web3, txBytesStr string) (common.Hash, error) {
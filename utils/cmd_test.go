@@ -2,12 +2,15 @@ package utils
 
 import (
 	"fmt"
+	"github.com/DSiSc/wallet/accounts/hdwallet"
+	"github.com/DSiSc/wallet/accounts/keystore"
 	"github.com/DSiSc/wallet/common"
 	local "github.com/DSiSc/wallet/core/types"
 	"github.com/cespare/cp"
 	"github.com/stretchr/testify/assert"
 	"io/ioutil"
 	"math/big"
+	"os"
 	"path/filepath"
 	"testing"
 )
@@ -91,3 +94,28 @@ func TestAccountConfig(t *testing.T) {
 	_, _, _, err := AccountConfig(ks)
 	assert.Equal(t, nil, err)
 }
+
+func TestMakeAccountManagerHDWallet(t *testing.T) {
+	datadir := tmpDatadirWithKeystore(t)
+	ks := filepath.Join(datadir, "keystore")
+
+	am, _, err := MakeAccountManager(ks)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(am.Backends(hdwallet.HubType)))
+}
+
+func TestMakeAccountManagerWithBackend(t *testing.T) {
+	datadir := tmpdir(t)
+	ks := filepath.Join(datadir, "keystore")
+
+	for _, backend := range []string{FileKeyStoreBackend, DBKeyStoreBackend, MemoryKeyStoreBackend} {
+		am, _, err := MakeAccountManagerWithBackend(ks, backend, keystore.KDFConfig{})
+		assert.Nil(t, err)
+		assert.Equal(t, 1, len(am.Backends(keystore.KeyStoreType)))
+	}
+	_, err := os.Stat(filepath.Join(ks, keyDatabaseName))
+	assert.Nil(t, err)
+
+	_, _, err = MakeAccountManagerWithBackend(ks, "bolt", keystore.KDFConfig{})
+	assert.NotNil(t, err)
+}
@@ -6,9 +6,11 @@ import (
 	"github.com/DSiSc/wallet/accounts"
 	"github.com/DSiSc/wallet/accounts/keystore"
 	"github.com/DSiSc/wallet/common"
+	"github.com/DSiSc/wallet/common/icap"
 	"github.com/urfave/cli"
 	"io"
 	"io/ioutil"
+	"net/http"
 	"os"
 	"path/filepath"
 	"runtime"
@@ -52,23 +54,261 @@ var (
 		Usage: "Password file to use for non-interactive password input",
 		Value: "",
 	}
+	PasswordFDFlag = cli.IntFlag{
+		Name:  "password-fd",
+		Usage: "File descriptor to read passwords from, one per line like the password file",
+	}
+	PasswordHelperFlag = cli.StringFlag{
+		Name:  "password-helper",
+		Usage: "Program printing each password, run with the prompt as argument",
+	}
+	KeyStoreBackendFlag = cli.StringFlag{
+		Name:  "keystore-backend",
+		Usage: `Key storage backend: "file" (one file per key), "db" (single database file in the keystore directory) or "memory" (not persisted)`,
+		Value: FileKeyStoreBackend,
+	}
 	LightKDFFlag = cli.BoolFlag{
 		Name:  "lightkdf",
 		Usage: "Reduce key-derivation RAM & CPU usage at some expense of KDF strength",
 	}
+	KDFFlag = cli.StringFlag{
+		Name:  "kdf",
+		Usage: `Key derivation function encrypting the key: "scrypt" or "argon2id"`,
+		Value: ScryptKDF,
+	}
+	Argon2TimeFlag = cli.UintFlag{
+		Name:  "argon2time",
+		Usage: "Argon2id iterations over the memory",
+		Value: keystore.StandardArgon2Time,
+	}
+	Argon2MemoryFlag = cli.UintFlag{
+		Name:  "argon2memory",
+		Usage: "Argon2id memory size in KiB",
+		Value: keystore.StandardArgon2Memory,
+	}
+	Argon2ThreadsFlag = cli.UintFlag{
+		Name:  "argon2threads",
+		Usage: "Argon2id degree of parallelism",
+		Value: keystore.StandardArgon2Threads,
+	}
+	ForceFlag = cli.BoolFlag{
+		Name:  "force",
+		Usage: "Re-encrypt keys even if the key derivation function is weaker than their current one",
+	}
+	ImportJSONFlag = cli.BoolFlag{
+		Name:  "json",
+		Usage: "Import encrypted JSON key files, or a directory of them, instead of an unencrypted private key",
+	}
+	ImportPresaleFlag = cli.BoolFlag{
+		Name:  "presale",
+		Usage: "Import an Ethereum presale wallet file instead of an unencrypted private key",
+	}
+	TrashFlag = cli.BoolFlag{
+		Name:  "trash",
+		Usage: "Move the key to the .trash directory of the keystore instead of deleting it",
+	}
+	LabelFlag = cli.StringFlag{
+		Name:  "label",
+		Usage: "Label to refer to the account by instead of its address",
+	}
+	TagFlag = cli.StringSliceFlag{
+		Name:  "tag",
+		Usage: "Tag of the account, may be repeated (replaces all the current tags)",
+	}
+	NotesFlag = cli.StringFlag{
+		Name:  "notes",
+		Usage: "Free-form notes about the account",
+	}
+	AccountChainIDFlag = cli.StringFlag{
+		Name:  "chainid",
+		Usage: "Default chain ID of the transactions signed by the account, in hex or decimal (0 to unset)",
+	}
+	ExportPlaintextFlag = cli.BoolFlag{
+		Name:  "plaintext",
+		Usage: "Export the unencrypted private key in hex instead of an encrypted JSON key",
+	}
+	ExportFileFlag = cli.StringFlag{
+		Name:  "out",
+		Usage: "File to write the exported key to, created with 0600 permissions (standard output if omitted)",
+	}
+	ShareThresholdFlag = cli.IntFlag{
+		Name:  "threshold",
+		Usage: "Number of shares needed to rebuild the key",
+		Value: 2,
+	}
+	ShareCountFlag = cli.IntFlag{
+		Name:  "shares",
+		Usage: "Number of shares to split the key into",
+		Value: 3,
+	}
+	VanityPrefixFlag = cli.StringFlag{
+		Name:  "prefix",
+		Usage: "Hex digits the generated addresses start with",
+	}
+	VanitySuffixFlag = cli.StringFlag{
+		Name:  "suffix",
+		Usage: "Hex digits the generated addresses end with",
+	}
+	VanityRegexFlag = cli.StringFlag{
+		Name:  "regex",
+		Usage: "Regular expression matching the 40 lowercase hex digits of the generated addresses",
+	}
+	VanityICAPFlag = cli.BoolFlag{
+		Name:  "icap",
+		Usage: "Generate addresses fitting a direct ICAP account number (starting with 00)",
+	}
+	VanityCountFlag = cli.IntFlag{
+		Name:  "count",
+		Usage: "Number of matching accounts to generate",
+		Value: 1,
+	}
+	VanityWorkersFlag = cli.IntFlag{
+		Name:  "workers",
+		Usage: "Number of goroutines generating keys",
+		Value: runtime.NumCPU(),
+	}
+	AuditLogFlag = DirectoryFlag{
+		Name:  "auditlog",
+		Usage: "Audit log of key operations within the datadir (explicit paths escape it)",
+		Value: DirectoryString{"audit.log"},
+	}
+
+	// RPC settings
+	NoHTTPFlag = cli.BoolFlag{
+		Name:  "nohttp",
+		Usage: "Disable the HTTP-RPC server",
+	}
+	RPCListenAddrFlag = cli.StringFlag{
+		Name:  "rpcaddr",
+		Usage: "HTTP-RPC server listening interface",
+		Value: "localhost",
+	}
+	RPCPortFlag = cli.IntFlag{
+		Name:  "rpcport",
+		Usage: "HTTP-RPC server listening port",
+		Value: 8550,
+	}
+	IPCDisabledFlag = cli.BoolFlag{
+		Name:  "ipcdisable",
+		Usage: "Disable the IPC-RPC server",
+	}
+	IPCPathFlag = DirectoryFlag{
+		Name:  "ipcpath",
+		Usage: "Filename for IPC socket/pipe within the datadir (explicit paths escape it)",
+		Value: DirectoryString{"wallet.ipc"},
+	}
+	RulesFlag = cli.StringFlag{
+		Name:  "rules",
+		Usage: "Policy file with the rules enforced on signing requests",
+	}
+
+	// Transaction settings
+	TxFromFlag = cli.StringFlag{
+		Name:  "from",
+		Usage: "Sender address of the transaction",
+	}
+	TxToFlag = cli.StringFlag{
+		Name:  "to",
+		Usage: "Recipient address of the transaction (omit to create a contract)",
+	}
+	TxValueFlag = cli.StringFlag{
+		Name:  "value",
+		Usage: "Amount to transfer, in hex or decimal",
+		Value: "0",
+	}
+	TxGasFlag = cli.StringFlag{
+		Name:  "gas",
+		Usage: "Gas limit of the transaction, in hex or decimal",
+	}
+	TxGasPriceFlag = cli.StringFlag{
+		Name:  "gasprice",
+		Usage: "Gas price of the transaction, in hex or decimal",
+		Value: "0",
+	}
+	TxNonceFlag = cli.StringFlag{
+		Name:  "nonce",
+		Usage: "Nonce of the transaction, in hex or decimal",
+	}
+	TxDataFlag = cli.StringFlag{
+		Name:  "data",
+		Usage: "Hex encoded payload of the transaction",
+	}
+	TxChainIDFlag = cli.StringFlag{
+		Name:  "chainid",
+		Usage: "Chain ID to sign the transaction for, in hex or decimal (omit for unprotected transactions)",
+	}
+
+	// Message signing settings
+	MessageHexFlag = cli.BoolFlag{
+		Name:  "hex",
+		Usage: "The message is hex encoded binary data instead of text",
+	}
+	VOffsetFlag = cli.UintFlag{
+		Name:  "voffset",
+		Usage: "Offset of the V byte of signatures: 27 for 27/28 or 0 for 0/1",
+		Value: 27,
+	}
+	SignerFlag = cli.StringFlag{
+		Name:  "signer",
+		Usage: "Address the signature must be from",
+	}
+
+	// Node connection settings
+	NodeURLFlag = cli.StringFlag{
+		Name:  "node",
+		Usage: "JSON-RPC endpoint of the node",
+		Value: DefaultRPCConfig.URL,
+	}
+	NodeTimeoutFlag = cli.DurationFlag{
+		Name:  "nodetimeout",
+		Usage: "Timeout of requests to the node",
+		Value: DefaultRPCConfig.Timeout,
+	}
+	NodeHeaderFlag = cli.StringSliceFlag{
+		Name:  "nodeheader",
+		Usage: `Extra HTTP header sent to the node as "Name: value" (may be repeated)`,
+	}
+	NodeCAFlag = cli.StringFlag{
+		Name:  "nodeca",
+		Usage: "PEM file with the certificates trusted for https endpoints (default = system pool)",
+	}
+	NodeCertFlag = cli.StringFlag{
+		Name:  "nodecert",
+		Usage: "PEM file with the client certificate presented to the node",
+	}
+	NodeKeyFlag = cli.StringFlag{
+		Name:  "nodekey",
+		Usage: "PEM file with the key of the client certificate",
+	}
+	NodeInsecureFlag = cli.BoolFlag{
+		Name:  "nodeinsecure",
+		Usage: "Skip the verification of the node certificate",
+	}
 )
 
-// MakeAddress converts an account specified directly as a hex encoded string or
-// a key index in the key store to an internal account representation.
+// MakeAddress converts an account specified directly as a hex encoded string,
+// a label of the account metadata, an ICAP or a key index in the key store to an
+// internal account representation.
 func MakeAddress(ks *keystore.KeyStore, account string) (accounts.Account, error) {
 	// If the specified account is a valid address, return it
 	if common.IsHexAddress(account) {
 		return accounts.Account{Address: common.HexToAddress(account)}, nil
 	}
+	// Labels can't be mistaken for an index, try them next
+	if md := ks.Metadata(); md != nil {
+		if addr, ok := md.Lookup(account); ok {
+			return accounts.Account{Address: addr}, nil
+		}
+	}
+	if icap.IsICAP(account) {
+		if addr, err := icap.Decode(account); err == nil {
+			return accounts.Account{Address: addr}, nil
+		}
+	}
 	// Otherwise try to interpret the account as a keystore index
 	index, err := strconv.Atoi(account)
 	if err != nil || index < 0 {
-		return accounts.Account{}, fmt.Errorf("invalid account address or index %q", account)
+		return accounts.Account{}, fmt.Errorf("invalid account address, label, ICAP or index %q", account)
 	}
 	log.Warn("-------------------------------------------------------------------")
 	log.Warn("Referring to accounts by order in the keystore folder is dangerous!")
@@ -91,15 +331,73 @@ func MakePasswordList(ctx *cli.Context) []string {
 	}
 	text, err := ioutil.ReadFile(path)
 	if err != nil {
-		fmt.Println("Failed to read password file, ", err)
-		os.Exit(1)
+		Fatalf("Failed to read password file: %v", err)
+	}
+	return splitPasswords(string(text))
+}
+
+// MakeRPCConfig assembles the node connection settings from the --node* flags
+// of the command.
+func MakeRPCConfig(ctx *cli.Context) RPCConfig {
+	config := RPCConfig{
+		URL:                ctx.String(NodeURLFlag.Name),
+		Timeout:            ctx.Duration(NodeTimeoutFlag.Name),
+		Headers:            make(http.Header),
+		CAFile:             ctx.String(NodeCAFlag.Name),
+		CertFile:           ctx.String(NodeCertFlag.Name),
+		KeyFile:            ctx.String(NodeKeyFlag.Name),
+		InsecureSkipVerify: ctx.Bool(NodeInsecureFlag.Name),
 	}
-	lines := strings.Split(string(text), "\n")
-	// Sanitise DOS line endings.
-	for i := range lines {
-		lines[i] = strings.TrimRight(lines[i], "\r")
+	for _, header := range ctx.StringSlice(NodeHeaderFlag.Name) {
+		parts := strings.SplitN(header, ":", 2)
+		if len(parts) != 2 || strings.TrimSpace(parts[0]) == "" {
+			Fatalf("Invalid --%s %q, want \"Name: value\"", NodeHeaderFlag.Name, header)
+		}
+		config.Headers.Add(strings.TrimSpace(parts[0]), strings.TrimSpace(parts[1]))
+	}
+	return config
+}
+
+// Key derivation functions selectable with --kdf.
+const (
+	ScryptKDF   = "scrypt"
+	Argon2idKDF = "argon2id"
+)
+
+// MakeKDFConfig assembles the key derivation settings of newly encrypted keys
+// from the --kdf, --argon2* and --lightkdf flags of the command. With
+// --lightkdf the Argon2id costs not given explicitly are lowered as well.
+func MakeKDFConfig(ctx *cli.Context) keystore.KDFConfig {
+	light := ctx.GlobalBool(LightKDFFlag.Name)
+
+	switch kdf := ctx.String(KDFFlag.Name); kdf {
+	case ScryptKDF, "":
+		if light {
+			return keystore.ScryptKDF(keystore.LightScryptN, keystore.LightScryptP)
+		}
+		return keystore.ScryptKDF(keystore.StandardScryptN, keystore.StandardScryptP)
+
+	case Argon2idKDF:
+		params := keystore.Argon2Params{
+			Time:    uint32(ctx.Uint(Argon2TimeFlag.Name)),
+			Memory:  uint32(ctx.Uint(Argon2MemoryFlag.Name)),
+			Threads: uint8(ctx.Uint(Argon2ThreadsFlag.Name)),
+		}
+		if threads := ctx.Uint(Argon2ThreadsFlag.Name); threads > 255 {
+			Fatalf("Invalid --%s %d, at most 255 threads are supported", Argon2ThreadsFlag.Name, threads)
+		}
+		if light && !ctx.IsSet(Argon2TimeFlag.Name) {
+			params.Time = keystore.LightArgon2Time
+		}
+		if light && !ctx.IsSet(Argon2MemoryFlag.Name) {
+			params.Memory = keystore.LightArgon2Memory
+		}
+		return keystore.Argon2KDF(params)
+
+	default:
+		Fatalf("Unknown --%s %q, want %q or %q", KDFFlag.Name, kdf, ScryptKDF, Argon2idKDF)
 	}
-	return lines
+	return keystore.KDFConfig{}
 }
 
 // MigrateFlags sets the global flag from a local flag when it's set.
@@ -115,6 +413,8 @@ func MakePasswordList(ctx *cli.Context) []string {
 // This allows the use of the existing configuration functionality.
 // When all flags are migrated this function can be removed and the existing
 // configuration functionality must be changed that is uses local flags
+//
+// The wrapped action also runs with the --output format selected.
 func MigrateFlags(action func(ctx *cli.Context) error) func(*cli.Context) error {
 	return func(ctx *cli.Context) error {
 		for _, name := range ctx.FlagNames() {
@@ -122,14 +422,22 @@ func MigrateFlags(action func(ctx *cli.Context) error) func(*cli.Context) error
 				ctx.GlobalSet(name, ctx.String(name))
 			}
 		}
+		if err := SetOutputFormat(ctx.GlobalString(OutputFlag.Name)); err != nil {
+			Fatalf("Invalid --%s: %v", OutputFlag.Name, err)
+		}
 		return action(ctx)
 	}
 }
 
 // Fatalf formats a message to standard error and exits the program.
 // The message is also printed to standard output if standard error
-// is redirected to a different file.
+// is redirected to a different file. In JSON output mode the message
+// is printed to standard output as an error document instead.
 func Fatalf(format string, args ...interface{}) {
+	if outputFormat == JSONOutput {
+		writeError(os.Stdout, fmt.Sprintf(format, args...))
+		os.Exit(1)
+	}
 	w := io.MultiWriter(os.Stdout, os.Stderr)
 	if runtime.GOOS == "windows" {
 		// The SameFile check below doesn't work on Windows.
@@ -2,6 +2,7 @@ package utils
 
 import (
 	"github.com/DSiSc/wallet/accounts/keystore"
+	"github.com/DSiSc/wallet/accounts/metadata"
 	"github.com/stretchr/testify/assert"
 	"path/filepath"
 	"testing"
@@ -23,4 +24,20 @@ func TestMakeAddress(t *testing.T) {
 	_, err := MakeAddress(keystore, "2")
 
 	assert.Equal(t, nil, err)
+
+	// Accounts can be referred to by label
+	acc := keystore.Accounts()[0]
+	assert.Nil(t, keystore.Metadata().Set(acc.Address, metadata.Metadata{Label: "savings"}))
+	found, err := MakeAddress(keystore, "Savings")
+	assert.Nil(t, err)
+	assert.Equal(t, acc.Address, found.Address)
+	_, err = MakeAddress(keystore, "checking")
+	assert.NotNil(t, err)
+
+	// And by ICAP, with valid check digits
+	found, err = MakeAddress(keystore, "XE7338O073KYGTWWZN0F2WZ0R8PX5ZPPZS")
+	assert.Nil(t, err)
+	assert.Equal(t, "0x00c5496aEe77C1bA1f0854206A26DdA82a81D6D8", found.Address.Hex())
+	_, err = MakeAddress(keystore, "XE7438O073KYGTWWZN0F2WZ0R8PX5ZPPZS")
+	assert.NotNil(t, err)
 }
@@ -0,0 +1,111 @@
+package utils
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/urfave/cli"
+)
+
+// Output formats of the command results, selected with --output.
+const (
+	PlainOutput = "plain" // Human readable text
+	TableOutput = "table" // Aligned columns under a header
+	JSONOutput  = "json"  // A single JSON document, errors included
+)
+
+var OutputFlag = cli.StringFlag{
+	Name:  "output",
+	Usage: "Format of the command results and errors (plain, table or json)",
+	Value: PlainOutput,
+}
+
+// outputFormat is the format of the results printed by PrintResult and of the
+// errors reported by Fatalf.
+var outputFormat = PlainOutput
+
+// SetOutputFormat selects the format of the command results and errors. The
+// empty format is plain text.
+func SetOutputFormat(format string) error {
+	switch format {
+	case "":
+		outputFormat = PlainOutput
+	case PlainOutput, TableOutput, JSONOutput:
+		outputFormat = format
+	default:
+		return fmt.Errorf("unknown output format %q, want %s, %s or %s", format, PlainOutput, TableOutput, JSONOutput)
+	}
+	return nil
+}
+
+// OutputFormat returns the format of the command results and errors.
+func OutputFormat() string {
+	return outputFormat
+}
+
+// Result is the outcome of a command. It is printed as JSON by encoding the
+// value itself, so its exported fields make up the stable schema of the result.
+type Result interface {
+	// Plain writes the result as human readable text.
+	Plain(w io.Writer)
+
+	// Table returns the column headers and the rows of the result.
+	Table() (header []string, rows [][]string)
+}
+
+// PrintResult writes the result to standard output in the selected format.
+func PrintResult(result Result) {
+	writeResult(os.Stdout, outputFormat, result)
+}
+
+func writeResult(w io.Writer, format string, result Result) {
+	switch format {
+	case JSONOutput:
+		out, err := json.MarshalIndent(result, "", "  ")
+		if err != nil {
+			Fatalf("Could not encode the result: %v", err)
+		}
+		fmt.Fprintln(w, string(out))
+	case TableOutput:
+		header, rows := result.Table()
+		tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+		fmt.Fprintln(tw, strings.Join(header, "\t"))
+		for _, row := range rows {
+			fmt.Fprintln(tw, strings.Join(row, "\t"))
+		}
+		tw.Flush()
+	default:
+		result.Plain(w)
+	}
+}
+
+// MessageWriter returns where prompts and progress messages go: standard
+// output, unless it is reserved for the JSON result.
+func MessageWriter() io.Writer {
+	if outputFormat == JSONOutput {
+		return os.Stderr
+	}
+	return os.Stdout
+}
+
+// Failf exits the program after a result reporting partial failures has been
+// printed. The message is formatted like Fatalf, except in JSON mode where the
+// result already carries the errors and stands as the only document.
+func Failf(format string, args ...interface{}) {
+	if outputFormat == JSONOutput {
+		os.Exit(1)
+	}
+	Fatalf(format, args...)
+}
+
+// writeError writes the JSON document reporting a failed command.
+func writeError(w io.Writer, message string) {
+	out, _ := json.MarshalIndent(struct {
+		Error string `json:"error"`
+	}{message}, "", "  ")
+	fmt.Fprintln(w, string(out))
+}
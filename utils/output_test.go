@@ -0,0 +1,57 @@
+package utils
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type testResult struct {
+	Address string `json:"address"`
+	Label   string `json:"label,omitempty"`
+}
+
+func (r *testResult) Plain(w io.Writer) {
+	fmt.Fprintf(w, "Address: %s\n", r.Address)
+}
+
+func (r *testResult) Table() ([]string, [][]string) {
+	return []string{"ADDRESS", "LABEL"}, [][]string{{r.Address, r.Label}}
+}
+
+func TestSetOutputFormat(t *testing.T) {
+	defer SetOutputFormat(PlainOutput)
+
+	for _, format := range []string{PlainOutput, TableOutput, JSONOutput} {
+		assert.Nil(t, SetOutputFormat(format))
+		assert.Equal(t, format, OutputFormat())
+	}
+	assert.Nil(t, SetOutputFormat(""))
+	assert.Equal(t, PlainOutput, OutputFormat())
+	assert.NotNil(t, SetOutputFormat("xml"))
+	assert.Equal(t, PlainOutput, OutputFormat())
+}
+
+func TestWriteResult(t *testing.T) {
+	result := &testResult{Address: "0x88a0cd5AfBAfD59C0B673c845aE1F7df0dBAEA09", Label: "alice"}
+
+	var buf bytes.Buffer
+	writeResult(&buf, PlainOutput, result)
+	assert.Equal(t, "Address: 0x88a0cd5AfBAfD59C0B673c845aE1F7df0dBAEA09\n", buf.String())
+
+	buf.Reset()
+	writeResult(&buf, TableOutput, result)
+	assert.Equal(t, "ADDRESS                                     LABEL\n"+
+		"0x88a0cd5AfBAfD59C0B673c845aE1F7df0dBAEA09  alice\n", buf.String())
+
+	buf.Reset()
+	writeResult(&buf, JSONOutput, result)
+	assert.Equal(t, "{\n  \"address\": \"0x88a0cd5AfBAfD59C0B673c845aE1F7df0dBAEA09\",\n  \"label\": \"alice\"\n}\n", buf.String())
+
+	buf.Reset()
+	writeError(&buf, `no key for "alice"`)
+	assert.Equal(t, "{\n  \"error\": \"no key for \\\"alice\\\"\"\n}\n", buf.String())
+}
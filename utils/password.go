@@ -0,0 +1,173 @@
+package utils
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"strings"
+
+	"github.com/urfave/cli"
+	"golang.org/x/crypto/ssh/terminal"
+)
+
+const (
+	// PasswordEnvVar is the environment variable holding the passwords when no
+	// other non-interactive source is given, one per line like the password file.
+	PasswordEnvVar = "WALLET_PASSWORD"
+
+	// PasswordIndexEnvVar tells the password helper the number of the password
+	// asked for, starting from 0.
+	PasswordIndexEnvVar = "WALLET_PASSWORD_INDEX"
+)
+
+// PasswordProvider supplies the passwords of a command. Commands needing several
+// passwords number them from 0, in the order given by their description.
+type PasswordProvider interface {
+	// Password returns the i-th password of the command. The prompt tells what
+	// the password is for; confirm asks for it twice when it is typed in.
+	Password(prompt string, confirm bool, i int) (string, error)
+}
+
+// PasswordList provides passwords given up front. Indexes past the end get the
+// last password of the list.
+type PasswordList []string
+
+// Password implements PasswordProvider.
+func (l PasswordList) Password(prompt string, confirm bool, i int) (string, error) {
+	if len(l) == 0 {
+		return "", errors.New("empty password list")
+	}
+	if i < len(l) {
+		return l[i], nil
+	}
+	return l[len(l)-1], nil
+}
+
+// splitPasswords splits the content of a password file into its lines.
+func splitPasswords(text string) PasswordList {
+	lines := strings.Split(strings.TrimSuffix(text, "\n"), "\n")
+	// Sanitise DOS line endings.
+	for i := range lines {
+		lines[i] = strings.TrimRight(lines[i], "\r")
+	}
+	return lines
+}
+
+// PasswordHelper runs an external program for every password, like ssh-askpass:
+// the prompt is its only argument and it prints the password on its first line
+// of output. The program may talk to the user through the terminal.
+type PasswordHelper string
+
+// Password implements PasswordProvider.
+func (h PasswordHelper) Password(prompt string, confirm bool, i int) (string, error) {
+	if prompt == "" {
+		prompt = "Passphrase:"
+	}
+	cmd := exec.Command(string(h), prompt)
+	cmd.Stdin, cmd.Stderr = os.Stdin, os.Stderr
+	cmd.Env = append(os.Environ(), fmt.Sprintf("%s=%d", PasswordIndexEnvVar, i))
+	out, err := cmd.Output()
+	if err != nil {
+		return "", fmt.Errorf("password helper %s failed: %v", h, err)
+	}
+	return splitPasswords(string(out))[0], nil
+}
+
+// PasswordPrompt asks for the passwords on standard input, without echo when it
+// is a terminal.
+type PasswordPrompt struct{}
+
+// Password implements PasswordProvider.
+func (PasswordPrompt) Password(prompt string, confirm bool, i int) (string, error) {
+	w := MessageWriter()
+	if prompt != "" {
+		fmt.Fprintln(w, prompt)
+	}
+	password, err := readPassword(w, "Passphrase: ")
+	if err != nil {
+		return "", fmt.Errorf("failed to read passphrase: %v", err)
+	}
+	if confirm {
+		confirmation, err := readPassword(w, "Repeat passphrase: ")
+		if err != nil {
+			return "", fmt.Errorf("failed to read passphrase confirmation: %v", err)
+		}
+		if password != confirmation {
+			return "", errors.New("passphrases do not match")
+		}
+	}
+	return password, nil
+}
+
+// readPassword prompts for a password and reads it, with echo turned off if
+// standard input is a terminal.
+func readPassword(w io.Writer, prompt string) (string, error) {
+	fmt.Fprint(w, prompt)
+	defer fmt.Fprintln(w)
+
+	if fd := int(os.Stdin.Fd()); terminal.IsTerminal(fd) {
+		password, err := terminal.ReadPassword(fd)
+		return string(password), err
+	}
+	return ReadLine()
+}
+
+// stdin buffers standard input for ReadLine.
+var stdin = bufio.NewReader(os.Stdin)
+
+// ReadLine reads a line of standard input without its line ending. All prompts
+// must read through it so that piped input is consumed one line at a time.
+func ReadLine() (string, error) {
+	line, err := stdin.ReadString('\n')
+	if err == io.EOF && line != "" {
+		err = nil
+	}
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimRight(line, "\r\n"), nil
+}
+
+// MakePasswordProvider selects the source of the passwords: the file given by
+// --password, the descriptor given by --password-fd or the program given by
+// --password-helper, else the WALLET_PASSWORD environment variable, and the
+// terminal as the last resort.
+func MakePasswordProvider(ctx *cli.Context) PasswordProvider {
+	var sources []string
+	for _, name := range []string{PasswordFileFlag.Name, PasswordFDFlag.Name, PasswordHelperFlag.Name} {
+		if ctx.GlobalIsSet(name) {
+			sources = append(sources, "--"+name)
+		}
+	}
+	if len(sources) > 1 {
+		Fatalf("Only one password source may be given, not %s", strings.Join(sources, " and "))
+	}
+	switch {
+	case ctx.GlobalIsSet(PasswordFileFlag.Name):
+		return PasswordList(MakePasswordList(ctx))
+
+	case ctx.GlobalIsSet(PasswordFDFlag.Name):
+		fd := ctx.GlobalInt(PasswordFDFlag.Name)
+		if fd < 0 {
+			Fatalf("Invalid --%s %d", PasswordFDFlag.Name, fd)
+		}
+		f := os.NewFile(uintptr(fd), PasswordFDFlag.Name)
+		defer f.Close()
+		text, err := ioutil.ReadAll(f)
+		if err != nil {
+			Fatalf("Failed to read passwords from descriptor %d: %v", fd, err)
+		}
+		return splitPasswords(string(text))
+
+	case ctx.GlobalIsSet(PasswordHelperFlag.Name):
+		return PasswordHelper(ctx.GlobalString(PasswordHelperFlag.Name))
+	}
+	if text, ok := os.LookupEnv(PasswordEnvVar); ok {
+		return splitPasswords(text)
+	}
+	return PasswordPrompt{}
+}
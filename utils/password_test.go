@@ -0,0 +1,82 @@
+package utils
+
+import (
+	"flag"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/urfave/cli"
+)
+
+// passwordContext returns the context of a command run with the global flags.
+func passwordContext(t *testing.T, args ...string) *cli.Context {
+	set := flag.NewFlagSet("test", flag.ContinueOnError)
+	for _, f := range []cli.Flag{PasswordFileFlag, PasswordFDFlag, PasswordHelperFlag} {
+		f.Apply(set)
+	}
+	if err := set.Parse(args); err != nil {
+		t.Fatal(err)
+	}
+	global := cli.NewContext(nil, set, nil)
+	return cli.NewContext(nil, flag.NewFlagSet("cmd", flag.ContinueOnError), global)
+}
+
+func TestPasswordList(t *testing.T) {
+	passwords := splitPasswords("foo\r\ntwo words\n")
+	assert.Equal(t, PasswordList{"foo", "two words"}, passwords)
+
+	for i, want := range []string{"foo", "two words", "two words"} {
+		password, err := passwords.Password("", false, i)
+		assert.Nil(t, err)
+		assert.Equal(t, want, password)
+	}
+	_, err := PasswordList{}.Password("", false, 0)
+	assert.NotNil(t, err)
+}
+
+func TestPasswordHelper(t *testing.T) {
+	dir := tmpdir(t)
+	defer os.RemoveAll(dir)
+
+	helper := filepath.Join(dir, "helper")
+	script := "#!/bin/sh\necho \"$1 $" + PasswordIndexEnvVar + "\"\necho ignored\n"
+	assert.Nil(t, ioutil.WriteFile(helper, []byte(script), 0700))
+
+	password, err := PasswordHelper(helper).Password("Unlock foo", false, 2)
+	assert.Nil(t, err)
+	assert.Equal(t, "Unlock foo 2", password)
+
+	_, err = PasswordHelper(filepath.Join(dir, "missing")).Password("", false, 0)
+	assert.NotNil(t, err)
+}
+
+func TestMakePasswordProvider(t *testing.T) {
+	dir := tmpdir(t)
+	defer os.RemoveAll(dir)
+	os.Unsetenv(PasswordEnvVar)
+
+	// The terminal is the last resort
+	assert.Equal(t, PasswordPrompt{}, MakePasswordProvider(passwordContext(t)))
+
+	// The environment comes before the terminal
+	os.Setenv(PasswordEnvVar, "foo\nbar")
+	defer os.Unsetenv(PasswordEnvVar)
+	assert.Equal(t, PasswordList{"foo", "bar"}, MakePasswordProvider(passwordContext(t)))
+
+	// The flags come before the environment
+	file := filepath.Join(dir, "passwords")
+	assert.Nil(t, ioutil.WriteFile(file, []byte("baz\n"), 0600))
+	assert.Equal(t, PasswordList{"baz"}, MakePasswordProvider(passwordContext(t, "--password", file)))
+	assert.Equal(t, PasswordHelper("askpass"), MakePasswordProvider(passwordContext(t, "--password-helper", "askpass")))
+
+	r, w, err := os.Pipe()
+	assert.Nil(t, err)
+	w.Write([]byte("qux\nquux\n"))
+	w.Close()
+	provider := MakePasswordProvider(passwordContext(t, "--password-fd", strconv.Itoa(int(r.Fd()))))
+	assert.Equal(t, PasswordList{"qux", "quux"}, provider)
+}
@@ -0,0 +1,125 @@
+package utils
+
+import (
+	"errors"
+	"math/big"
+	"sync"
+
+	"github.com/DSiSc/craft/types"
+	"github.com/DSiSc/wallet/common"
+	"github.com/DSiSc/wallet/common/hexutil"
+	web3cmn "github.com/DSiSc/web3go/common"
+)
+
+// ChainReader is the part of the node API needed to prepare transactions. It
+// is implemented by the Eth module of web3go clients and by RPCClient.
+type ChainReader interface {
+	GetTransactionCount(address web3cmn.Address, quantity string) (*big.Int, error)
+	EstimateGas(req *web3cmn.TransactionRequest) (*big.Int, error)
+	GasPrice() (*big.Int, error)
+}
+
+// TxPreparer completes transactions with the nonce, gas limit and gas price
+// expected by the node before they are signed.
+//
+// The nonces handed out are remembered, so that several transactions of the
+// same account can be prepared and sent back-to-back before the node counts
+// them as pending. Prepared transactions are signed locally, or sent with
+// RPCClient.SendPreparedTransaction to keep their nonce.
+type TxPreparer struct {
+	node   ChainReader
+	nonces map[common.Address]uint64 // Next nonce to hand out per account
+
+	mu sync.Mutex
+}
+
+// NewTxPreparer creates a preparer querying the given node.
+func NewTxPreparer(node ChainReader) *TxPreparer {
+	return &TxPreparer{
+		node:   node,
+		nonces: make(map[common.Address]uint64),
+	}
+}
+
+// Prepare assigns the next nonce of the sender to the transaction, and fills in
+// the gas limit and gas price if they are zero. The nonce is always assigned,
+// as zero is a valid nonce.
+func (p *TxPreparer) Prepare(tx *types.Transaction) error {
+	if tx.Data.From == nil {
+		return errors.New("transaction has no sender")
+	}
+	from := common.Address(*tx.Data.From)
+
+	if tx.Data.Price == nil || tx.Data.Price.Sign() == 0 {
+		price, err := p.node.GasPrice()
+		if err != nil {
+			return err
+		}
+		tx.Data.Price = new(big.Int).Set(price)
+	}
+	if tx.Data.GasLimit == 0 {
+		gas, err := p.node.EstimateGas(estimateRequest(tx))
+		if err != nil {
+			return err
+		}
+		if !gas.IsUint64() {
+			return errors.New("gas estimate out of range")
+		}
+		tx.Data.GasLimit = gas.Uint64()
+	}
+	nonce, err := p.nextNonce(from)
+	if err != nil {
+		return err
+	}
+	tx.Data.AccountNonce = nonce
+	return nil
+}
+
+// nextNonce hands out the next nonce of the account: the pending nonce of the
+// node, unless nonces beyond it were handed out already.
+func (p *TxPreparer) nextNonce(from common.Address) (uint64, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	pending, err := p.node.GetTransactionCount(web3cmn.Address(from), "pending")
+	if err != nil {
+		return 0, err
+	}
+	if !pending.IsUint64() {
+		return 0, errors.New("pending nonce out of range")
+	}
+	nonce := pending.Uint64()
+	if next, ok := p.nonces[from]; ok && next > nonce {
+		nonce = next
+	}
+	p.nonces[from] = nonce + 1
+	return nonce, nil
+}
+
+// Reset forgets the nonces handed out to the account, so that the next one is
+// taken from the node again. It should be called when a prepared transaction
+// could not be sent, to avoid leaving a gap.
+func (p *TxPreparer) Reset(from common.Address) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	delete(p.nonces, from)
+}
+
+// estimateRequest converts the transaction into a gas estimation request.
+func estimateRequest(tx *types.Transaction) *web3cmn.TransactionRequest {
+	req := &web3cmn.TransactionRequest{
+		From: common.Address(*tx.Data.From).Hex(),
+		Data: hexutil.Encode(tx.Data.Payload),
+	}
+	if tx.Data.Recipient != nil {
+		req.To = common.Address(*tx.Data.Recipient).Hex()
+	}
+	if tx.Data.Price != nil {
+		req.GasPrice = hexutil.EncodeBig(tx.Data.Price)
+	}
+	if tx.Data.Amount != nil {
+		req.Value = hexutil.EncodeBig(tx.Data.Amount)
+	}
+	return req
+}
@@ -0,0 +1,117 @@
+package utils
+
+import (
+	"errors"
+	"math/big"
+	"testing"
+
+	"github.com/DSiSc/wallet/common"
+	local "github.com/DSiSc/wallet/core/types"
+	web3cmn "github.com/DSiSc/web3go/common"
+	"github.com/stretchr/testify/assert"
+)
+
+// testChain is a ChainReader with fixed answers.
+type testChain struct {
+	pending  uint64
+	gas      int64
+	price    int64
+	err      error
+	estimate *web3cmn.TransactionRequest // Last gas estimation request
+}
+
+func (c *testChain) GetTransactionCount(address web3cmn.Address, quantity string) (*big.Int, error) {
+	if quantity != "pending" {
+		return nil, errors.New("unexpected block " + quantity)
+	}
+	return new(big.Int).SetUint64(c.pending), c.err
+}
+
+func (c *testChain) EstimateGas(req *web3cmn.TransactionRequest) (*big.Int, error) {
+	c.estimate = req
+	return big.NewInt(c.gas), c.err
+}
+
+func (c *testChain) GasPrice() (*big.Int, error) {
+	return big.NewInt(c.price), c.err
+}
+
+func TestTxPreparer(t *testing.T) {
+	assert := assert.New(t)
+	chain := &testChain{pending: 5, gas: 21000, price: 20}
+	preparer := NewTxPreparer(chain)
+
+	from := common.HexToAddress("0xb26f2b342aab24bcf63ea218c6a9274d30ab9a15")
+	to := common.HexToAddress("0x00000000000000000000000000000000000000aa")
+
+	tx := local.NewTransaction(0, to, big.NewInt(1), 0, nil, []byte{0x01}, from)
+	assert.Nil(preparer.Prepare(tx))
+	assert.Equal(uint64(5), tx.Data.AccountNonce)
+	assert.Equal(uint64(21000), tx.Data.GasLimit)
+	assert.Equal(big.NewInt(20), tx.Data.Price)
+	assert.Equal(to.Hex(), chain.estimate.To)
+	assert.Equal("0x01", chain.estimate.Data)
+
+	// Explicit gas settings are kept
+	tx = local.NewTransaction(0, to, big.NewInt(1), 50000, big.NewInt(3), nil, from)
+	assert.Nil(preparer.Prepare(tx))
+	assert.Equal(uint64(6), tx.Data.AccountNonce)
+	assert.Equal(uint64(50000), tx.Data.GasLimit)
+	assert.Equal(big.NewInt(3), tx.Data.Price)
+
+	// Accounts are tracked separately
+	other := local.NewTransaction(0, to, nil, 0, nil, nil, to)
+	assert.Nil(preparer.Prepare(other))
+	assert.Equal(uint64(5), other.Data.AccountNonce)
+
+	// The node catching up with the local nonces does not cause collisions
+	chain.pending = 7
+	tx = local.NewTransaction(0, to, nil, 0, nil, nil, from)
+	assert.Nil(preparer.Prepare(tx))
+	assert.Equal(uint64(7), tx.Data.AccountNonce)
+	chain.pending = 9
+	assert.Nil(preparer.Prepare(tx))
+	assert.Equal(uint64(9), tx.Data.AccountNonce)
+
+	// Reset falls back to the node
+	chain.pending = 4
+	preparer.Reset(from)
+	assert.Nil(preparer.Prepare(tx))
+	assert.Equal(uint64(4), tx.Data.AccountNonce)
+}
+
+func TestTxPreparerErrors(t *testing.T) {
+	chain := &testChain{err: errors.New("node down")}
+	preparer := NewTxPreparer(chain)
+
+	from := common.HexToAddress("0xb26f2b342aab24bcf63ea218c6a9274d30ab9a15")
+	tx := local.NewTransaction(0, from, nil, 0, nil, nil, from)
+	assert.Equal(t, chain.err, preparer.Prepare(tx))
+
+	tx.Data.From = nil
+	assert.NotNil(t, preparer.Prepare(tx))
+}
+
+func TestRPCClientChainReader(t *testing.T) {
+	node, requests := newTestNode(t, "0x2a", nil)
+	defer node.Close()
+
+	client, err := NewRPCClient(RPCConfig{URL: node.URL})
+	assert.Nil(t, err)
+	var _ ChainReader = client
+
+	count, err := client.GetTransactionCount(web3cmn.Address{0x01}, "pending")
+	assert.Nil(t, err)
+	assert.Equal(t, big.NewInt(42), count)
+	assert.Equal(t, "eth_getTransactionCount", (<-requests).Method)
+
+	gas, err := client.EstimateGas(&web3cmn.TransactionRequest{From: "0x01"})
+	assert.Nil(t, err)
+	assert.Equal(t, big.NewInt(42), gas)
+	assert.Equal(t, "eth_estimateGas", (<-requests).Method)
+
+	price, err := client.GasPrice()
+	assert.Nil(t, err)
+	assert.Equal(t, big.NewInt(42), price)
+	assert.Equal(t, "eth_gasPrice", (<-requests).Method)
+}
@@ -0,0 +1,261 @@
+package utils
+
+import (
+	"bytes"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"sync/atomic"
+	"time"
+
+	"github.com/DSiSc/craft/types"
+	"github.com/DSiSc/wallet/common"
+	"github.com/DSiSc/wallet/common/hexutil"
+	local "github.com/DSiSc/wallet/core/types"
+	web3cmn "github.com/DSiSc/web3go/common"
+)
+
+// DefaultRPCConfig is the endpoint of a node running on the local machine.
+var DefaultRPCConfig = RPCConfig{
+	URL:     "http://127.0.0.1:47768",
+	Timeout: 30 * time.Second,
+}
+
+// RPCConfig describes how to reach the JSON-RPC endpoint of a node.
+type RPCConfig struct {
+	URL     string        // Endpoint URL, http or https
+	Timeout time.Duration // Timeout of a whole request, zero for none
+	Headers http.Header   // Extra headers sent with every request, e.g. for authentication
+
+	CAFile             string // PEM encoded certificates trusted for https endpoints, empty for the system pool
+	CertFile, KeyFile  string // PEM encoded client certificate and key, if the node requires one
+	InsecureSkipVerify bool   // Accept any server certificate
+}
+
+// tlsConfig builds the TLS settings of the config, or nil if there are none.
+func (config *RPCConfig) tlsConfig() (*tls.Config, error) {
+	if config.CAFile == "" && config.CertFile == "" && config.KeyFile == "" && !config.InsecureSkipVerify {
+		return nil, nil
+	}
+	tlsConfig := &tls.Config{InsecureSkipVerify: config.InsecureSkipVerify}
+	if config.CAFile != "" {
+		pem, err := ioutil.ReadFile(config.CAFile)
+		if err != nil {
+			return nil, err
+		}
+		tlsConfig.RootCAs = x509.NewCertPool()
+		if !tlsConfig.RootCAs.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates found in %s", config.CAFile)
+		}
+	}
+	if config.CertFile != "" || config.KeyFile != "" {
+		cert, err := tls.LoadX509KeyPair(config.CertFile, config.KeyFile)
+		if err != nil {
+			return nil, err
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+	return tlsConfig, nil
+}
+
+// RPCError is an error returned by the node.
+type RPCError struct {
+	Code    int             `json:"code"`
+	Message string          `json:"message"`
+	Data    json.RawMessage `json:"data,omitempty"`
+}
+
+func (err *RPCError) Error() string {
+	return fmt.Sprintf("rpc error %d: %s", err.Code, err.Message)
+}
+
+// RPCClient calls the JSON-RPC methods of a node over HTTP.
+type RPCClient struct {
+	url     string
+	headers http.Header
+	client  *http.Client
+	id      uint64
+}
+
+// NewRPCClient creates a client for the endpoint described by config.
+func NewRPCClient(config RPCConfig) (*RPCClient, error) {
+	if config.URL == "" {
+		return nil, errors.New("no RPC endpoint given")
+	}
+	tlsConfig, err := config.tlsConfig()
+	if err != nil {
+		return nil, err
+	}
+	transport := http.DefaultTransport
+	if tlsConfig != nil {
+		transport = &http.Transport{Proxy: http.ProxyFromEnvironment, TLSClientConfig: tlsConfig}
+	}
+	headers := make(http.Header)
+	for key, values := range config.Headers {
+		headers[key] = append([]string(nil), values...)
+	}
+	return &RPCClient{
+		url:     config.URL,
+		headers: headers,
+		client:  &http.Client{Timeout: config.Timeout, Transport: transport},
+	}, nil
+}
+
+// Call invokes the method with the given params and decodes its result into
+// result, unless result is nil.
+func (c *RPCClient) Call(result interface{}, method string, params ...interface{}) error {
+	if params == nil {
+		params = []interface{}{}
+	}
+	body, err := json.Marshal(map[string]interface{}{
+		"jsonrpc": "2.0",
+		"id":      atomic.AddUint64(&c.id, 1),
+		"method":  method,
+		"params":  params,
+	})
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequest("POST", c.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	for key, values := range c.headers {
+		req.Header[key] = values
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	var msg struct {
+		Result json.RawMessage `json:"result"`
+		Error  *RPCError       `json:"error"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&msg); err != nil {
+		if !statusOK(resp.StatusCode) {
+			return fmt.Errorf("%s: %s", c.url, resp.Status)
+		}
+		return err
+	}
+	if msg.Error != nil {
+		return msg.Error
+	}
+	if result == nil {
+		return nil
+	}
+	return json.Unmarshal(msg.Result, result)
+}
+
+// SendTransaction submits the transaction with eth_sendTransaction, leaving
+// the signature and the nonce to the node.
+func (c *RPCClient) SendTransaction(tx *types.Transaction) (common.Hash, error) {
+	return c.sendTransaction(tx, false)
+}
+
+// SendPreparedTransaction submits the transaction with eth_sendTransaction like
+// SendTransaction, but with its own nonce, as assigned by TxPreparer.
+func (c *RPCClient) SendPreparedTransaction(tx *types.Transaction) (common.Hash, error) {
+	return c.sendTransaction(tx, true)
+}
+
+func (c *RPCClient) sendTransaction(tx *types.Transaction, withNonce bool) (common.Hash, error) {
+	if tx.Data.From == nil {
+		return common.Hash{}, errors.New("transaction has no sender")
+	}
+	args := map[string]interface{}{
+		"from": common.Address(*tx.Data.From),
+		"gas":  hexutil.Uint64(tx.Data.GasLimit),
+		"data": hexutil.Bytes(tx.Data.Payload),
+	}
+	if withNonce {
+		args["nonce"] = hexutil.Uint64(tx.Data.AccountNonce)
+	}
+	if tx.Data.Recipient != nil {
+		args["to"] = common.Address(*tx.Data.Recipient)
+	}
+	if tx.Data.Price != nil {
+		args["gasPrice"] = (*hexutil.Big)(tx.Data.Price)
+	}
+	if tx.Data.Amount != nil {
+		args["value"] = (*hexutil.Big)(tx.Data.Amount)
+	}
+	var hash common.Hash
+	err := c.Call(&hash, "eth_sendTransaction", args)
+	return hash, err
+}
+
+// SendTransactionRequest submits a transaction given as web3 request with
+// eth_sendTransaction. Empty fields are left to the node.
+func (c *RPCClient) SendTransactionRequest(req *web3cmn.TransactionRequest) (common.Hash, error) {
+	var hash common.Hash
+	err := c.Call(&hash, "eth_sendTransaction", requestArgs(req))
+	return hash, err
+}
+
+// requestArgs converts a web3 request into call arguments, leaving out the
+// empty fields.
+func requestArgs(req *web3cmn.TransactionRequest) map[string]string {
+	args := make(map[string]string)
+	for key, value := range map[string]string{
+		"from":     req.From,
+		"to":       req.To,
+		"gas":      req.Gas,
+		"gasPrice": req.GasPrice,
+		"value":    req.Value,
+		"data":     req.Data,
+	} {
+		if value != "" {
+			args[key] = value
+		}
+	}
+	return args
+}
+
+// SendRawTransaction submits the signed transaction with eth_sendRawTransaction.
+func (c *RPCClient) SendRawTransaction(tx *types.Transaction) (common.Hash, error) {
+	raw, err := local.EncodeToRLP(tx)
+	if err != nil {
+		return common.Hash{}, err
+	}
+	var hash common.Hash
+	err = c.Call(&hash, "eth_sendRawTransaction", hexutil.Bytes(raw))
+	return hash, err
+}
+
+// GetTransactionCount returns the nonce of the account at the given block, or
+// the next nonce to use for "pending".
+func (c *RPCClient) GetTransactionCount(address web3cmn.Address, quantity string) (*big.Int, error) {
+	var count hexutil.Big
+	if err := c.Call(&count, "eth_getTransactionCount", common.Address(address), quantity); err != nil {
+		return nil, err
+	}
+	return count.ToInt(), nil
+}
+
+// EstimateGas returns the gas needed to execute the transaction request.
+func (c *RPCClient) EstimateGas(req *web3cmn.TransactionRequest) (*big.Int, error) {
+	var gas hexutil.Big
+	if err := c.Call(&gas, "eth_estimateGas", requestArgs(req)); err != nil {
+		return nil, err
+	}
+	return gas.ToInt(), nil
+}
+
+// GasPrice returns the gas price suggested by the node.
+func (c *RPCClient) GasPrice() (*big.Int, error) {
+	var price hexutil.Big
+	if err := c.Call(&price, "eth_gasPrice"); err != nil {
+		return nil, err
+	}
+	return price.ToInt(), nil
+}
@@ -0,0 +1,181 @@
+package utils
+
+import (
+	"encoding/json"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/DSiSc/wallet/common"
+	"github.com/DSiSc/wallet/common/hexutil"
+	local "github.com/DSiSc/wallet/core/types"
+	"github.com/stretchr/testify/assert"
+)
+
+// rpcRequest is a request received by the stand-in node.
+type rpcRequest struct {
+	Header http.Header
+	Method string            `json:"method"`
+	Params []json.RawMessage `json:"params"`
+}
+
+// newTestNode starts a stand-in node answering every request with result, or
+// with an error if rpcErr is set. The received requests are sent on the channel.
+func newTestNode(t *testing.T, result interface{}, rpcErr *RPCError) (*httptest.Server, chan *rpcRequest) {
+	requests := make(chan *rpcRequest, 16)
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var msg struct {
+			ID interface{} `json:"id"`
+			rpcRequest
+		}
+		if err := json.NewDecoder(r.Body).Decode(&msg); err != nil {
+			t.Errorf("invalid request: %v", err)
+		}
+		msg.Header = r.Header
+		requests <- &msg.rpcRequest
+
+		resp := map[string]interface{}{"jsonrpc": "2.0", "id": msg.ID}
+		if rpcErr != nil {
+			resp["error"] = rpcErr
+		} else {
+			resp["result"] = result
+		}
+		json.NewEncoder(w).Encode(resp)
+	})
+	return httptest.NewServer(handler), requests
+}
+
+func TestRPCClientSendRawTransaction(t *testing.T) {
+	want := common.HexToHash("0x1234")
+	node, requests := newTestNode(t, want, nil)
+	defer node.Close()
+
+	client, err := NewRPCClient(RPCConfig{
+		URL:     node.URL,
+		Timeout: time.Second,
+		Headers: http.Header{"Authorization": {"Bearer secret"}},
+	})
+	assert.Nil(t, err)
+
+	key, addr := local.DefaultTestKey()
+	tx, err := local.SignTx(local.NewTransaction(0, addr, big.NewInt(1), 21000, big.NewInt(1), nil, addr), local.NewEIP155Signer(big.NewInt(18)), key)
+	assert.Nil(t, err)
+
+	hash, err := client.SendRawTransaction(tx)
+	assert.Nil(t, err)
+	assert.Equal(t, want, hash)
+
+	req := <-requests
+	assert.Equal(t, "eth_sendRawTransaction", req.Method)
+	assert.Equal(t, "Bearer secret", req.Header.Get("Authorization"))
+	assert.Equal(t, "application/json", req.Header.Get("Content-Type"))
+
+	var raw hexutil.Bytes
+	assert.Equal(t, 1, len(req.Params))
+	assert.Nil(t, json.Unmarshal(req.Params[0], &raw))
+	expected, _ := local.EncodeToRLP(tx)
+	assert.Equal(t, expected, []byte(raw))
+}
+
+func TestRPCClientSendTransaction(t *testing.T) {
+	node, requests := newTestNode(t, common.HexToHash("0x1234"), nil)
+	defer node.Close()
+
+	client, err := NewRPCClient(RPCConfig{URL: node.URL})
+	assert.Nil(t, err)
+
+	from := common.HexToAddress("0xb26f2b342aab24bcf63ea218c6a9274d30ab9a15")
+	to := common.HexToAddress("0x00000000000000000000000000000000000000aa")
+	tx := local.NewTransaction(7, to, big.NewInt(255), 21000, big.NewInt(1000), []byte{0xde, 0xad}, from)
+	expected := map[string]string{
+		"from":     "0xb26f2b342aab24bcf63ea218c6a9274d30ab9a15",
+		"to":       "0x00000000000000000000000000000000000000aa",
+		"gas":      "0x5208",
+		"gasPrice": "0x3e8",
+		"value":    "0xff",
+		"data":     "0xdead",
+	}
+
+	// The node assigns the nonce, whatever the transaction holds
+	_, err = client.SendTransaction(tx)
+	assert.Nil(t, err)
+	req := <-requests
+	assert.Equal(t, "eth_sendTransaction", req.Method)
+	var args map[string]string
+	assert.Nil(t, json.Unmarshal(req.Params[0], &args))
+	assert.Equal(t, expected, args)
+
+	// Unless the transaction was prepared
+	_, err = client.SendPreparedTransaction(tx)
+	assert.Nil(t, err)
+	req = <-requests
+	args = nil
+	assert.Nil(t, json.Unmarshal(req.Params[0], &args))
+	expected["nonce"] = "0x7"
+	assert.Equal(t, expected, args)
+}
+
+func TestRPCClientError(t *testing.T) {
+	node, _ := newTestNode(t, nil, &RPCError{Code: -32000, Message: "nonce too low"})
+	defer node.Close()
+
+	client, err := NewRPCClient(RPCConfig{URL: node.URL})
+	assert.Nil(t, err)
+
+	err = client.Call(nil, "eth_blockNumber")
+	rpcErr, ok := err.(*RPCError)
+	assert.True(t, ok, "got %v", err)
+	assert.Equal(t, -32000, rpcErr.Code)
+	assert.Equal(t, "nonce too low", rpcErr.Message)
+
+	_, err = NewRPCClient(RPCConfig{})
+	assert.NotNil(t, err)
+}
+
+func TestRPCClientTimeout(t *testing.T) {
+	done := make(chan struct{})
+	node := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-done
+	}))
+	defer node.Close()
+	defer close(done)
+
+	client, err := NewRPCClient(RPCConfig{URL: node.URL, Timeout: 50 * time.Millisecond})
+	assert.Nil(t, err)
+	assert.NotNil(t, client.Call(nil, "eth_blockNumber"))
+}
+
+func TestRPCClientTLS(t *testing.T) {
+	node := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"jsonrpc":"2.0","id":1,"result":"0x10"}`))
+	}))
+	defer node.Close()
+
+	// The certificate of the node is not in the system pool
+	client, err := NewRPCClient(RPCConfig{URL: node.URL})
+	assert.Nil(t, err)
+	assert.NotNil(t, client.Call(nil, "eth_blockNumber"))
+
+	ca := filepath.Join(tmpdir(t), "ca.pem")
+	cert := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: node.Certificate().Raw})
+	assert.Nil(t, ioutil.WriteFile(ca, cert, 0600))
+
+	for _, config := range []RPCConfig{
+		{URL: node.URL, CAFile: ca},
+		{URL: node.URL, InsecureSkipVerify: true},
+	} {
+		client, err := NewRPCClient(config)
+		assert.Nil(t, err)
+		var number hexutil.Uint64
+		assert.Nil(t, client.Call(&number, "eth_blockNumber"))
+		assert.Equal(t, hexutil.Uint64(16), number)
+	}
+
+	_, err = NewRPCClient(RPCConfig{URL: node.URL, CAFile: filepath.Join(tmpdir(t), "missing.pem")})
+	assert.NotNil(t, err)
+}